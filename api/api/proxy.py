@@ -15,6 +15,7 @@
 """This module defines the API routes for proxy data."""
 
 from flask import Blueprint, jsonify, request
+from google.api_core.exceptions import NotFound
 from google.cloud import bigquery
 from google.cloud import run_v2
 from datetime import datetime
@@ -25,6 +26,33 @@ bp = Blueprint("proxy", __name__)
 bq_client = bigquery.Client()
 
 
+def log_table(name, date):
+    """Returns the table and filter to read a day of a log sink's entries.
+
+    Log sinks write to a table partitioned by day on the entry timestamp.
+    Deployments from before partitioning also have a table per day, which is
+    used instead when it exists.
+
+    Args:
+        name: Name of the sink table, such as "litmus_proxy_log".
+        date: Day to read (format: YYYY-MM-DD or YYYYMMDD).
+
+    Returns:
+        The quoted table reference and a WHERE condition selecting the day.
+
+    Raises:
+        ValueError: If date is not a valid date.
+    """
+    day = datetime.strptime(date.replace("-", ""), "%Y%m%d").date()
+    shard = f"{settings.project_id}.litmus_analytics.{name}_{day:%Y%m%d}"
+    try:
+        bq_client.get_table(shard)
+        return f"`{shard}`", "TRUE"
+    except NotFound:
+        table = f"{settings.project_id}.litmus_analytics.{name}"
+        return f"`{table}`", f'DATE(timestamp) = "{day.isoformat()}"'
+
+
 @bp.route("/data", methods=["GET"])
 @auth.login_required
 def proxy_data():
@@ -50,9 +78,15 @@ def proxy_data():
     if not date:
         return jsonify({"error": 'Missing "date" or "context" parameter'}), 400
 
+    try:
+        table, day_filter = log_table("litmus_proxy_log", date)
+    except ValueError:
+        return jsonify({"error": 'Invalid "date" parameter'}), 400
+
     query = f"""
         SELECT jsonPayload
-        FROM `{settings.project_id}.litmus_analytics.litmus_proxy_log_{date}`
+        FROM {table}
+        WHERE {day_filter}
         ORDER BY jsonPayload.timestamp ASC
         LIMIT 100
     """
@@ -60,8 +94,8 @@ def proxy_data():
     if context:
         query = f"""
             SELECT jsonPayload
-            FROM `{settings.project_id}.litmus_analytics.litmus_proxy_log_{date}`
-            WHERE jsonPayload.litmuscontext = "{context}"
+            FROM {table}
+            WHERE {day_filter} AND jsonPayload.litmuscontext = "{context}"
             ORDER BY jsonPayload.timestamp ASC
             LIMIT 100
         """
@@ -110,9 +144,15 @@ def litmus_data():
     if not date:
         return jsonify({"error": 'Missing "date" or "context" parameter'}), 400
 
+    try:
+        table, day_filter = log_table("litmus_core_log", date)
+    except ValueError:
+        return jsonify({"error": 'Invalid "date" parameter'}), 400
+
     query = f"""
         SELECT jsonPayload
-        FROM `{settings.project_id}.litmus_analytics.litmus_core_log_{date}`
+        FROM {table}
+        WHERE {day_filter}
         ORDER BY jsonPayload.timestamp ASC
         LIMIT 1000
     """
@@ -120,8 +160,8 @@ def litmus_data():
     if context:
         query = f"""
             SELECT jsonPayload
-            FROM `{settings.project_id}.litmus_analytics.litmus_core_log_{date}`
-            WHERE jsonPayload.requestheaders.x_litmus_request = "{context}"
+            FROM {table}
+            WHERE {day_filter} AND jsonPayload.requestheaders.x_litmus_request = "{context}"
             ORDER BY jsonPayload.timestamp ASC
             LIMIT 1000
         """
@@ -164,6 +204,11 @@ def proxy_agg():
     if not date:
         return jsonify({"error": 'Missing "date" parameter'}), 400
 
+    try:
+        table, day_filter = log_table("litmus_proxy_log", date)
+    except ValueError:
+        return jsonify({"error": 'Invalid "date" parameter'}), 400
+
     query = f"""
         SELECT
             jsonPayload.litmuscontext,
@@ -172,7 +217,8 @@ def proxy_agg():
             sum(jsonPayload.responsebody.usagemetadata.candidatestokencount) AS candidates_token_count,
             avg(jsonPayload.latency) AS average_latency
         FROM
-            `{settings.project_id}.litmus_analytics.litmus_proxy_log_{date}`
+            {table}
+        WHERE {day_filter}
         GROUP BY 1;
     """
 
@@ -185,8 +231,8 @@ def proxy_agg():
                 sum(jsonPayload.responsebody.usagemetadata.candidatestokencount) AS candidates_token_count,
                 avg(jsonPayload.latency) AS average_latency
             FROM
-                `{settings.project_id}.litmus_analytics.litmus_proxy_log_{date}`
-            WHERE jsonPayload.litmuscontext = "{context}"
+                {table}
+            WHERE {day_filter} AND jsonPayload.litmuscontext = "{context}"
             GROUP BY 1;
         """
 
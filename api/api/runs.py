@@ -14,7 +14,7 @@
 
 """This module defines the API routes for test runs and missions."""
 import json
-from datetime import datetime
+from datetime import datetime, timezone
 
 from flask import Blueprint, jsonify, request, send_file
 from google.cloud import firestore
@@ -28,7 +28,7 @@ from io import BytesIO
 from util.assess import ask_llm_for_summary
 
 bp = Blueprint("runs", __name__)
-db = firestore.Client()  # Initialize Firestore client
+db = firestore.Client(database=settings.firestore_database)  # Initialize Firestore client
 
 
 @bp.route("/submit", methods=["POST"])
@@ -169,7 +169,7 @@ def submit_run(data=None):
     invoke_job(
         settings.project_id,
         settings.region,
-        "litmus-worker",
+        settings.worker_job,
         run_id,
         template_id,
         template_type,
@@ -279,7 +279,7 @@ def invoke_run():
     invoke_job(
         settings.project_id,
         settings.region,
-        "litmus-worker",
+        settings.worker_job,
         run_id,
         template_id,
         template_type,
@@ -552,25 +552,58 @@ def list_runs():
     Query parameters:
         - type (optional): The type of runs/missions to retrieve ("Test Run" or "Test Mission").
                            If not provided, returns all runs/missions.
+        - status (optional): Only return runs with this status, such as "Completed".
+        - template_id (optional): Only return runs of this template.
+        - since (optional): Only return runs started at or after this ISO 8601 time.
 
     Returns:
-        JSON response containing an array of run/mission details.
+        JSON response containing an array of run/mission details and the
+        filters that were applied, so clients can tell they need not filter
+        the runs themselves.
     """
     runs_ref = db.collection("test_runs")
+    filters = {}
 
     # Apply filtering if type is provided in query parameters
     template_type_filter = request.args.get("type")
     if template_type_filter:
         runs_ref = runs_ref.where("template_type", "==", template_type_filter)
+        filters["type"] = template_type_filter
+
+    status_filter = request.args.get("status")
+    if status_filter:
+        runs_ref = runs_ref.where("status", "==", status_filter)
+        filters["status"] = status_filter
+
+    template_id_filter = request.args.get("template_id")
+    if template_id_filter:
+        runs_ref = runs_ref.where("template_id", "==", template_id_filter)
+        filters["template_id"] = template_id_filter
+
+    # Filtered here rather than in the query, which would need a composite
+    # index for every combination with the equality filters above
+    since_filter = request.args.get("since")
+    since = None
+    if since_filter:
+        try:
+            since = datetime.fromisoformat(since_filter.replace("Z", "+00:00"))
+        except ValueError:
+            return jsonify({"error": 'Invalid "since" parameter'}), 400
+        if since.tzinfo is None:
+            since = since.replace(tzinfo=timezone.utc)
+        filters["since"] = since_filter
 
     runs = []
     for doc in runs_ref.stream():
         run_data = doc.to_dict()
+        start_time = run_data.get("start_time")
+        if since and (start_time is None or start_time < since):
+            continue
         runs.append(
             {
                 "run_id": doc.id,
                 "status": run_data.get("status"),
-                "start_time": run_data.get("start_time"),
+                "start_time": start_time,
                 "end_time": run_data.get("end_time"),
                 "progress": run_data.get("progress"),
                 "template_id": run_data.get("template_id"),
@@ -581,7 +614,7 @@ def list_runs():
     # Sort runs by start_time in descending order
     runs.sort(key=lambda run: run["start_time"], reverse=True)
 
-    return jsonify({"runs": runs})
+    return jsonify({"runs": runs, "filters": filters})
 
 
 def invoke_job(
@@ -20,7 +20,7 @@ from api.auth import auth
 from util.settings import settings
 
 bp = Blueprint("templates", __name__)
-db = firestore.Client()
+db = firestore.Client(database=settings.firestore_database)
 
 
 # Templates: Add
@@ -29,6 +29,10 @@ class Settings:
     """GCP Project ID. Defaults to "<INSERT-PROJECT>"."""
     region: str = os.environ.get("GCP_REGION", "us-central1")
     """GCP Region. Defaults to "us-central1"."""
+    worker_job: str = os.environ.get("WORKER_JOB", "litmus-worker")
+    """Cloud Run job that executes runs. Defaults to "litmus-worker"."""
+    firestore_database: str = os.environ.get("FIRESTORE_DATABASE", "(default)")
+    """Firestore database storing templates and runs. Defaults to "(default)"."""
 
     # AI Specific
     ai_location: str = os.environ.get("AI_LOCATION", "global")
@@ -17,6 +17,7 @@ package analytics
 import (
 	"fmt"
 	"os/exec"
+	"strconv"
 	"strings"
 	"time"
 
@@ -26,37 +27,90 @@ import (
 
 // Analytics represents the configuration for Litmus analytics.
 type Analytics struct {
-	ProjectID   string
-	Region      string
-	BucketName  string
-	DatasetName string
+	ProjectID       string
+	Region          string
+	BucketName      string
+	DatasetName     string
+	KMSKey          string            // Optional customer-managed encryption key for the dataset
+	LogFilter       string            // Optional filter fragment ANDed with the sinks' log name filters
+	TableExpiration time.Duration     // Optional lifetime of the sink tables' daily partitions
+	Labels          map[string]string // Labels for the dataset, besides litmus-managed
 }
 
-// DeployAnalytics deploys Litmus analytics resources.
-func DeployAnalytics(projectID, region string, quiet bool) error {
+// DefaultDataset is the dataset analytics is deployed to and read from.
+const DefaultDataset = "litmus_analytics"
+
+// sinkTables are the tables the log sinks write to. They're partitioned by
+// day on the entries' timestamp. Deployments from before partitioning was
+// introduced also have daily shards named <table>_YYYYMMDD.
+var sinkTables = []string{"litmus_proxy_log", "litmus_core_log"}
+
+// logSinks are the log sinks exporting the proxy and core logs to BigQuery.
+var logSinks = []struct {
+	Name    string // Sink name
+	LogName string // Log the sink exports
+}{
+	{Name: "litmus-proxy-sink", LogName: "litmus-proxy-log"},
+	{Name: "litmus-core-sink", LogName: "litmus-core-log"},
+}
+
+// DeployAnalytics deploys Litmus analytics resources. If kmsKey is set, the
+// BigQuery dataset is encrypted with it. If logFilter is set, only log
+// entries that also match it are exported to BigQuery. If tableExpiration is
+// set, partitions of the exported tables are deleted once they're older.
+// labels are set on the dataset. With dryRun, the dataset, sinks and IAM
+// bindings are only printed.
+func DeployAnalytics(projectID, region, kmsKey, logFilter string, labels map[string]string, tableExpiration time.Duration, dryRun, quiet bool) error {
+	if kmsKey != "" {
+		if err := utils.ValidateKMSKey(kmsKey); err != nil {
+			return err
+		}
+	}
+	if logFilter != "" {
+		if err := ValidateLogFilter(logFilter); err != nil {
+			return err
+		}
+	}
+
+	if tableExpiration < 0 {
+		return fmt.Errorf("invalid table expiration %s", tableExpiration)
+	}
+
 	if projectID == "" {
 		var err error
 		projectID, err = utils.GetDefaultProjectID()
 		if err != nil {
-			utils.HandleGcloudError(err)
 			return err
 		}
 	}
 
 	if region == "" {
-		region = "us-central1" // Default region
+		region = utils.DefaultRegion
 	}
 
 	analytics := Analytics{
-		ProjectID:   projectID,
-		Region:      region,
-		BucketName:  fmt.Sprintf("%s-litmus-analytics", projectID),
-		DatasetName: "litmus_analytics",
+		ProjectID:       projectID,
+		Region:          region,
+		BucketName:      fmt.Sprintf("%s-litmus-analytics", projectID),
+		DatasetName:     DefaultDataset,
+		KMSKey:          kmsKey,
+		LogFilter:       logFilter,
+		TableExpiration: tableExpiration,
+		Labels:          labels,
+	}
+
+	if dryRun {
+		printPlan(analytics)
+		return nil
 	}
 
 	if !quiet {
 		// --- Confirm deployment ---
-		if !utils.ConfirmPrompt(fmt.Sprintf("\nThis will deploy Litmus analytics resources in project '%s' and region '%s'. Are you sure you want to continue?", analytics.ProjectID, analytics.Region)) {
+		confirmed, err := utils.ConfirmPrompt(fmt.Sprintf("\nThis will deploy Litmus analytics resources in project '%s' and region '%s'. Are you sure you want to continue?", analytics.ProjectID, analytics.Region))
+		if err != nil {
+			return err
+		}
+		if !confirmed {
 			fmt.Println("\nAborting deployment.")
 			return nil
 		}
@@ -78,16 +132,25 @@ func DeployAnalytics(projectID, region string, quiet bool) error {
 		return fmt.Errorf("error creating BigQuery dataset: %w", err)
 	}
 
-	time.Sleep(5 * time.Second)
+	// --- Label the dataset ---
+	if err := setDatasetLabels(analytics); err != nil {
+		return fmt.Errorf("error labeling BigQuery dataset: %w", err)
+	}
 
-	// --- Create log sink for proxy ---
-	if err := createLogSink(analytics, quiet, "litmus-proxy-sink", "litmus-proxy-log"); err != nil {
-		return fmt.Errorf("error creating log sink: %w", err)
+	// --- Expire old partitions ---
+	if analytics.TableExpiration > 0 {
+		if err := setPartitionExpiration(analytics, quiet); err != nil {
+			return fmt.Errorf("error setting table expiration: %w", err)
+		}
 	}
 
-	// --- Create log sink for api ---
-	if err := createLogSink(analytics, quiet, "litmus-core-sink", "litmus-core-log"); err != nil {
-		return fmt.Errorf("error creating log sink: %w", err)
+	time.Sleep(5 * time.Second)
+
+	// --- Create log sinks for proxy and api ---
+	for _, sink := range logSinks {
+		if err := createLogSink(analytics, quiet, sink.Name, sink.LogName); err != nil {
+			return fmt.Errorf("error creating log sink: %w", err)
+		}
 	}
 
 	if !quiet {
@@ -102,25 +165,28 @@ func DestroyAnalytics(projectID, region string, quiet bool) error {
 		var err error
 		projectID, err = utils.GetDefaultProjectID()
 		if err != nil {
-			utils.HandleGcloudError(err)
 			return err
 		}
 	}
 
 	if region == "" {
-		region = "us-central1" // Default region
+		region = utils.DefaultRegion
 	}
 
 	analytics := Analytics{
 		ProjectID:   projectID,
 		Region:      region,
 		BucketName:  fmt.Sprintf("%s-litmus-analytics", projectID),
-		DatasetName: "litmus_analytics",
+		DatasetName: DefaultDataset,
 	}
 
 	// // --- Confirm deletion ---
 	if !quiet {
-		if !utils.ConfirmPrompt(fmt.Sprintf("\nThis will delete Litmus analytics resources in project '%s' and region '%s'. Are you sure you want to continue?", analytics.ProjectID, analytics.Region)) {
+		confirmed, err := utils.ConfirmPrompt(fmt.Sprintf("\nThis will delete Litmus analytics resources in project '%s' and region '%s'. Are you sure you want to continue?", analytics.ProjectID, analytics.Region))
+		if err != nil {
+			return err
+		}
+		if !confirmed {
 			fmt.Println("\nAborting deletion.")
 			return nil
 		}
@@ -196,7 +262,7 @@ func DestroyAnalytics(projectID, region string, quiet bool) error {
 
 func createBigQueryDataset(a Analytics, quiet bool) error {
 	// Check if dataset already exists
-	cmd := exec.Command(
+	cmd := utils.Command(
 		"gcloud", "alpha", "bq", "datasets", "describe",
 		fmt.Sprintf("%s", a.DatasetName),
 		"--project", a.ProjectID,
@@ -210,13 +276,30 @@ func createBigQueryDataset(a Analytics, quiet bool) error {
 	}
 
 	// Dataset doesn't exist, proceed with creation
-	cmd = exec.Command(
+	cmd = utils.Command(
 		"gcloud", "alpha", "bq", "datasets", "create",
 		fmt.Sprintf("%s", a.DatasetName),
 		"--project", a.ProjectID,
 	)
+	if a.KMSKey != "" {
+		// gcloud cannot set a default KMS key on datasets, use the bq tool instead
+		cmd = utils.Command(
+			"bq", "--project_id", a.ProjectID,
+			"mk", "--dataset",
+			"--default_kms_key", a.KMSKey,
+			fmt.Sprintf("%s:%s", a.ProjectID, a.DatasetName),
+		)
+	}
 	output, err := cmd.CombinedOutput()
 	if err != nil {
+		// The dataset may have been created concurrently or by an earlier,
+		// interrupted run since the describe above, which is fine
+		if isAlreadyExists(string(output)) {
+			if !quiet {
+				fmt.Printf("BigQuery dataset '%s:%s' already exists, skipping creation.\n", a.ProjectID, a.DatasetName)
+			}
+			return nil
+		}
 		return fmt.Errorf("error creating BigQuery dataset: %w\nOutput: %s", err, output)
 	}
 
@@ -226,6 +309,62 @@ func createBigQueryDataset(a Analytics, quiet bool) error {
 	return nil
 }
 
+// setDatasetLabels sets the dataset's labels, on new and existing datasets.
+func setDatasetLabels(a Analytics) error {
+	cmd := utils.Command("bq", "--project_id", a.ProjectID, "update")
+	for _, label := range utils.ResourceLabels(a.Labels, "analytics") {
+		cmd.Args = append(cmd.Args, "--set_label", strings.Replace(label, "=", ":", 1))
+	}
+	cmd.Args = append(cmd.Args, fmt.Sprintf("%s:%s", a.ProjectID, a.DatasetName))
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("error updating dataset '%s': %w\nOutput: %s", a.DatasetName, err, output)
+	}
+	return nil
+}
+
+// setPartitionExpiration sets the dataset's default partition expiration,
+// which applies to the sink tables created from then on, and updates the
+// sink tables that already exist. Older daily shards are not affected.
+func setPartitionExpiration(a Analytics, quiet bool) error {
+	seconds := strconv.FormatInt(int64(a.TableExpiration.Seconds()), 10)
+	cmd := utils.Command(
+		"bq", "--project_id", a.ProjectID,
+		"update", "--default_partition_expiration", seconds,
+		fmt.Sprintf("%s:%s", a.ProjectID, a.DatasetName),
+	)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("error updating dataset '%s': %w\nOutput: %s", a.DatasetName, err, output)
+	}
+
+	for _, table := range sinkTables {
+		cmd := utils.Command(
+			"bq", "--project_id", a.ProjectID,
+			"update", "--time_partitioning_expiration", seconds,
+			fmt.Sprintf("%s:%s.%s", a.ProjectID, a.DatasetName, table),
+		)
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			// The sink creates the table when it exports its first entry
+			if strings.Contains(strings.ToLower(string(output)), "not found") {
+				continue
+			}
+			return fmt.Errorf("error updating table '%s': %w\nOutput: %s", table, err, output)
+		}
+	}
+
+	if !quiet {
+		fmt.Printf("Partitions in %s:%s expire after %s\n", a.ProjectID, a.DatasetName, a.TableExpiration)
+	}
+	return nil
+}
+
+// isAlreadyExists reports whether gcloud or bq output says the resource
+// being created already exists.
+func isAlreadyExists(output string) bool {
+	lower := strings.ToLower(output)
+	return strings.Contains(lower, "already exists") || strings.Contains(lower, "already_exists")
+}
+
 func waitForBigQueryDataset(a Analytics, quiet bool) error {
 	if quiet {
 		// If quiet mode, don't display the spinner
@@ -249,7 +388,7 @@ func waitForBigQueryDatasetQuiet(a Analytics) error {
 		case <-timeout:
 			return fmt.Errorf("timeout waiting for BigQuery dataset '%s' to be created", a.DatasetName)
 		case <-ticker.C:
-			cmd := exec.Command(
+			cmd := utils.Command(
 				"bq", "--project_id", a.ProjectID,
 				"show",
 				fmt.Sprintf("%s:%s", a.ProjectID, a.DatasetName),
@@ -264,13 +403,15 @@ func waitForBigQueryDatasetQuiet(a Analytics) error {
 
 func createLogSink(a Analytics, quiet bool, name string, filter string) error {
 	// Check if log sink exists
-	checkCmd := exec.Command( // Use a different variable name here
+	checkCmd := utils.Command( // Use a different variable name here
 		"gcloud", "logging", "sinks", "describe", name,
 		"--project", a.ProjectID,
 	)
 	_, err := checkCmd.CombinedOutput()
 
 	// --- Create/Update Log Sink ---
+	logFilter := sinkFilter(a, filter)
+
 	var cmd *exec.Cmd
 	if err == nil {
 		// Log sink exists, update it
@@ -278,20 +419,22 @@ func createLogSink(a Analytics, quiet bool, name string, filter string) error {
 			fmt.Println("Log sink 'litmus-proxy-sink' already exists, updating...")
 		}
 
-		cmd = exec.Command(
+		cmd = utils.Command(
 			"gcloud", "logging", "sinks", "update", name,
-			fmt.Sprintf("bigquery.googleapis.com/projects/%s/datasets/%s", a.ProjectID, a.DatasetName),
+			sinkDestination(a),
 			"--project", a.ProjectID,
-			"--log-filter", "logName=projects/"+a.ProjectID+"/logs/"+filter,
+			"--log-filter", logFilter,
+			"--use-partitioned-tables",
 		)
 
 	} else {
 		// Log sink doesn't exist, create it
-		cmd = exec.Command(
+		cmd = utils.Command(
 			"gcloud", "logging", "sinks", "create", name,
-			fmt.Sprintf("bigquery.googleapis.com/projects/%s/datasets/%s", a.ProjectID, a.DatasetName),
+			sinkDestination(a),
 			"--project", a.ProjectID,
-			"--log-filter", "logName=projects/"+a.ProjectID+"/logs/"+filter,
+			"--log-filter", logFilter,
+			"--use-partitioned-tables",
 		)
 	}
 
@@ -311,7 +454,7 @@ func createLogSink(a Analytics, quiet bool, name string, filter string) error {
 		return fmt.Errorf("unable to extract service account email from output: %s", output)
 	}
 
-	grantBigQueryDataEditorRole := exec.Command(
+	grantBigQueryDataEditorRole := utils.Command(
 		"gcloud", "projects", "add-iam-policy-binding", a.ProjectID,
 		"--member", fmt.Sprintf("serviceAccount:%s", serviceAccountEmail),
 		"--role", "roles/bigquery.dataEditor",
@@ -327,6 +470,66 @@ func createLogSink(a Analytics, quiet bool, name string, filter string) error {
 	return nil
 }
 
+// sinkFilter returns the filter of the sink exporting logName, narrowed by
+// the optional --log-filter.
+func sinkFilter(a Analytics, logName string) string {
+	filter := "logName=projects/" + a.ProjectID + "/logs/" + logName
+	if a.LogFilter != "" {
+		filter = fmt.Sprintf("%s AND (%s)", filter, a.LogFilter)
+	}
+	return filter
+}
+
+// sinkDestination returns the BigQuery destination of the log sinks.
+func sinkDestination(a Analytics) string {
+	return fmt.Sprintf("bigquery.googleapis.com/projects/%s/datasets/%s", a.ProjectID, a.DatasetName)
+}
+
+// printPlan prints what DeployAnalytics would create, update and grant,
+// checking which resources exist without changing anything.
+func printPlan(a Analytics) {
+	fmt.Printf("Dry run: analytics deploy in project '%s' and region '%s' would:\n", a.ProjectID, a.Region)
+
+	describeDataset := utils.Command("gcloud", "alpha", "bq", "datasets", "describe", a.DatasetName, "--project", a.ProjectID)
+	action := "create"
+	if describeDataset.Run() == nil {
+		action = "use existing"
+	}
+	fmt.Printf("\nBigQuery dataset:\n  %s dataset %s:%s\n", action, a.ProjectID, a.DatasetName)
+	if a.KMSKey != "" && action == "create" {
+		fmt.Printf("    Default KMS key: %s\n", a.KMSKey)
+	}
+	fmt.Printf("    Labels: %s\n", strings.Join(utils.ResourceLabels(a.Labels, "analytics"), ", "))
+	if a.TableExpiration > 0 {
+		fmt.Printf("    Partition expiration: %s (also set on %s)\n", a.TableExpiration, strings.Join(sinkTables, ", "))
+	}
+
+	var bindings []string
+	fmt.Println("\nLog sinks:")
+	for _, sink := range logSinks {
+		describeSink := utils.Command(
+			"gcloud", "logging", "sinks", "describe", sink.Name,
+			"--project", a.ProjectID,
+			"--format=value(writerIdentity)",
+		)
+		action, writer := "create", fmt.Sprintf("the writer identity of %s, assigned when it's created", sink.Name)
+		if output, err := describeSink.Output(); err == nil {
+			action = "update"
+			if identity := strings.TrimSpace(string(output)); identity != "" {
+				writer = identity
+			}
+		}
+		fmt.Printf("  %s sink %s\n", action, sink.Name)
+		fmt.Printf("    Destination: %s (partitioned tables)\n", sinkDestination(a))
+		fmt.Printf("    Filter: %s\n", sinkFilter(a, sink.LogName))
+		bindings = append(bindings, fmt.Sprintf("  roles/bigquery.dataEditor on project %s for %s", a.ProjectID, writer))
+	}
+
+	fmt.Println("\nIAM bindings:")
+	fmt.Println(strings.Join(bindings, "\n"))
+	fmt.Println("\nNothing was changed. Run without --dry-run to deploy.")
+}
+
 // func deleteLoggingBucket(a Analytics, quiet bool) error {
 // 	cmd := exec.Command(
 // 		"gcloud", "storage", "rm", "--recursive",
@@ -344,7 +547,7 @@ func createLogSink(a Analytics, quiet bool, name string, filter string) error {
 // }
 
 func deleteBigQueryDataset(a Analytics, quiet bool) error {
-	cmd := exec.Command(
+	cmd := utils.Command(
 		"gcloud", "alpha", "bq", "datasets", "delete",
 		fmt.Sprintf("%s", a.DatasetName),
 		"--project", a.ProjectID,
@@ -362,7 +565,7 @@ func deleteBigQueryDataset(a Analytics, quiet bool) error {
 }
 
 func deleteLogSink(a Analytics, quiet bool) error {
-	cmd := exec.Command(
+	cmd := utils.Command(
 		"gcloud", "logging", "sinks", "delete", "litmus-proxy-sink",
 		"--project", a.ProjectID,
 		"--quiet", // Assume quiet for deletion unless specified otherwise
@@ -378,6 +581,42 @@ func deleteLogSink(a Analytics, quiet bool) error {
 	return nil
 }
 
+// ValidateLogFilter performs basic checks on a Cloud Logging filter fragment:
+// it must be a single line with balanced parentheses and quotes. The full
+// syntax is checked by Cloud Logging when the sink is created.
+func ValidateLogFilter(logFilter string) error {
+	if strings.TrimSpace(logFilter) == "" {
+		return fmt.Errorf("invalid log filter: must not be empty")
+	}
+	if strings.ContainsAny(logFilter, "\r\n") {
+		return fmt.Errorf("invalid log filter '%s': must be a single line", logFilter)
+	}
+
+	depth, inQuotes := 0, false
+	for i := 0; i < len(logFilter); i++ {
+		switch c := logFilter[i]; {
+		case c == '\\' && inQuotes:
+			i++ // Skip the escaped character
+		case c == '"':
+			inQuotes = !inQuotes
+		case c == '(' && !inQuotes:
+			depth++
+		case c == ')' && !inQuotes:
+			depth--
+			if depth < 0 {
+				return fmt.Errorf("invalid log filter '%s': unbalanced parentheses", logFilter)
+			}
+		}
+	}
+	if inQuotes {
+		return fmt.Errorf("invalid log filter '%s': unterminated quote", logFilter)
+	}
+	if depth != 0 {
+		return fmt.Errorf("invalid log filter '%s': unbalanced parentheses", logFilter)
+	}
+	return nil
+}
+
 // Extracts the service account email from the gcloud output
 func extractServiceAccountEmail(output string) string {
 	start := strings.Index(output, "serviceAccount:")
@@ -0,0 +1,342 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package analytics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/logging/logadmin"
+	"github.com/briandowns/spinner"
+	"github.com/google/litmus/cli/logger"
+	"github.com/google/litmus/cli/utils"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// backfillTable is the table backfilled entries are written to. It lives
+// next to the sink tables but deliberately doesn't match their names or the
+// litmus_*_log_* wildcards of their older shards, since its schema differs.
+const backfillTable = "litmus_backfill"
+
+// backfillBatchSize is the number of rows inserted per streaming request.
+const backfillBatchSize = 500
+
+// backfillLogs are the logs exported by the analytics sinks.
+var backfillLogs = []string{"litmus-proxy-log", "litmus-core-log"}
+
+var backfillSchema = bigquery.Schema{
+	{Name: "insertId", Type: bigquery.StringFieldType, Required: true},
+	{Name: "requestId", Type: bigquery.StringFieldType},
+	{Name: "logName", Type: bigquery.StringFieldType},
+	{Name: "timestamp", Type: bigquery.TimestampFieldType},
+	{Name: "severity", Type: bigquery.StringFieldType},
+	{Name: "trace", Type: bigquery.StringFieldType},
+	{Name: "jsonPayload", Type: bigquery.JSONFieldType},
+	{Name: "textPayload", Type: bigquery.StringFieldType},
+}
+
+// backfillRow is a historical log entry as written to the backfill table.
+type backfillRow struct {
+	InsertID    string
+	RequestID   string // requestLog.ID for proxy entries
+	LogName     string
+	Timestamp   time.Time
+	Severity    string
+	Trace       string
+	JSONPayload string
+	TextPayload string
+}
+
+// Save implements bigquery.ValueSaver. The entry's insertId doubles as the
+// streaming insert ID, so a retried batch isn't inserted twice.
+func (r *backfillRow) Save() (map[string]bigquery.Value, string, error) {
+	row := map[string]bigquery.Value{
+		"insertId":  r.InsertID,
+		"logName":   r.LogName,
+		"timestamp": r.Timestamp,
+		"severity":  r.Severity,
+		"trace":     r.Trace,
+	}
+	if r.RequestID != "" {
+		row["requestId"] = r.RequestID
+	}
+	if r.JSONPayload != "" {
+		row["jsonPayload"] = r.JSONPayload
+	}
+	if r.TextPayload != "" {
+		row["textPayload"] = r.TextPayload
+	}
+	return row, r.InsertID, nil
+}
+
+// ParseSince parses a backfill window or table expiration. On top of
+// time.ParseDuration it accepts a whole number of days, such as "7d".
+func ParseSince(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return d, nil
+}
+
+// BackfillAnalytics copies the Litmus log entries written in the last
+// `since` from Cloud Logging into BigQuery. Log sinks only export entries
+// written after they're created, so this fills the gap for proxies that ran
+// before analytics was deployed. Entries already exported by the sinks or an
+// earlier backfill are skipped, matched on their insertId or requestLog.ID.
+func BackfillAnalytics(projectID string, since time.Duration, quiet bool) error {
+	if projectID == "" {
+		var err error
+		projectID, err = utils.GetDefaultProjectID()
+		if err != nil {
+			return err
+		}
+	}
+
+	a := Analytics{
+		ProjectID:   projectID,
+		DatasetName: DefaultDataset,
+	}
+	start := time.Now().Add(-since).UTC()
+
+	if !quiet {
+		fmt.Printf("\nBackfilling Litmus logs since %s...\n", start.Format(time.RFC3339))
+		s := spinner.New(spinner.CharSets[14], 100*time.Millisecond)
+		s.Start()
+		defer s.Stop()
+	}
+
+	ctx := context.Background()
+	bq, err := bigquery.NewClient(ctx, a.ProjectID)
+	if err != nil {
+		return fmt.Errorf("error creating BigQuery client: %w", err)
+	}
+	defer bq.Close()
+
+	dataset := bq.Dataset(a.DatasetName)
+	if _, err := dataset.Metadata(ctx); err != nil {
+		if isNotFound(err) {
+			return fmt.Errorf("BigQuery dataset '%s:%s' not found, run 'litmus analytics deploy' first", a.ProjectID, a.DatasetName)
+		}
+		return fmt.Errorf("error reading BigQuery dataset: %w", err)
+	}
+
+	table := dataset.Table(backfillTable)
+	if err := ensureBackfillTable(ctx, table); err != nil {
+		return err
+	}
+
+	seen, err := exportedIDs(ctx, bq, a, start)
+	if err != nil {
+		return fmt.Errorf("error reading exported log entries: %w", err)
+	}
+
+	logs, err := logadmin.NewClient(ctx, a.ProjectID)
+	if err != nil {
+		return fmt.Errorf("error creating Cloud Logging client: %w", err)
+	}
+	defer logs.Close()
+
+	inserter := table.Inserter()
+	var batch []*backfillRow
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := inserter.Put(ctx, batch); err != nil {
+			return fmt.Errorf("error inserting rows into %s: %w", backfillTable, err)
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	inserted, skipped := 0, 0
+	for _, logID := range backfillLogs {
+		filter := fmt.Sprintf(`logName="projects/%s/logs/%s" AND timestamp>="%s"`, a.ProjectID, logID, start.Format(time.RFC3339))
+		it := logs.Entries(ctx, logadmin.Filter(filter), logadmin.PageSize(1000))
+		for {
+			entry, err := it.Next()
+			if err == iterator.Done {
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("error reading %s entries: %w", logID, err)
+			}
+
+			row, err := newBackfillRow(entry.InsertID, entry.LogName, entry.Timestamp, entry.Severity.String(), entry.Trace, entry.Payload)
+			if err != nil {
+				logger.Warnf("Skipping %s entry %s: %v", logID, entry.InsertID, err)
+				continue
+			}
+			if seen[row.InsertID] || (row.RequestID != "" && seen[row.RequestID]) {
+				skipped++
+				continue
+			}
+			seen[row.InsertID] = true
+			if row.RequestID != "" {
+				seen[row.RequestID] = true
+			}
+
+			batch = append(batch, row)
+			if len(batch) >= backfillBatchSize {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+			inserted++
+		}
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	if !quiet {
+		fmt.Printf("Done! Backfilled %d log entries into %s:%s.%s (%d already exported).\n", inserted, a.ProjectID, a.DatasetName, backfillTable, skipped)
+	}
+	return nil
+}
+
+// newBackfillRow converts a log entry to a row, keeping JSON payloads as
+// JSON and pulling out the proxy's requestLog.ID for deduplication.
+func newBackfillRow(insertID, logName string, timestamp time.Time, severity, trace string, payload interface{}) (*backfillRow, error) {
+	if insertID == "" {
+		return nil, errors.New("entry has no insertId")
+	}
+	row := &backfillRow{
+		InsertID:  insertID,
+		LogName:   logName,
+		Timestamp: timestamp,
+		Severity:  severity,
+		Trace:     trace,
+	}
+	switch p := payload.(type) {
+	case *structpb.Struct:
+		data, err := protojson.Marshal(p)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding payload: %w", err)
+		}
+		row.JSONPayload = string(data)
+		if id, ok := p.GetFields()["id"]; ok {
+			row.RequestID = id.GetStringValue()
+		}
+	case string:
+		row.TextPayload = p
+	case nil:
+	default:
+		return nil, fmt.Errorf("unsupported payload type %T", payload)
+	}
+	return row, nil
+}
+
+// ensureBackfillTable creates the backfill table if it doesn't exist yet.
+func ensureBackfillTable(ctx context.Context, table *bigquery.Table) error {
+	if _, err := table.Metadata(ctx); err == nil {
+		return nil
+	} else if !isNotFound(err) {
+		return fmt.Errorf("error reading table %s: %w", backfillTable, err)
+	}
+
+	meta := &bigquery.TableMetadata{
+		Schema: backfillSchema,
+		TimePartitioning: &bigquery.TimePartitioning{
+			Type:  bigquery.DayPartitioningType,
+			Field: "timestamp",
+		},
+	}
+	if err := table.Create(ctx, meta); err != nil && !isAlreadyExists(err.Error()) {
+		return fmt.Errorf("error creating table %s: %w", backfillTable, err)
+	}
+	return nil
+}
+
+// exportedIDs returns the insertIds and request IDs of the entries since
+// start that are already in BigQuery, either exported by a sink or copied
+// by an earlier backfill.
+func exportedIDs(ctx context.Context, bq *bigquery.Client, a Analytics, start time.Time) (map[string]bool, error) {
+	dataset := fmt.Sprintf("`%s.%s", a.ProjectID, a.DatasetName)
+	queries := []string{
+		// Sink tables are partitioned by day and named after the log
+		"SELECT insertId, IFNULL(jsonPayload.id, '') FROM " + dataset + ".litmus_proxy_log` WHERE timestamp >= @start",
+		"SELECT insertId FROM " + dataset + ".litmus_core_log` WHERE timestamp >= @start",
+		// Older sinks wrote daily shards instead
+		"SELECT insertId, IFNULL(jsonPayload.id, '') FROM " + dataset + ".litmus_proxy_log_*` WHERE timestamp >= @start",
+		"SELECT insertId FROM " + dataset + ".litmus_core_log_*` WHERE timestamp >= @start",
+	}
+
+	seen := make(map[string]bool)
+	for _, query := range queries {
+		q := bq.Query(query)
+		q.Parameters = []bigquery.QueryParameter{{Name: "start", Value: start}}
+		if err := collectIDs(ctx, q, seen); err != nil {
+			// Nothing has been exported by this sink yet
+			if isNotFound(err) || strings.Contains(err.Error(), "does not match any table") {
+				continue
+			}
+			return nil, err
+		}
+	}
+
+	q := bq.Query("SELECT insertId, IFNULL(requestId, '') FROM " + dataset + "." + backfillTable + "` WHERE timestamp >= @start")
+	q.Parameters = []bigquery.QueryParameter{{Name: "start", Value: start}}
+	if err := collectIDs(ctx, q, seen); err != nil {
+		return nil, err
+	}
+	return seen, nil
+}
+
+// collectIDs adds every non-empty string column of the query's rows to seen.
+func collectIDs(ctx context.Context, q *bigquery.Query, seen map[string]bool) error {
+	it, err := q.Read(ctx)
+	if err != nil {
+		return err
+	}
+	for {
+		var values []bigquery.Value
+		err := it.Next(&values)
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, v := range values {
+			if id, ok := v.(string); ok && id != "" {
+				seen[id] = true
+			}
+		}
+	}
+}
+
+// isNotFound reports whether a BigQuery API error is a 404.
+func isNotFound(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound
+}
@@ -0,0 +1,246 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package analytics
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+)
+
+// logEntrySchema are the columns a log sink writes for every entry,
+// following the Cloud Logging LogEntry. resource.labels only lists the
+// labels of Cloud Run services.
+var logEntrySchema = bigquery.Schema{
+	{Name: "logName", Type: bigquery.StringFieldType},
+	{Name: "resource", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+		{Name: "type", Type: bigquery.StringFieldType},
+		{Name: "labels", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+			{Name: "project_id", Type: bigquery.StringFieldType},
+			{Name: "service_name", Type: bigquery.StringFieldType},
+			{Name: "revision_name", Type: bigquery.StringFieldType},
+			{Name: "configuration_name", Type: bigquery.StringFieldType},
+			{Name: "location", Type: bigquery.StringFieldType},
+		}},
+	}},
+	{Name: "textPayload", Type: bigquery.StringFieldType},
+	{Name: "timestamp", Type: bigquery.TimestampFieldType},
+	{Name: "receiveTimestamp", Type: bigquery.TimestampFieldType},
+	{Name: "severity", Type: bigquery.StringFieldType},
+	{Name: "insertId", Type: bigquery.StringFieldType},
+	{Name: "trace", Type: bigquery.StringFieldType},
+	{Name: "spanId", Type: bigquery.StringFieldType},
+	{Name: "traceSampled", Type: bigquery.BooleanFieldType},
+}
+
+// proxyPayloadSchema mirrors the proxy's requestLog as exported by a sink:
+// field names are lower-cased and JSON numbers become FLOAT columns. The
+// headers, query parameters and bodies have arbitrary fields, so the sink
+// adds those columns as it sees them.
+var proxyPayloadSchema = bigquery.Schema{
+	{Name: "id", Type: bigquery.StringFieldType},
+	{Name: "tracingid", Type: bigquery.StringFieldType},
+	{Name: "litmuscontext", Type: bigquery.StringFieldType},
+	{Name: "timestamp", Type: bigquery.TimestampFieldType},
+	{Name: "method", Type: bigquery.StringFieldType},
+	{Name: "requesturi", Type: bigquery.StringFieldType},
+	{Name: "upstreamurl", Type: bigquery.StringFieldType},
+	{Name: "upstreampath", Type: bigquery.StringFieldType},
+	{Name: "requestbodyuri", Type: bigquery.StringFieldType},
+	{Name: "requestsize", Type: bigquery.FloatFieldType},
+	{Name: "responsestatus", Type: bigquery.FloatFieldType},
+	{Name: "responsebodyuri", Type: bigquery.StringFieldType},
+	{Name: "responsesize", Type: bigquery.FloatFieldType},
+	{Name: "latency", Type: bigquery.FloatFieldType},
+	{Name: "upstreamlatency", Type: bigquery.FloatFieldType},
+	{Name: "proxyoverhead", Type: bigquery.FloatFieldType},
+	{Name: "upgrade", Type: bigquery.StringFieldType},
+}
+
+// schemaTable is a table in the exported schema.
+type schemaTable struct {
+	Name   string
+	Schema bigquery.Schema
+}
+
+// schemaView is a view in the exported schema. Its query refers to the
+// dataset as {dataset}.
+type schemaView struct {
+	Name  string
+	Query string
+}
+
+// schemaTables returns the tables analytics writes to.
+func schemaTables() []schemaTable {
+	proxySchema := append(bigquery.Schema{}, logEntrySchema...)
+	proxySchema = append(proxySchema, &bigquery.FieldSchema{Name: "jsonPayload", Type: bigquery.RecordFieldType, Schema: proxyPayloadSchema})
+	return []schemaTable{
+		{Name: "litmus_proxy_log", Schema: proxySchema},
+		// The core log's jsonPayload varies, the sink adds it on first write
+		{Name: "litmus_core_log", Schema: logEntrySchema},
+		{Name: backfillTable, Schema: backfillSchema},
+	}
+}
+
+// schemaViews are optional views over the analytics tables.
+var schemaViews = []schemaView{
+	{
+		// One row per proxied request, with the columns the UI reports on
+		Name: "litmus_proxy_requests",
+		Query: `SELECT
+  jsonPayload.id AS id,
+  jsonPayload.litmuscontext AS litmus_context,
+  timestamp,
+  jsonPayload.method AS method,
+  jsonPayload.requesturi AS request_uri,
+  jsonPayload.upstreamurl AS upstream_url,
+  jsonPayload.upstreampath AS upstream_path,
+  CAST(jsonPayload.responsestatus AS INT64) AS response_status,
+  CAST(jsonPayload.latency AS INT64) AS latency_ms,
+  CAST(jsonPayload.upstreamlatency AS INT64) AS upstream_latency_ms,
+  CAST(jsonPayload.requestsize AS INT64) AS request_size,
+  CAST(jsonPayload.responsesize AS INT64) AS response_size
+FROM ` + "`{dataset}.litmus_proxy_log`",
+	},
+}
+
+// ExportSchema prints the BigQuery tables and views Litmus analytics uses,
+// as JSON or as DDL, without touching any project. dataset is the dataset
+// the DDL creates objects in, qualified with projectID if it's set. With
+// tableExpiration, the DDL expires partitions like analytics deploy does.
+func ExportSchema(projectID, dataset string, tableExpiration time.Duration, asJSON bool) error {
+	if dataset == "" {
+		dataset = DefaultDataset
+	}
+	qualified := dataset
+	if projectID != "" {
+		qualified = projectID + "." + dataset
+	}
+
+	if asJSON {
+		return printSchemaJSON(qualified, tableExpiration)
+	}
+	fmt.Print(schemaDDL(qualified, tableExpiration))
+	return nil
+}
+
+// printSchemaJSON prints the tables in the JSON schema format used by the bq
+// tool and Terraform, together with their partitioning and the views.
+func printSchemaJSON(dataset string, tableExpiration time.Duration) error {
+	type partitioning struct {
+		Type         string `json:"type"`
+		Field        string `json:"field"`
+		ExpirationMs int64  `json:"expirationMs,omitempty,string"`
+	}
+	type table struct {
+		Name             string          `json:"name"`
+		TimePartitioning partitioning    `json:"timePartitioning"`
+		Schema           json.RawMessage `json:"schema"`
+	}
+	type view struct {
+		Name  string `json:"name"`
+		Query string `json:"query"`
+	}
+	var output struct {
+		Dataset string  `json:"dataset"`
+		Tables  []table `json:"tables"`
+		Views   []view  `json:"views"`
+	}
+
+	output.Dataset = dataset
+	for _, t := range schemaTables() {
+		fields, err := t.Schema.ToJSONFields()
+		if err != nil {
+			return fmt.Errorf("error encoding schema of %s: %w", t.Name, err)
+		}
+		output.Tables = append(output.Tables, table{
+			Name:             t.Name,
+			TimePartitioning: partitioning{Type: "DAY", Field: "timestamp", ExpirationMs: tableExpiration.Milliseconds()},
+			Schema:           fields,
+		})
+	}
+	for _, v := range schemaViews {
+		output.Views = append(output.Views, view{Name: v.Name, Query: strings.ReplaceAll(v.Query, "{dataset}", dataset)})
+	}
+
+	data, err := json.MarshalIndent(output, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding schema: %w", err)
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+// schemaDDL returns CREATE statements for the tables and views.
+func schemaDDL(dataset string, tableExpiration time.Duration) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "CREATE SCHEMA IF NOT EXISTS `%s`;\n", dataset)
+	for _, t := range schemaTables() {
+		fmt.Fprintf(&b, "\nCREATE TABLE IF NOT EXISTS `%s.%s` (\n", dataset, t.Name)
+		writeColumnsDDL(&b, t.Schema, "  ")
+		b.WriteString(")\nPARTITION BY DATE(timestamp)")
+		if tableExpiration > 0 {
+			// Partition expiration is set in whole days in DDL
+			days := max(1, int64(tableExpiration.Round(24*time.Hour)/(24*time.Hour)))
+			fmt.Fprintf(&b, "\nOPTIONS (partition_expiration_days = %d)", days)
+		}
+		b.WriteString(";\n")
+	}
+	for _, v := range schemaViews {
+		fmt.Fprintf(&b, "\nCREATE OR REPLACE VIEW `%s.%s` AS\n%s;\n", dataset, v.Name, strings.ReplaceAll(v.Query, "{dataset}", dataset))
+	}
+	return b.String()
+}
+
+// writeColumnsDDL writes a column definition per field, with nested STRUCTs
+// for records.
+func writeColumnsDDL(b *strings.Builder, schema bigquery.Schema, indent string) {
+	for i, field := range schema {
+		fmt.Fprintf(b, "%s%s %s", indent, field.Name, columnTypeDDL(field, indent))
+		if field.Required {
+			b.WriteString(" NOT NULL")
+		}
+		if i < len(schema)-1 {
+			b.WriteString(",")
+		}
+		b.WriteString("\n")
+	}
+}
+
+// columnTypeDDL returns the GoogleSQL type of a field.
+func columnTypeDDL(field *bigquery.FieldSchema, indent string) string {
+	var typ string
+	switch field.Type {
+	case bigquery.RecordFieldType:
+		var nested strings.Builder
+		writeColumnsDDL(&nested, field.Schema, indent+"  ")
+		typ = "STRUCT<\n" + nested.String() + indent + ">"
+	case bigquery.FloatFieldType:
+		typ = "FLOAT64"
+	case bigquery.IntegerFieldType:
+		typ = "INT64"
+	case bigquery.BooleanFieldType:
+		typ = "BOOL"
+	default:
+		typ = string(field.Type)
+	}
+	if field.Repeated {
+		typ = "ARRAY<" + typ + ">"
+	}
+	return typ
+}
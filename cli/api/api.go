@@ -16,46 +16,52 @@ package api
 
 // RunInfo holds information about a Litmus run.
 type RunInfo struct {
-	EndTime   string `json:"end_time"`
-	Progress  string `json:"progress"`
-	RunID     string `json:"run_id"`
-	StartTime string `json:"start_time"`
-	Status    string `json:"status"`
+	EndTime    string `json:"end_time"`
+	Progress   string `json:"progress"`
+	RunID      string `json:"run_id"`
+	StartTime  string `json:"start_time"`
+	Status     string `json:"status"`
 	TemplateID string `json:"template_id"`
-    URL       string `json:"url"` // Add the URL field
+	URL        string `json:"url"` // Add the URL field
 }
 
 // Structs to represent the JSON response
 type RunDetails struct {
-	Progress            string        `json:"progress"`
-	Status              string        `json:"status"`
-	TemplateID         string        `json:"template_id"`
-	TemplateInputField  string        `json:"template_input_field"`
-	TemplateOutputField string        `json:"template_output_field"`
+	Progress            string     `json:"progress"`
+	Status              string     `json:"status"`
+	TemplateID          string     `json:"template_id"`
+	TemplateInputField  string     `json:"template_input_field"`
+	TemplateOutputField string     `json:"template_output_field"`
 	TestCases           []TestCase `json:"testCases"`
 }
 
 type TestCase struct {
 	GoldenResponse string   `json:"golden_response"`
-	ID            string   `json:"id"`
-	Request       Request `json:"request"`
-	Response      Response `json:"response"`
-	TracingID     string   `json:"tracing_id"`
+	ID             string   `json:"id"`
+	Request        Request  `json:"request"`
+	Response       Response `json:"response"`
+	TracingID      string   `json:"tracing_id"`
 }
 
 type Request struct {
-	Body    interface{} `json:"body"` // Can be more specific if needed
+	Body    interface{} `json:"body"`    // Can be more specific if needed
 	Headers interface{} `json:"headers"` // Can be more specific if needed
 	Method  string      `json:"method"`
 	URL     string      `json:"url"`
 }
 
 type Response struct {
-	Note     string     `json:"note"`
+	Note     string       `json:"note"`
 	Response ResponseData `json:"response"`
-	Status   string     `json:"status"`
+	Status   string       `json:"status"`
 }
 type ResponseData struct {
 	Error  string `json:"error"`
 	Status string `json:"status"`
-}
\ No newline at end of file
+}
+
+// TemplateInfo holds summary information about a Litmus test template.
+type TemplateInfo struct {
+	TemplateID   string `json:"template_id"`
+	TemplateType string `json:"template_type"`
+}
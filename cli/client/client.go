@@ -0,0 +1,225 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package client is a client for the Litmus API.
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/litmus/cli/api"
+	"github.com/google/litmus/cli/utils"
+)
+
+// defaultTimeout bounds each API request.
+const defaultTimeout = 30 * time.Second
+
+// Client sends authenticated requests to a Litmus deployment.
+type Client struct {
+	serviceURL string
+	username   string
+	password   string
+	httpClient *http.Client
+}
+
+// New returns a Client for the Litmus API at serviceURL using basic auth.
+func New(serviceURL, username, password string) *Client {
+	return &Client{
+		serviceURL: strings.TrimSuffix(serviceURL, "/"),
+		username:   username,
+		password:   password,
+		httpClient: &http.Client{Timeout: defaultTimeout},
+	}
+}
+
+// ServiceURL returns the base URL of the Litmus API.
+func (c *Client) ServiceURL() string {
+	return c.serviceURL
+}
+
+// RunFilter selects the runs returned by ListRuns. Zero fields match all runs.
+type RunFilter struct {
+	Status     string    // Run status, such as "Completed" (case-insensitive)
+	TemplateID string    // Template the run was started from
+	Since      time.Time // Only runs started at or after this time
+}
+
+// query returns the filter as query parameters for GET /runs/.
+func (f RunFilter) query() url.Values {
+	params := url.Values{}
+	if f.Status != "" {
+		params.Set("status", canonicalStatus(f.Status))
+	}
+	if f.TemplateID != "" {
+		params.Set("template_id", f.TemplateID)
+	}
+	if !f.Since.IsZero() {
+		params.Set("since", f.Since.UTC().Format(time.RFC3339))
+	}
+	return params
+}
+
+// canonicalStatus capitalizes each word of status the way the API stores run
+// statuses, such as "Not Started", since the API matches them exactly.
+func canonicalStatus(status string) string {
+	words := strings.Fields(strings.ToLower(status))
+	for i, word := range words {
+		words[i] = strings.ToUpper(word[:1]) + word[1:]
+	}
+	return strings.Join(words, " ")
+}
+
+// matches reports whether run is selected by the filter.
+func (f RunFilter) matches(run api.RunInfo) bool {
+	if f.Status != "" && !strings.EqualFold(run.Status, f.Status) {
+		return false
+	}
+	if f.TemplateID != "" && run.TemplateID != f.TemplateID {
+		return false
+	}
+	if !f.Since.IsZero() {
+		started, err := http.ParseTime(run.StartTime)
+		if err != nil || started.Before(f.Since) {
+			return false
+		}
+	}
+	return true
+}
+
+// ListRuns returns the runs selected by filter. The API filters runs itself
+// and reports the filters it applied; older deployments ignore the
+// parameters and return every run, which are then filtered here.
+func (c *Client) ListRuns(filter RunFilter) ([]api.RunInfo, error) {
+	var response struct {
+		Runs    []api.RunInfo     `json:"runs"`
+		Filters map[string]string `json:"filters"` // Filters applied by the API
+	}
+	path := "/runs/"
+	params := filter.query()
+	if len(params) > 0 {
+		path += "?" + params.Encode()
+	}
+	if err := c.getJSON(path, "", &response); err != nil {
+		return nil, err
+	}
+	if len(params) == 0 || response.Filters != nil {
+		return response.Runs, nil
+	}
+
+	runs := make([]api.RunInfo, 0, len(response.Runs))
+	for _, run := range response.Runs {
+		if filter.matches(run) {
+			runs = append(runs, run)
+		}
+	}
+	return runs, nil
+}
+
+// GetRun returns the status and test cases of a run.
+func (c *Client) GetRun(runID string) (*api.RunDetails, error) {
+	var details api.RunDetails
+	if err := c.getJSON("/runs/status/"+url.PathEscape(runID), runResource(runID), &details); err != nil {
+		return nil, err
+	}
+	return &details, nil
+}
+
+// SubmitRun starts a run of templateID with the template's defaults.
+// authToken is passed on to the tested endpoint when set.
+func (c *Client) SubmitRun(templateID, runID, authToken string) error {
+	payload := map[string]interface{}{
+		"run_id":      runID,
+		"template_id": templateID,
+	}
+	// Add authToken to payload only if it's set
+	if authToken != "" {
+		payload["auth_token"] = authToken
+	}
+
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error marshaling JSON payload: %w", err)
+	}
+	_, err = c.do("POST", "/runs/submit_simple", payloadJSON, fmt.Sprintf("template '%s'", templateID))
+	return err
+}
+
+// Cancel stops a run by deleting it together with its test cases. The API
+// has no separate cancel operation.
+func (c *Client) Cancel(runID string) error {
+	_, err := c.do("DELETE", "/runs/"+url.PathEscape(runID), nil, runResource(runID))
+	return err
+}
+
+// runResource describes a run in APIErrors.
+func runResource(runID string) string {
+	return fmt.Sprintf("run '%s'", runID)
+}
+
+// Do sends a request to path and returns the response body. A non-nil
+// payload is sent as JSON. Unexpected status codes are returned as an
+// *APIError, classified with utils.HTTPStatusError.
+func (c *Client) Do(method, path string, payload []byte) ([]byte, error) {
+	return c.do(method, path, payload, "")
+}
+
+// do implements Do, naming resource in returned APIErrors.
+func (c *Client) do(method, path string, payload []byte, resource string) ([]byte, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequest(method, c.serviceURL+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.SetBasicAuth(c.username, c.password)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error making request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response body: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, utils.HTTPStatusError(resp.StatusCode, parseAPIError(resp.StatusCode, respBody, resource))
+	}
+	return respBody, nil
+}
+
+// getJSON sends a GET request to path and decodes the JSON response into v.
+func (c *Client) getJSON(path, resource string, v interface{}) error {
+	body, err := c.do("GET", path, nil, resource)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("error decoding response: %w", err)
+	}
+	return nil
+}
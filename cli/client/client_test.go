@@ -0,0 +1,191 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/litmus/cli/utils"
+)
+
+// newTestServer returns a Client for a server that requires admin/secret and
+// serves handler.
+func newTestServer(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "admin" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return New(server.URL+"/", "admin", "secret")
+}
+
+func TestListRuns(t *testing.T) {
+	c := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" || r.URL.Path != "/runs/" {
+			t.Errorf("request = %s %s, want GET /runs/", r.Method, r.URL.Path)
+		}
+		io.WriteString(w, `{"runs":[{"run_id":"r1","status":"Completed"}]}`)
+	})
+
+	runs, err := c.ListRuns(RunFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 || runs[0].RunID != "r1" || runs[0].Status != "Completed" {
+		t.Errorf("runs = %+v, want one completed run r1", runs)
+	}
+}
+
+func TestListRunsServerSideFilter(t *testing.T) {
+	c := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("status") != "Not Started" || q.Get("template_id") != "t1" || q.Get("since") != "2024-10-01T00:00:00Z" {
+			t.Errorf("query = %s, want status, template_id and since", r.URL.RawQuery)
+		}
+		// The API already filtered, so the client must not filter again
+		io.WriteString(w, `{"runs":[{"run_id":"r1","status":"Completed"}],"filters":{"status":"Not Started"}}`)
+	})
+
+	runs, err := c.ListRuns(RunFilter{
+		Status:     "not started",
+		TemplateID: "t1",
+		Since:      time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 || runs[0].RunID != "r1" {
+		t.Errorf("runs = %+v, want the server's run r1", runs)
+	}
+}
+
+func TestListRunsClientSideFallback(t *testing.T) {
+	c := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"runs":[
+			{"run_id":"r1","status":"Completed","template_id":"t1","start_time":"Tue, 01 Oct 2024 10:00:00 GMT"},
+			{"run_id":"r2","status":"Failed","template_id":"t1","start_time":"Wed, 02 Oct 2024 10:00:00 GMT"},
+			{"run_id":"r3","status":"completed","template_id":"t1","start_time":"Thu, 03 Oct 2024 10:00:00 GMT"},
+			{"run_id":"r4","status":"Completed","template_id":"t2","start_time":"Thu, 03 Oct 2024 10:00:00 GMT"}
+		]}`)
+	})
+
+	runs, err := c.ListRuns(RunFilter{
+		Status:     "Completed",
+		TemplateID: "t1",
+		Since:      time.Date(2024, 10, 2, 0, 0, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 || runs[0].RunID != "r3" {
+		t.Errorf("runs = %+v, want only r3", runs)
+	}
+}
+
+func TestGetRun(t *testing.T) {
+	c := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/runs/status/r1" {
+			t.Errorf("path = %s, want /runs/status/r1", r.URL.Path)
+		}
+		io.WriteString(w, `{"status":"Running","progress":"1/2","testCases":[{"id":"c1"}]}`)
+	})
+
+	run, err := c.GetRun("r1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Status != "Running" || run.Progress != "1/2" || len(run.TestCases) != 1 {
+		t.Errorf("run = %+v, want a running run with one test case", run)
+	}
+}
+
+func TestSubmitRun(t *testing.T) {
+	c := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/runs/submit_simple" {
+			t.Errorf("request = %s %s, want POST /runs/submit_simple", r.Method, r.URL.Path)
+		}
+		var payload map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Fatal(err)
+		}
+		if payload["template_id"] != "t1" || payload["run_id"] != "r1" || payload["auth_token"] != "token" {
+			t.Errorf("payload = %v", payload)
+		}
+		io.WriteString(w, `{"message":"ok"}`)
+	})
+
+	if err := c.SubmitRun("t1", "r1", "token"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	c := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "DELETE" || r.URL.Path != "/runs/r1" {
+			t.Errorf("request = %s %s, want DELETE /runs/r1", r.Method, r.URL.Path)
+		}
+	})
+
+	if err := c.Cancel("r1"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUnauthorizedIsAuthError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	_, err := New(server.URL, "admin", "wrong").ListRuns(RunFilter{})
+	if !IsUnauthorized(err) {
+		t.Errorf("IsUnauthorized(%v) = false, want true", err)
+	}
+	if code := utils.ExitCode(err); code != utils.ExitAuthError {
+		t.Errorf("ExitCode(%v) = %d, want %d", err, code, utils.ExitAuthError)
+	}
+}
+
+func TestAPIError(t *testing.T) {
+	c := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, `{"error":"Run with ID 'r1' not found"}`)
+	})
+
+	_, err := c.GetRun("r1")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("GetRun error = %v, want an *APIError", err)
+	}
+	if apiErr.Status != http.StatusNotFound || apiErr.Code != "not_found" || apiErr.Message != "Run with ID 'r1' not found" || apiErr.Resource != "run 'r1'" {
+		t.Errorf("APIError = %+v", apiErr)
+	}
+	if !IsNotFound(err) || IsUnauthorized(err) {
+		t.Errorf("IsNotFound = %v, IsUnauthorized = %v, want true, false", IsNotFound(err), IsUnauthorized(err))
+	}
+	if code := utils.ExitCode(err); code != utils.ExitUserError {
+		t.Errorf("ExitCode = %d, want %d", code, utils.ExitUserError)
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// APIError is a non-200 response from the Litmus API.
+type APIError struct {
+	Status   int    // HTTP status code
+	Code     string // Machine-readable code, e.g. "not_found"
+	Message  string // Message returned by the API
+	Resource string // The run or template the request was about, if any
+}
+
+func (e *APIError) Error() string {
+	message := e.Message
+	if message == "" {
+		message = http.StatusText(e.Status)
+	}
+	if e.Resource != "" {
+		return fmt.Sprintf("%s (%s, HTTP %d)", message, e.Resource, e.Status)
+	}
+	return fmt.Sprintf("%s (HTTP %d)", message, e.Status)
+}
+
+// IsNotFound reports whether err is an APIError with status 404.
+func IsNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound)
+}
+
+// IsUnauthorized reports whether err is an APIError with status 401 or 403.
+func IsUnauthorized(err error) bool {
+	return hasStatus(err, http.StatusUnauthorized) || hasStatus(err, http.StatusForbidden)
+}
+
+func hasStatus(err error, status int) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.Status == status
+}
+
+// parseAPIError builds an APIError from a response. The API answers errors
+// with {"error": "..."}; other bodies (e.g. the plain-text 401 of the auth
+// layer) are used as the message verbatim.
+func parseAPIError(status int, body []byte, resource string) *APIError {
+	apiErr := &APIError{
+		Status:   status,
+		Code:     statusCode(status),
+		Resource: resource,
+	}
+
+	var response struct {
+		Error   string `json:"error"`
+		Message string `json:"message"`
+		Code    string `json:"code"`
+	}
+	if err := json.Unmarshal(body, &response); err == nil {
+		apiErr.Message = response.Error
+		if apiErr.Message == "" {
+			apiErr.Message = response.Message
+		}
+		if response.Code != "" {
+			apiErr.Code = response.Code
+		}
+	} else if text := strings.TrimSpace(string(body)); text != "" && !strings.HasPrefix(text, "<") {
+		apiErr.Message = text // Skip HTML error pages
+	}
+	return apiErr
+}
+
+// statusCode returns the Code of an APIError with the given HTTP status.
+func statusCode(status int) string {
+	switch {
+	case status == http.StatusBadRequest:
+		return "bad_request"
+	case status == http.StatusUnauthorized:
+		return "unauthorized"
+	case status == http.StatusForbidden:
+		return "forbidden"
+	case status == http.StatusNotFound:
+		return "not_found"
+	case status == http.StatusConflict:
+		return "conflict"
+	case status == http.StatusTooManyRequests:
+		return "rate_limited"
+	case status >= 500:
+		return "server_error"
+	default:
+		return "unexpected_status"
+	}
+}
@@ -15,28 +15,304 @@
 package cmd
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
-	"os/exec"
+	"net/http"
+	"regexp"
 	"strings"
 	"time"
 
-	"github.com/briandowns/spinner"
 	"github.com/google/litmus/cli/analytics"
+	"github.com/google/litmus/cli/logger"
 	"github.com/google/litmus/cli/utils"
 )
 
+// SecretEnvVar maps an environment variable to a Secret Manager secret.
+type SecretEnvVar struct {
+	Name    string // Environment variable name
+	Secret  string // Secret Manager secret ID
+	Version string // Secret version, defaults to "latest"
+	Value   string // Optional value to store in the secret before deploying
+}
+
+// ParseSecretEnvVar parses a --set-secret value of the form
+// NAME=SECRET[:VERSION][=VALUE].
+func ParseSecretEnvVar(spec string) (SecretEnvVar, error) {
+	name, rest, ok := strings.Cut(spec, "=")
+	if !ok || name == "" || rest == "" {
+		return SecretEnvVar{}, fmt.Errorf("invalid secret '%s': expected NAME=SECRET[:VERSION][=VALUE]", spec)
+	}
+
+	secretSpec, value, hasValue := strings.Cut(rest, "=")
+	secret, version, hasVersion := strings.Cut(secretSpec, ":")
+	if secret == "" {
+		return SecretEnvVar{}, fmt.Errorf("invalid secret '%s': missing secret name", spec)
+	}
+	if !hasVersion || version == "" {
+		version = "latest"
+	}
+	if hasValue && version != "latest" {
+		return SecretEnvVar{}, fmt.Errorf("invalid secret '%s': a value can only be set for the latest version", spec)
+	}
+
+	return SecretEnvVar{
+		Name:    name,
+		Secret:  secret,
+		Version: version,
+		Value:   value,
+	}, nil
+}
+
+// ImageOptions overrides the container images used for the API and worker,
+// e.g. to deploy from a mirrored Artifact Registry repository.
+type ImageOptions struct {
+	Repo   string // Image base replacing europe-docker.pkg.dev/litmusai-<env>/litmus
+	API    string // Full API image reference, takes precedence over Repo
+	Worker string // Full worker image reference, takes precedence over Repo
+}
+
+var (
+	imageRepoRegex = regexp.MustCompile(`^[a-z0-9.-]+(:[0-9]+)?(/[a-z0-9._-]+)+$`)
+	imageRefRegex  = regexp.MustCompile(`^[a-z0-9.-]+(:[0-9]+)?(/[a-z0-9._-]+)+(:[A-Za-z0-9_][A-Za-z0-9_.-]{0,127})?(@sha256:[a-f0-9]{64})?$`)
+)
+
+// Validate checks that the overrides are well-formed image references.
+func (o ImageOptions) Validate() error {
+	if o.Repo != "" && !imageRepoRegex.MatchString(o.Repo) {
+		return fmt.Errorf("invalid --image-repo '%s': expected a repository such as europe-docker.pkg.dev/my-project/litmus", o.Repo)
+	}
+	if o.API != "" && !imageRefRegex.MatchString(o.API) {
+		return fmt.Errorf("invalid --api-image '%s': expected an image reference such as europe-docker.pkg.dev/my-project/litmus/api:latest", o.API)
+	}
+	if o.Worker != "" && !imageRefRegex.MatchString(o.Worker) {
+		return fmt.Errorf("invalid --worker-image '%s': expected an image reference such as europe-docker.pkg.dev/my-project/litmus/worker:latest", o.Worker)
+	}
+	return nil
+}
+
+// Resolve returns the API and worker images for the given environment.
+func (o ImageOptions) Resolve(env string) (string, string) {
+	repo := o.Repo
+	if repo == "" {
+		repo = fmt.Sprintf("europe-docker.pkg.dev/litmusai-%s/litmus", env)
+	}
+	apiImage := o.API
+	if apiImage == "" {
+		apiImage = repo + "/api:latest"
+	}
+	workerImage := o.Worker
+	if workerImage == "" {
+		workerImage = repo + "/worker:latest"
+	}
+	return apiImage, workerImage
+}
+
+// JobOptions sets the task settings of the worker job. Zero values leave the
+// setting unchanged.
+type JobOptions struct {
+	Tasks       int           // Number of tasks started per execution
+	Parallelism int           // Maximum number of tasks running at once
+	TaskTimeout time.Duration // Maximum run time of a single task
+}
+
+// Cloud Run limits for job executions.
+const (
+	maxJobTasks       = 10000
+	maxJobTaskTimeout = 168 * time.Hour
+)
+
+// Validate checks that the settings are within the Cloud Run limits.
+func (o JobOptions) Validate() error {
+	if o.Tasks < 0 || o.Tasks > maxJobTasks {
+		return fmt.Errorf("invalid --tasks %d: expected a number between 1 and %d", o.Tasks, maxJobTasks)
+	}
+	if o.Parallelism < 0 || o.Parallelism > maxJobTasks {
+		return fmt.Errorf("invalid --parallelism %d: expected a number between 1 and %d", o.Parallelism, maxJobTasks)
+	}
+	if o.Tasks > 0 && o.Parallelism > o.Tasks {
+		return fmt.Errorf("invalid --parallelism %d: cannot be greater than --tasks %d", o.Parallelism, o.Tasks)
+	}
+	if o.TaskTimeout < 0 || o.TaskTimeout > maxJobTaskTimeout || o.TaskTimeout%time.Second != 0 {
+		return fmt.Errorf("invalid --task-timeout %s: expected whole seconds up to %s", o.TaskTimeout, maxJobTaskTimeout)
+	}
+	return nil
+}
+
+// args returns the gcloud run jobs deploy/update flags for the settings.
+func (o JobOptions) args() []string {
+	var args []string
+	if o.Tasks > 0 {
+		args = append(args, "--tasks", fmt.Sprint(o.Tasks))
+	}
+	if o.Parallelism > 0 {
+		args = append(args, "--parallelism", fmt.Sprint(o.Parallelism))
+	}
+	if o.TaskTimeout > 0 {
+		args = append(args, "--task-timeout", fmt.Sprintf("%ds", int64(o.TaskTimeout/time.Second)))
+	}
+	return args
+}
+
+// warn reports settings that don't speed up runs. Every task of an execution
+// runs all test cases of the run, the worker doesn't split them by task index.
+func (o JobOptions) warn() {
+	if o.Tasks > 1 {
+		logger.Warnf("The worker doesn't split test cases between tasks, each of the %d tasks runs every test case of a run", o.Tasks)
+	}
+}
+
+// DefaultFirestoreDatabase is the Firestore database Litmus uses unless
+// --firestore-database names another one.
+const DefaultFirestoreDatabase = "(default)"
+
+// firestoreDatabaseRegex matches the IDs of named Firestore databases.
+var firestoreDatabaseRegex = regexp.MustCompile(`^[a-z][a-z0-9-]{2,61}[a-z0-9]$`)
+
+// FirestoreOptions selects the Firestore database the API and worker use.
+type FirestoreOptions struct {
+	Database string // Database ID, see database for the default
+	Skip     bool   // Don't check for or create the database
+}
+
+// Validate checks that Database is a valid Firestore database ID.
+func (o FirestoreOptions) Validate() error {
+	if o.Database != "" && o.Database != DefaultFirestoreDatabase && !firestoreDatabaseRegex.MatchString(o.Database) {
+		return fmt.Errorf("invalid --firestore-database '%s': expected 4 to 63 lowercase letters, digits and hyphens, starting with a letter", o.Database)
+	}
+	return nil
+}
+
+// database returns the database ID. It defaults to DefaultFirestoreDatabase,
+// or to "litmus-<instance>" with an --instance, so instances in one project
+// don't share their runs and templates.
+func (o FirestoreOptions) database() string {
+	if o.Database != "" {
+		return o.Database
+	}
+	if utils.Instance != "" {
+		return utils.ResourceName("litmus")
+	}
+	return DefaultFirestoreDatabase
+}
+
+// updateOnlyEnvArgs returns the gcloud flags changing the environment of the
+// service and job with --update-only. Like update, only the variables that
+// were passed and differ from the deployed ones are changed, so the others,
+// such as an instance's FIRESTORE_DATABASE, are kept. The database is only
+// changed when --firestore-database is passed.
+func updateOnlyEnvArgs(deployedVars, deployedSecrets, envVars map[string]string, secretEnvVars []SecretEnvVar, firestore FirestoreOptions) []string {
+	requested := make(map[string]string, len(envVars)+1)
+	for name, value := range envVars {
+		requested[name] = value
+	}
+	if firestore.Database != "" {
+		requested["FIRESTORE_DATABASE"] = firestore.Database
+	}
+	return diffEnv(deployedVars, deployedSecrets, requested, secretEnvVars).args()
+}
+
 // DeployApplication deploys the Litmus application to Google Cloud.
-func DeployApplication(projectID, region string, envVars map[string]string, env string, quiet bool) {
-	s := spinner.New(spinner.CharSets[14], 100*time.Millisecond) // Create a new spinner instance
-	if !quiet {
+// Each step is reported as a structured event with --log-format json. If
+// timeout is set, the deployment is cancelled once it has run for that long
+// after being confirmed, killing the running gcloud command. With updateOnly,
+// the APIs, Firestore, bucket, service accounts, IAM bindings and analytics
+// are assumed to exist and only the service and job are redeployed, changing
+// only the environment variables that were passed. labels
+// are set on the service, job, files bucket and analytics dataset, together
+// with the litmus-managed label. job sets the task settings of the worker job.
+// firestore selects the database the API and worker use; with
+// firestore.Skip, it's assumed to be managed outside of Litmus.
+func DeployApplication(projectID, region string, envVars map[string]string, secretEnvVars []SecretEnvVar, env string, images ImageOptions, job JobOptions, firestore FirestoreOptions, kmsKey, logFilter string, labels map[string]string, tableExpiration, timeout time.Duration, updateOnly, quiet bool) (err error) {
+	var steps stepRecorder
+	defer func() { steps.fail(err) }()
+
+	// JSON progress events replace the spinners and messages, so stdout only
+	// carries the events. The prompt and bucket check still follow --quiet.
+	silent := quiet || ProgressIsJSON()
+
+	if err := images.Validate(); err != nil {
+		return err
+	}
+	if err := job.Validate(); err != nil {
+		return err
+	}
+	job.warn()
+	if err := firestore.Validate(); err != nil {
+		return err
+	}
+	firestoreDatabase := firestore.database()
+	apiImage, workerImage := images.Resolve(env)
+	apiService := utils.ResourceName("litmus-api")
+	workerJob := utils.ResourceName("litmus-worker")
+	passwordSecret := utils.ResourceName("litmus-password")
+
+	if logFilter != "" {
+		if err := analytics.ValidateLogFilter(logFilter); err != nil {
+			return err
+		}
+	}
+
+	if kmsKey != "" {
+		if err := utils.ValidateKMSKey(kmsKey); err != nil {
+			return err
+		}
+		if err := checkRunKMSKeyAccess(projectID, kmsKey); err != nil {
+			return err
+		}
+	}
+
+	var deployedVars, deployedSecrets map[string]string
+	if updateOnly {
+		if !utils.ServiceExists(projectID, region, apiService) {
+			return fmt.Errorf("Litmus is not deployed in project '%s' region '%s'. Run 'litmus deploy' without --update-only first", projectID, region)
+		}
+		deployedVars, deployedSecrets, err = deployedEnv(projectID, region, apiService)
+		if err != nil {
+			return err
+		}
+	}
+
+	s := newPhaseSpinner(silent)
+	defer s.stop()
+	// --progress json keeps stdout for the events, so --yes confirms
+	// without echoing the prompt there
+	if !quiet && !(ProgressIsJSON() && utils.AssumeYes) {
 		// --- Confirm deployment ---
-		if !utils.ConfirmPrompt(fmt.Sprintf("\nThis will deploy Litmus resources in the project '%s'. Are you sure you want to continue?", projectID)) {
+		prompt := fmt.Sprintf("\nThis will deploy Litmus resources in the project '%s'. Are you sure you want to continue?", projectID)
+		if updateOnly {
+			prompt = fmt.Sprintf("\nThis will redeploy the Litmus service and job in the project '%s'. Are you sure you want to continue?", projectID)
+		}
+		confirmed, err := utils.ConfirmPrompt(prompt)
+		if err != nil {
+			return err
+		}
+		if !confirmed {
 			fmt.Println("\nAborting deployment.")
-			return
+			return nil
 		}
 	}
 
+	if timeout > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		utils.SetCommandContext(ctx)
+		defer utils.SetCommandContext(context.Background())
+		// Runs before steps.fail, so the failed step reports the timeout
+		defer func() {
+			if err == nil || !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return
+			}
+			step := "between steps"
+			if steps.name != "" {
+				step = fmt.Sprintf("in step %s (%s)", steps.name, steps.detail)
+			}
+			err = utils.TransientError(fmt.Errorf("deploy timed out after %s %s: %w", timeout, step, err))
+		}()
+	}
+
 	// Enable required APIs
 	apisToEnable := []string{
 		"run.googleapis.com",
@@ -45,306 +321,447 @@ func DeployApplication(projectID, region string, envVars map[string]string, env
 		"aiplatform.googleapis.com",
 		"secretmanager.googleapis.com",
 		"cloudresourcemanager.googleapis.com",
-		"storage.googleapis.com", 
+		"storage.googleapis.com",
 		"bigquery.googleapis.com",
 	}
-	for _, api := range apisToEnable {
-		if !utils.IsAPIEnabled(api, projectID) {
-			if !quiet {
-				s.Suffix = fmt.Sprintf(" Enabling API %s... ", api)
-				s.Start()
-				defer s.Stop()
+	// One step per API and 13 for the rest of the deployment, plus the
+	// optional secret and bucket steps. --update-only only runs 5 of them.
+	// Routing traffic only happens on some updates and is not counted.
+	expected := 5
+	if !updateOnly {
+		expected += len(apisToEnable) + 8
+		if !silent {
+			expected++
+		}
+	}
+	if len(secretEnvVars) > 0 {
+		expected++
+	}
+	steps.expect(expected)
+
+	bucketName := utils.ResourceName(fmt.Sprintf("%s-litmus-files", projectID))
+	apiServiceAccountID := utils.ServiceAccountID(projectID, "api")
+	apiServiceAccount := fmt.Sprintf("%s@%s.iam.gserviceaccount.com", apiServiceAccountID, projectID)
+	workerServiceAccountID := utils.ServiceAccountID(projectID, "worker")
+	workerServiceAccount := fmt.Sprintf("%s@%s.iam.gserviceaccount.com", workerServiceAccountID, projectID)
+
+	if !updateOnly {
+		for _, api := range apisToEnable {
+			steps.begin("enable_api", api)
+			enabled, err := utils.IsAPIEnabled(api, projectID)
+			if err != nil {
+				return err
+			}
+			if !enabled {
+				if !silent {
+					s.start(fmt.Sprintf(" Enabling API %s... ", api))
+				}
+				enableAPICmd := utils.Command("gcloud", "services", "enable", api, "--project", projectID)
+				output, err := enableAPICmd.CombinedOutput()
+				if err != nil {
+					return fmt.Errorf("error enabling API %s: %v\nOutput: %s", api, err, output)
+				}
+				if !silent {
+					s.stop()
+					fmt.Printf("\nDone! API %s enabled!", api)
+				}
+				steps.end(stepDone)
+			} else {
+				if !silent {
+					fmt.Printf("\nAPI %s is already enabled.", api)
+				}
+				steps.end(stepSkipped)
 			}
-			enableAPICmd := exec.Command("gcloud", "services", "enable", api, "--project", projectID)
-			output, err := enableAPICmd.CombinedOutput()
+		}
+
+		// Check if Firestore database exists. Skipping it doesn't affect the
+		// grants below, roles/datastore.user covers every database in the
+		// project.
+		steps.begin("create_firestore", firestoreDatabase)
+		firestoreExists := firestore.Skip
+		if !firestore.Skip {
+			firestoreExists, err = utils.FirestoreDatabaseExists(projectID, firestoreDatabase)
 			if err != nil {
-				log.Fatalf("Error enabling API %s: %v\nOutput: %s", api, err, output) // Print gcloud output
+				return err
 			}
-			if !quiet {
-				fmt.Printf("\nDone! API %s enabled!", api)
+		}
+		if !firestoreExists {
+			if !silent {
+				// Create Firestore database
+				s.start(fmt.Sprintf(" Creating Firestore database '%s'... ", firestoreDatabase))
 			}
-		} else if !quiet {
-			fmt.Printf("\nAPI %s is already enabled.", api)
+			createFirestoreCmd := utils.Command(
+				"gcloud", "firestore", "databases", "create",
+				"--project", projectID,
+				"--location", region,
+				"--database", firestoreDatabase,
+			)
+			output, err := createFirestoreCmd.CombinedOutput() // Capture gcloud output
+			if err != nil {
+				return fmt.Errorf("error creating Firestore database: %v\nOutput: %s", err, output)
+			}
+			if !silent {
+				s.stop()
+				fmt.Println("\nDone! Firestore created!")
+			}
+			steps.end(stepDone)
+		} else {
+			if !silent {
+				if firestore.Skip {
+					fmt.Printf("\nSkipping Firestore database '%s' (--skip-firestore).\n", firestoreDatabase)
+				} else {
+					fmt.Println("\nFirestore database already exists.")
+				}
+			}
+			steps.end(stepSkipped)
 		}
-	}
 
-	// Check if Firestore database exists
-	if !utils.FirestoreDatabaseExists(projectID) {
-		if !quiet {
-			// Create default Firestore database
-			s.Suffix = " Creating default Firestore database... "
-			s.Start()
-			defer s.Stop()
+		// --- Create Files Bucket ---
+		steps.begin("create_files_bucket", "gs://"+bucketName)
+		if !silent {
+			s.start(fmt.Sprintf(" Creating files bucket '%s'... ", bucketName))
 		}
-		createFirestoreCmd := exec.Command(
-			"gcloud", "firestore", "databases", "create",
-			"--project", projectID,
-			"--location", region,
-		)
-		output, err := createFirestoreCmd.CombinedOutput() // Capture gcloud output
-		if err != nil {
-			log.Fatalf("\nError creating Firestore database: %v\nOutput: %s", err, output)
+		if err := createFilesBucket(bucketName, region, projectID, kmsKey, labels, silent); err != nil {
+			return fmt.Errorf("error creating files bucket: %v", err)
 		}
-		if !quiet {
-			fmt.Println("\nDone! Firestore created!")
+		if !silent {
+			s.stop()
+			fmt.Printf("Done! Created files bucket: %s\n", bucketName)
 		}
-	} else if !quiet {
-		fmt.Println("\nFirestore database already exists.")
-	}
+		steps.end(stepDone)
 
-	// --- Create Files Bucket ---
-	bucketName := fmt.Sprintf("%s-litmus-files", projectID)
-	if !quiet {
-		s.Suffix = fmt.Sprintf(" Creating files bucket '%s'... ", bucketName)
-		s.Start()
-		defer s.Stop()
-	}
-	if err := createFilesBucket(bucketName, region, projectID, quiet); err != nil {
-		log.Fatalf("Error creating files bucket: %v\n", err)
-	}
-	if !quiet {
-		fmt.Printf("Done! Created files bucket: %s\n", bucketName)
-	}
+		// --- Service Account for API ---
+		steps.begin("create_service_account", apiServiceAccount)
+		if !utils.ServiceAccountExists(projectID, apiServiceAccount) {
+			if !silent {
+				s.start(fmt.Sprintf(" Creating service account for API: %s... ", apiServiceAccount))
+			}
+			createServiceAccountCmd := utils.Command(
+				"gcloud", "iam", "service-accounts", "create",
+				apiServiceAccountID,
+				"--project", projectID,
+				"--display-name", "Litmus API Service Account",
+			)
+			output, err := createServiceAccountCmd.CombinedOutput()
+			if err != nil {
+				return fmt.Errorf("error creating service account: %v\nOutput: %s", err, output)
+			}
+			if !silent {
+				s.stop()
+				fmt.Printf("Done! Service account for API created: %s\n", apiServiceAccount)
+			}
+			steps.end(stepDone)
+		} else {
+			if !silent {
+				fmt.Printf("Service account for API already exists: %s (skipping)\n", apiServiceAccount)
+			}
+			steps.end(stepSkipped)
+		}
 
-	// --- Service Account for API ---
-	apiServiceAccount := fmt.Sprintf("%s-api@%s.iam.gserviceaccount.com", projectID, projectID)
-	if !utils.ServiceAccountExists(projectID, apiServiceAccount) {
-		if !quiet {
-			s.Suffix = fmt.Sprintf(" Creating service account for API: %s... ", apiServiceAccount)
-			s.Start()
-			defer s.Stop()
+		// --- Service Account for Worker ---
+		steps.begin("create_service_account", workerServiceAccount)
+		if !utils.ServiceAccountExists(projectID, workerServiceAccount) {
+			if !silent {
+				s.start(fmt.Sprintf(" Creating service account for Worker: %s... ", workerServiceAccount))
+			}
+			createWorkerServiceAccountCmd := utils.Command(
+				"gcloud", "iam", "service-accounts", "create",
+				workerServiceAccountID,
+				"--project", projectID,
+				"--display-name", "Litmus Worker Service Account",
+			)
+			output, err := createWorkerServiceAccountCmd.CombinedOutput()
+			if err != nil {
+				return fmt.Errorf("error creating service account: %v\nOutput: %s", err, output)
+			}
+			if !silent {
+				s.stop()
+				fmt.Printf("Done! Service account for Worker created: %s\n", workerServiceAccount)
+			}
+			steps.end(stepDone)
+		} else {
+			if !silent {
+				fmt.Printf("Service account for Worker already exists: %s (skipping)\n", workerServiceAccount)
+			}
+			steps.end(stepSkipped)
 		}
-		createServiceAccountCmd := exec.Command(
-			"gcloud", "iam", "service-accounts", "create",
-			fmt.Sprintf("%s-api", projectID),
-			"--project", projectID,
-			"--display-name", "Litmus API Service Account",
-		)
-		output, err := createServiceAccountCmd.CombinedOutput()
-		if err != nil {
-			log.Fatalf("Error creating service account: %v\nOutput: %s", err, output)
+
+		// --- Grant Vertex AI, Firestore, and Storage permissions to API service account ---
+		steps.begin("grant_roles", apiServiceAccount)
+		if !silent {
+			s.start(" Granting permissions to API service account... ")
 		}
-		if !quiet {
-			fmt.Printf("Done! Service account for API created: %s\n", apiServiceAccount)
+		if err := grantPermissions(apiServiceAccount, projectID, silent, bucketName); err != nil {
+			return fmt.Errorf("error granting permissions to API service account: %v", err)
 		}
-	} else if !quiet {
-		fmt.Printf("Service account for API already exists: %s (skipping)\n", apiServiceAccount)
-	}
-
-	// --- Service Account for Worker ---
-	workerServiceAccount := fmt.Sprintf("%s-worker@%s.iam.gserviceaccount.com", projectID, projectID)
-	if !utils.ServiceAccountExists(projectID, workerServiceAccount) {
-		if !quiet {
-			s.Suffix = fmt.Sprintf(" Creating service account for Worker: %s... ", workerServiceAccount)
-			s.Start()
-			defer s.Stop()
+		if !silent {
+			s.stop()
+			fmt.Printf("Done! Granted permissions to API service account\n")
 		}
-		createWorkerServiceAccountCmd := exec.Command(
-			"gcloud", "iam", "service-accounts", "create",
-			fmt.Sprintf("%s-worker", projectID),
-			"--project", projectID,
-			"--display-name", "Litmus Worker Service Account",
-		)
-		output, err := createWorkerServiceAccountCmd.CombinedOutput()
-		if err != nil {
-			log.Fatalf("Error creating service account: %v\nOutput: %s", err, output)
+		steps.end(stepDone)
+		// --- Grant Vertex AI, Firestore, and Storage permissions to Worker service account ---
+		steps.begin("grant_roles", workerServiceAccount)
+		if !silent {
+			s.start(" Granting permissions to Worker service account... ")
 		}
-		if !quiet {
-			fmt.Printf("Done! Service account for Worker created: %s\n", workerServiceAccount)
+		if err := grantPermissions(workerServiceAccount, projectID, silent, bucketName); err != nil {
+			return fmt.Errorf("error granting permissions to Worker service account: %v", err)
 		}
-	} else if !quiet {
-		fmt.Printf("Service account for Worker already exists: %s (skipping)\n", workerServiceAccount)
+		if !silent {
+			s.stop()
+			fmt.Printf("Done! Granted permissions to Worker service account\n")
+		}
+		steps.end(stepDone)
 	}
 
-	// --- Grant Vertex AI, Firestore, and Storage permissions to API service account ---
-	if !quiet {
-		s.Suffix = " Granting permissions to API service account... "
-		s.Start()
-		defer s.Stop()
-	}
-	if err := grantPermissions(apiServiceAccount, projectID, quiet, bucketName); err != nil {
-		log.Fatalf("Error granting permissions to API service account: %v \n", err)
-	}
-	if !quiet {
-		fmt.Printf("Done! Granted permissions to API service account\n")
-	}
-	// --- Grant Vertex AI, Firestore, and Storage permissions to Worker service account ---
-	if !quiet {
-		s.Suffix = " Granting permissions to Worker service account... "
-		s.Start()
-		defer s.Stop()
-	}
-	if err := grantPermissions(workerServiceAccount, projectID, quiet, bucketName); err != nil {
-		log.Fatalf("Error granting permissions to Worker service account: %v\n", err)
-	}
-	if !quiet {
-		fmt.Printf("Done! Granted permissions to Worker service account\n")
+	// --- Check that the caller can deploy as the service accounts ---
+	steps.begin("check_act_as", apiServiceAccount+","+workerServiceAccount)
+	if err := checkActAs(projectID, apiServiceAccount, workerServiceAccount); err != nil {
+		return err
 	}
+	steps.end(stepDone)
 
 	// --- Password, URL with Secret Manager ---
 	var password, serviceURL string
-	if !quiet {
-		s.Suffix = " Getting or creating passwords... "
-		s.Start()
-		defer s.Stop()
+	steps.begin("store_password", passwordSecret)
+	if !silent {
+		s.start(" Getting or creating passwords... ")
 	}
 	// Get or create password and store it in Secret Manager
-	password, err := utils.AccessSecret(projectID, "litmus-password")
+	password, err = utils.AccessSecret(projectID, passwordSecret)
 	if err != nil {
 		if strings.Contains(err.Error(), "not found") {
 			password = utils.GenerateRandomPassword(16)
-			if err := utils.CreateOrUpdateSecret(projectID, "litmus-password", password, quiet); err != nil {
-				log.Fatalf("Error storing password in Secret Manager: %v", err)
+			if err := utils.CreateOrUpdateSecret(projectID, passwordSecret, password, silent); err != nil {
+				return fmt.Errorf("error storing password in Secret Manager: %v", err)
 			}
 		} else {
-			log.Fatalf("Error accessing password in Secret Manager: %v", err)
+			return fmt.Errorf("error accessing password in Secret Manager: %v", err)
 		}
 	}
 	envVars["PASSWORD"] = password
+	steps.end(stepDone)
+
+	// --- Secret-backed environment variables ---
+	if len(secretEnvVars) > 0 {
+		steps.begin("configure_secret_env_vars", fmt.Sprintf("%d secrets", len(secretEnvVars)))
+		if !silent {
+			s.start(" Configuring secret-backed environment variables... ")
+		}
+		if err := prepareSecretEnvVars(projectID, secretEnvVars, []string{apiServiceAccount, workerServiceAccount}, silent); err != nil {
+			return fmt.Errorf("error configuring secret-backed environment variables: %v", err)
+		}
+		if !silent {
+			s.stop()
+			fmt.Println("Done! Configured secret-backed environment variables.")
+		}
+		steps.end(stepDone)
+	}
 
 	// --- Deploy Cloud Run service with service account ---
-	if !quiet {
-		s.Suffix = " Deploying Cloud Run service 'litmus-api'... "
-		s.Start()
-		defer s.Stop()
+	steps.begin("deploy_api", apiImage)
+	if !silent {
+		s.start(fmt.Sprintf(" Deploying Cloud Run service '%s'... ", apiService))
 	}
 
-	apiImage := fmt.Sprintf("europe-docker.pkg.dev/litmusai-%s/litmus/api:latest", env)
-	deployServiceCmd := exec.Command(
-		"gcloud", "run", "deploy", "litmus-api",
+	deployServiceCmd := utils.Command(
+		"gcloud", "run", "deploy", apiService,
 		"--project", projectID,
 		"--region", region,
 		"--allow-unauthenticated",
 		"--image", apiImage,
 		"--service-account", apiServiceAccount,
 	)
-
-	for name, value := range envVars {
-		deployServiceCmd.Args = append(deployServiceCmd.Args, "--set-env-vars", fmt.Sprintf("%s=%s", name, value))
+	if kmsKey != "" {
+		deployServiceCmd.Args = append(deployServiceCmd.Args, "--key", kmsKey)
 	}
 
-	deployServiceCmd.Args = append(deployServiceCmd.Args, "--set-env-vars", fmt.Sprintf("GCP_REGION=%s", region))
-	deployServiceCmd.Args = append(deployServiceCmd.Args, "--set-env-vars", fmt.Sprintf("GCP_PROJECT=%s", projectID))
-	deployServiceCmd.Args = append(deployServiceCmd.Args, "--set-env-vars", fmt.Sprintf("FILES_BUCKET=%s", bucketName))
+	var updateEnvArgs []string
+	if updateOnly {
+		updateEnvArgs = updateOnlyEnvArgs(deployedVars, deployedSecrets, envVars, secretEnvVars, firestore)
+		deployServiceCmd.Args = append(deployServiceCmd.Args, updateEnvArgs...)
+	} else {
+		for name, value := range envVars {
+			deployServiceCmd.Args = append(deployServiceCmd.Args, "--set-env-vars", fmt.Sprintf("%s=%s", name, value))
+		}
+
+		deployServiceCmd.Args = append(deployServiceCmd.Args, "--set-env-vars", fmt.Sprintf("GCP_REGION=%s", region))
+		deployServiceCmd.Args = append(deployServiceCmd.Args, "--set-env-vars", fmt.Sprintf("GCP_PROJECT=%s", projectID))
+		deployServiceCmd.Args = append(deployServiceCmd.Args, "--set-env-vars", fmt.Sprintf("FILES_BUCKET=%s", bucketName))
+		deployServiceCmd.Args = append(deployServiceCmd.Args, "--set-env-vars", fmt.Sprintf("WORKER_JOB=%s", workerJob))
+		deployServiceCmd.Args = append(deployServiceCmd.Args, "--set-env-vars", fmt.Sprintf("FIRESTORE_DATABASE=%s", firestoreDatabase))
+		for _, secretEnvVar := range secretEnvVars {
+			deployServiceCmd.Args = append(deployServiceCmd.Args, "--set-secrets", fmt.Sprintf("%s=%s:%s", secretEnvVar.Name, secretEnvVar.Secret, secretEnvVar.Version))
+		}
+	}
+	apiLabels := utils.ResourceLabels(labels, "api")
+	if !updateOnly {
+		// Tells destroy whether the database is Litmus's to delete
+		firestoreLabel := "managed"
+		if firestore.Skip {
+			firestoreLabel = "external"
+		}
+		apiLabels = append(apiLabels, utils.FirestoreLabel+"="+firestoreLabel)
+	}
+	deployServiceCmd.Args = append(deployServiceCmd.Args, "--update-labels", strings.Join(apiLabels, ","))
 
-	if utils.ServiceExists(projectID, region, "litmus-api") {
+	if utils.ServiceExists(projectID, region, apiService) {
 		deployServiceCmd.Args = append(deployServiceCmd.Args, "--no-traffic")
 	}
 
 	output, err := deployServiceCmd.CombinedOutput()
 	if err != nil {
-		log.Fatalf("Error deploying Cloud Run service: %v\nOutput: %s\n", err, output)
+		return fmt.Errorf("error deploying Cloud Run service: %v\nOutput: %s", err, output)
 	}
-	if !quiet {
+	if !silent {
+		s.stop()
 		fmt.Println("Done! Deployed API.")
 	}
+	steps.end(stepDone)
 
 	if strings.Contains(string(output), "Routing traffic...") {
-		if !quiet {
-			s.Suffix = " Routing traffic to the latest revision... "
-			s.Start()
-			defer s.Stop()
+		steps.begin("route_traffic", apiService)
+		if !silent {
+			s.start(" Routing traffic to the latest revision... ")
 		}
-		routeTrafficCmd := exec.Command(
-			"gcloud", "run", "services", "update-traffic", "litmus-api",
+		routeTrafficCmd := utils.Command(
+			"gcloud", "run", "services", "update-traffic", apiService,
 			"--project", projectID,
 			"--region", region,
 			"--to-latest",
 		)
 		if err := routeTrafficCmd.Run(); err != nil {
-			log.Fatalf("Error routing traffic to the latest revision: %v", err)
+			return fmt.Errorf("error routing traffic to the latest revision: %v", err)
 		}
-		if !quiet {
+		if !silent {
+			s.stop()
 			fmt.Println("Done! Routed traffic to the latest revision.")
 		}
+		steps.end(stepDone)
 	}
 
 	// --- Extract Service URL and Store in Secret Manager ---
 	serviceURL = utils.ExtractServiceURL(string(output))
-	if !quiet {
-		s.Suffix = " Storing service URL... "
-		s.Start()
-		defer s.Stop()
+	steps.begin("store_service_url", serviceURL)
+	if !silent {
+		s.start(" Storing service URL... ")
 	}
-	if err := utils.CreateOrUpdateSecret(projectID, "litmus-service-url", serviceURL, quiet); err != nil {
-		log.Fatalf("Error storing service URL in Secret Manager: %v", err)
+	if err := utils.CreateOrUpdateSecret(projectID, utils.ResourceName("litmus-service-url"), serviceURL, silent); err != nil {
+		return fmt.Errorf("error storing service URL in Secret Manager: %v", err)
 	}
+	steps.end(stepDone)
 
 	// --- Deploy Cloud Run job with service account ---
-	if !quiet {
-		s.Suffix = " Deploying Cloud Run job 'litmus-worker'... "
-		s.Start()
-		defer s.Stop()
-	}
-	workerImage := fmt.Sprintf("europe-docker.pkg.dev/litmusai-%s/litmus/worker:latest", env)
-	deployJobCmd := exec.Command(
-		"gcloud", "run", "jobs", "deploy", "litmus-worker",
+	steps.begin("deploy_worker", workerImage)
+	if !silent {
+		s.start(fmt.Sprintf(" Deploying Cloud Run job '%s'... ", workerJob))
+	}
+	deployJobCmd := utils.Command(
+		"gcloud", "run", "jobs", "deploy", workerJob,
 		"--project", projectID,
 		"--region", region,
 		"--image", workerImage,
 		"--service-account", workerServiceAccount,
 	)
-
-	for name, value := range envVars {
-		deployJobCmd.Args = append(deployJobCmd.Args, "--set-env-vars", fmt.Sprintf("%s=%s", name, value))
+	if kmsKey != "" {
+		deployJobCmd.Args = append(deployJobCmd.Args, "--key", kmsKey)
 	}
 
-	deployJobCmd.Args = append(deployJobCmd.Args, "--set-env-vars", fmt.Sprintf("GCP_REGION=%s", region))
-	deployJobCmd.Args = append(deployJobCmd.Args, "--set-env-vars", fmt.Sprintf("GCP_PROJECT=%s", projectID))
-	deployJobCmd.Args = append(deployJobCmd.Args, "--set-env-vars", fmt.Sprintf("FILES_BUCKET=%s", bucketName)) // Pass bucket name to Worker
+	if updateOnly {
+		// Like update, the job gets the changes of the service's environment
+		deployJobCmd.Args = append(deployJobCmd.Args, updateEnvArgs...)
+	} else {
+		for name, value := range envVars {
+			deployJobCmd.Args = append(deployJobCmd.Args, "--set-env-vars", fmt.Sprintf("%s=%s", name, value))
+		}
+
+		deployJobCmd.Args = append(deployJobCmd.Args, "--set-env-vars", fmt.Sprintf("GCP_REGION=%s", region))
+		deployJobCmd.Args = append(deployJobCmd.Args, "--set-env-vars", fmt.Sprintf("GCP_PROJECT=%s", projectID))
+		deployJobCmd.Args = append(deployJobCmd.Args, "--set-env-vars", fmt.Sprintf("FILES_BUCKET=%s", bucketName)) // Pass bucket name to Worker
+		deployJobCmd.Args = append(deployJobCmd.Args, "--set-env-vars", fmt.Sprintf("FIRESTORE_DATABASE=%s", firestoreDatabase))
+		for _, secretEnvVar := range secretEnvVars {
+			deployJobCmd.Args = append(deployJobCmd.Args, "--set-secrets", fmt.Sprintf("%s=%s:%s", secretEnvVar.Name, secretEnvVar.Secret, secretEnvVar.Version))
+		}
+	}
+	deployJobCmd.Args = append(deployJobCmd.Args, "--update-labels", strings.Join(utils.ResourceLabels(labels, "worker"), ","))
+	deployJobCmd.Args = append(deployJobCmd.Args, job.args()...)
 
-	if utils.JobExists(projectID, region, "litmus-worker") {
+	if utils.JobExists(projectID, region, workerJob) {
 		deployJobCmd.Args[3] = "update"
 	}
 
 	output, err = deployJobCmd.CombinedOutput()
 	if err != nil {
-		log.Fatalf("Error deploying Cloud Run job: %v\nOutput: %s", err, output) // Print gcloud output
+		return fmt.Errorf("error deploying Cloud Run job: %v\nOutput: %s", err, output)
 	}
-	if !quiet {
+	if !silent {
+		s.stop()
 		fmt.Println("Done! Deployed Worker")
 	}
+	steps.end(stepDone)
 
-	// --- Grant API permission to invoke Worker ---
-	if !utils.BindingExists(projectID, region, "litmus-worker", apiServiceAccount, "roles/run.invoker") {
-		if !quiet {
-			s.Suffix = " Granting API permission to invoke Worker... "
-			s.Start()
-			defer s.Stop()
-		}
-		grantPermissionCmd := exec.Command(
-			"gcloud", "run", "jobs", "add-iam-policy-binding", "litmus-worker",
-			"--member", fmt.Sprintf("serviceAccount:%s", apiServiceAccount),
-			"--role", "roles/run.invoker",
-			"--project", projectID,
-			"--region", region,
-		)
-		if err := grantPermissionCmd.Run(); err != nil {
-			log.Fatalf("Error granting permission: %v\n", err)
+	if !updateOnly {
+		// --- Grant API permission to invoke Worker ---
+		steps.begin("grant_worker_invoker", apiServiceAccount)
+		if !utils.BindingExists(projectID, region, workerJob, apiServiceAccount, "roles/run.invoker") {
+			if !silent {
+				s.start(" Granting API permission to invoke Worker... ")
+			}
+			grantPermissionCmd := utils.Command(
+				"gcloud", "run", "jobs", "add-iam-policy-binding", workerJob,
+				"--member", fmt.Sprintf("serviceAccount:%s", apiServiceAccount),
+				"--role", "roles/run.invoker",
+				"--project", projectID,
+				"--region", region,
+			)
+			if err := grantPermissionCmd.Run(); err != nil {
+				return fmt.Errorf("error granting permission: %v", err)
+			}
+			if !silent {
+				s.stop()
+				fmt.Print("Done! Granting API permission to invoke Worker.\n\n")
+			}
+			steps.end(stepDone)
+		} else {
+			if !silent {
+				fmt.Print("API permission to invoke Worker already exists.\n\n")
+			}
+			steps.end(stepSkipped)
 		}
-		if !quiet {
-			fmt.Println("Done! Granting API permission to invoke Worker.\n")
+
+		if !silent {
+			s.start(" Setting up analytics... ")
 		}
-	} else if !quiet {
-		fmt.Println("API permission to invoke Worker already exists.\n")
-	}
+		// Deploy Analytics
+		steps.begin("deploy_analytics", "litmus_analytics")
+		if err := analytics.DeployAnalytics(projectID, region, kmsKey, logFilter, labels, tableExpiration, false, true); err != nil {
+			return fmt.Errorf("error deploying analytics: %w", err)
+		}
+		steps.end(stepDone)
 
-	if !quiet {
-		s.Suffix = " Setting up analytics... "
-		s.Start()
-		defer s.Stop()
-	}
-	// Deploy Analytics
-	if err := analytics.DeployAnalytics(projectID, region, true); err != nil {
-		utils.HandleGcloudError(err)
+		// --- Check that the files bucket accepts writes ---
+		if !quiet {
+			steps.begin("check_bucket_writable", "gs://"+bucketName)
+			s.start(" Checking that the files bucket is writable... ")
+			if err := checkBucketWritable(bucketName, projectID); err != nil {
+				s.stop()
+				logger.Warnf("Unable to write to the files bucket 'gs://%s', runs that store files will fail: %v", bucketName, err)
+				steps.end(stepFailed)
+			} else {
+				steps.end(stepDone)
+			}
+		}
 	}
 
-	if !quiet {
-		fmt.Println("\nAll deployments completed \n")
+	s.stop()
+	steps.complete(fmt.Sprintf("Litmus deployed to %s", serviceURL))
+	if !silent {
+		fmt.Print("\nAll deployments completed \n\n")
 		fmt.Println("Get started now by visiting: ", serviceURL)
 		fmt.Println("User: admin")
 		fmt.Println("Password: ", password)
 	}
+	return nil
 }
 
 // grantPermissions grants Vertex AI, Firestore, and Storage permissions to the given service account.
@@ -361,7 +778,7 @@ func grantPermissions(serviceAccount, projectID string, quiet bool, bucketName s
 
 	for _, role := range roles {
 		if !utils.BindingExists(projectID, "", "", serviceAccount, role) {
-			cmd := exec.Command(
+			cmd := utils.Command(
 				"gcloud", "projects", "add-iam-policy-binding", projectID,
 				"--member", fmt.Sprintf("serviceAccount:%s", serviceAccount),
 				"--role", role,
@@ -378,7 +795,7 @@ func grantPermissions(serviceAccount, projectID string, quiet bool, bucketName s
 
 	// Grant Storage Object Admin role on the bucket
 	if !utils.BindingExists(projectID, "", bucketName, serviceAccount, "roles/storage.objectAdmin") {
-		cmd := exec.Command(
+		cmd := utils.Command(
 			"gcloud", "storage", "buckets",
 			"add-iam-policy-binding", fmt.Sprintf("gs://%s", bucketName),
 			"--member", fmt.Sprintf("serviceAccount:%s", serviceAccount),
@@ -395,9 +812,35 @@ func grantPermissions(serviceAccount, projectID string, quiet bool, bucketName s
 	return nil
 }
 
-func createFilesBucket(bucketName, region, projectID string, quiet bool) error {
+// prepareSecretEnvVars stores provided secret values in Secret Manager and grants
+// the given service accounts access to the referenced secrets.
+func prepareSecretEnvVars(projectID string, secretEnvVars []SecretEnvVar, serviceAccounts []string, quiet bool) error {
+	for _, secretEnvVar := range secretEnvVars {
+		if secretEnvVar.Value != "" {
+			if err := utils.CreateOrUpdateSecret(projectID, secretEnvVar.Secret, secretEnvVar.Value, quiet); err != nil {
+				return fmt.Errorf("error storing secret '%s': %w", secretEnvVar.Secret, err)
+			}
+		}
+
+		for _, serviceAccount := range serviceAccounts {
+			cmd := utils.Command(
+				"gcloud", "secrets", "add-iam-policy-binding", secretEnvVar.Secret,
+				"--project", projectID,
+				"--member", fmt.Sprintf("serviceAccount:%s", serviceAccount),
+				"--role", "roles/secretmanager.secretAccessor",
+			)
+			output, err := cmd.CombinedOutput()
+			if err != nil {
+				return fmt.Errorf("error granting access to secret '%s': %w\nOutput: %s", secretEnvVar.Secret, err, output)
+			}
+		}
+	}
+	return nil
+}
+
+func createFilesBucket(bucketName, region, projectID, kmsKey string, labels map[string]string, quiet bool) error {
 	// Check if the bucket already exists using gcloud
-	cmd := exec.Command(
+	cmd := utils.Command(
 		"gcloud", "storage", "buckets", "describe",
 		fmt.Sprintf("gs://%s", bucketName),
 		"--project", projectID,
@@ -408,12 +851,15 @@ func createFilesBucket(bucketName, region, projectID string, quiet bool) error {
 		// Check if the error is specifically because the bucket doesn't exist
 		if strings.Contains(string(output), "not found") {
 			// Bucket does not exist, create it
-			cmd = exec.Command(
+			cmd = utils.Command(
 				"gcloud", "storage", "buckets", "create",
 				fmt.Sprintf("gs://%s", bucketName),
 				"--location", region,
 				"--project", projectID,
 			)
+			if kmsKey != "" {
+				cmd.Args = append(cmd.Args, "--default-encryption-key", kmsKey)
+			}
 			output, err := cmd.CombinedOutput()
 			if err != nil {
 				return fmt.Errorf("error creating files bucket: %w\nOutput: %s", err, output)
@@ -428,5 +874,146 @@ func createFilesBucket(bucketName, region, projectID string, quiet bool) error {
 		fmt.Printf("Files bucket '%s' already exists, skipping creation.\n", bucketName)
 	}
 
+	// Labels are updated separately so they also apply to existing buckets
+	cmd = utils.Command(
+		"gcloud", "storage", "buckets", "update",
+		fmt.Sprintf("gs://%s", bucketName),
+		"--project", projectID,
+		"--update-labels", strings.Join(utils.ResourceLabels(labels, "files"), ","),
+	)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("error labeling files bucket: %w\nOutput: %s", err, output)
+	}
+
+	return nil
+}
+
+// checkBucketWritable writes and deletes a small object in the bucket with
+// the deploying credentials. Granting roles/storage.objectAdmin doesn't
+// guarantee writes succeed, e.g. when an organization policy blocks them.
+func checkBucketWritable(bucketName, projectID string) error {
+	object := fmt.Sprintf("gs://%s/.litmus-write-check", bucketName)
+
+	writeCmd := utils.Command("gcloud", "storage", "cp", "-", object, "--project", projectID)
+	writeCmd.Stdin = strings.NewReader("litmus")
+	if output, err := writeCmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%w\nOutput: %s", err, output)
+	}
+
+	deleteCmd := utils.Command("gcloud", "storage", "rm", object, "--project", projectID)
+	if output, err := deleteCmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("test object %s could not be deleted: %w\nOutput: %s", object, err, output)
+	}
+	return nil
+}
+
+// checkRunKMSKeyAccess verifies that the Cloud Run service agent can use the
+// KMS key, since deploying with --key fails late and with an unclear error
+// otherwise. If the key's IAM policy cannot be read, the check is skipped.
+func checkRunKMSKeyAccess(projectID, kmsKey string) error {
+	output, err := utils.Command(
+		"gcloud", "projects", "describe", projectID,
+		"--format=value(projectNumber)",
+	).Output()
+	if err != nil {
+		return fmt.Errorf("error getting project number: %w", err)
+	}
+	serviceAgent := fmt.Sprintf("serviceAccount:service-%s@serverless-robot-prod.iam.gserviceaccount.com", strings.TrimSpace(string(output)))
+
+	output, err = utils.Command(
+		"gcloud", "kms", "keys", "get-iam-policy", kmsKey,
+		"--flatten=bindings[].members",
+		"--filter=bindings.role:roles/cloudkms.cryptoKeyEncrypterDecrypter",
+		"--format=value(bindings.members)",
+	).Output()
+	if err != nil {
+		logger.Warnf("Unable to read the IAM policy of KMS key '%s', skipping the access check: %v", kmsKey, err)
+		return nil
+	}
+
+	for _, member := range strings.Fields(string(output)) {
+		if member == serviceAgent {
+			return nil
+		}
+	}
+	return fmt.Errorf("the Cloud Run service agent does not have roles/cloudkms.cryptoKeyEncrypterDecrypter on KMS key '%s'. Grant it with:\n  gcloud kms keys add-iam-policy-binding %s --member %s --role roles/cloudkms.cryptoKeyEncrypterDecrypter", kmsKey, kmsKey, serviceAgent)
+}
+
+// checkActAs verifies that the caller has iam.serviceAccounts.actAs on each
+// service account, which Cloud Run requires to deploy with --service-account.
+// Without it the deploy fails late with an unclear error. If the permission
+// cannot be tested, the check is skipped.
+func checkActAs(projectID string, serviceAccounts ...string) error {
+	account, err := utils.GetGcloudAccount()
+	if err != nil || account == "" {
+		logger.Warnf("Unable to determine the gcloud account, skipping the service account access check")
+		return nil
+	}
+	output, err := utils.Command("gcloud", "auth", "print-access-token").Output()
+	if err != nil {
+		logger.Warnf("Unable to get an access token, skipping the service account access check: %v", err)
+		return nil
+	}
+	token := strings.TrimSpace(string(output))
+
+	member := "user:" + account
+	if strings.HasSuffix(account, ".gserviceaccount.com") {
+		member = "serviceAccount:" + account
+	}
+
+	var missing []string
+	for _, serviceAccount := range serviceAccounts {
+		allowed, err := testActAs(token, serviceAccount)
+		if err != nil {
+			logger.Warnf("Unable to test access to service account '%s', skipping the check: %v", serviceAccount, err)
+			continue
+		}
+		if !allowed {
+			missing = append(missing, fmt.Sprintf("  gcloud iam service-accounts add-iam-policy-binding %s --project %s --member %s --role roles/iam.serviceAccountUser", serviceAccount, projectID, member))
+		}
+	}
+	if len(missing) > 0 {
+		return utils.AuthError(fmt.Errorf("%s cannot deploy Cloud Run services as the Litmus service accounts (missing iam.serviceAccounts.actAs). Grant it with:\n%s", account, strings.Join(missing, "\n")))
+	}
 	return nil
 }
+
+// testActAs asks the IAM API whether the caller has
+// iam.serviceAccounts.actAs on serviceAccount.
+func testActAs(token, serviceAccount string) (bool, error) {
+	const permission = "iam.serviceAccounts.actAs"
+	body, err := json.Marshal(map[string][]string{"permissions": {permission}})
+	if err != nil {
+		return false, err
+	}
+
+	req, err := http.NewRequest("POST", fmt.Sprintf("https://iam.googleapis.com/v1/projects/-/serviceAccounts/%s:testIamPermissions", serviceAccount), bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("unexpected status code: %s", resp.Status)
+	}
+
+	var result struct {
+		Permissions []string `json:"permissions"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return false, err
+	}
+	for _, granted := range result.Permissions {
+		if granted == permission {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,89 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/google/litmus/cli/utils"
+)
+
+// setProgressFormat selects the progress format for the rest of the test.
+func setProgressFormat(t *testing.T, name string) {
+	t.Helper()
+	if err := SetProgressFormat(name); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SetProgressFormat(ProgressSpinner) })
+}
+
+func TestDeployJSONProgressStillConfirms(t *testing.T) {
+	setProgressFormat(t, ProgressJSON)
+	if utils.IsInteractive() {
+		t.Skip("stdin is a terminal")
+	}
+	calls := fakeCommands(t, func(args []string) (string, int) { return "", 0 })
+
+	// Without --yes or --quiet, the prompt can't be answered from a pipe
+	err := DeployApplication("my-proj", "us-central1", nil, nil, "prod", ImageOptions{}, JobOptions{}, FirestoreOptions{}, "", "", nil, 0, 0, false, false)
+	if !errors.Is(err, utils.ErrNotInteractive) {
+		t.Fatalf("DeployApplication() error = %v, want ErrNotInteractive", err)
+	}
+	if ran := calls(); len(ran) != 0 {
+		t.Errorf("ran %v before the deployment was confirmed", ran)
+	}
+}
+
+func TestUpdateOnlyEnvArgs(t *testing.T) {
+	deployed := map[string]string{
+		"FIRESTORE_DATABASE": "litmus-staging",
+		"GCP_REGION":         "us-central1",
+		"PASSWORD":           "secret",
+		"MY_VAR":             "old",
+	}
+	tests := []struct {
+		name      string
+		envVars   map[string]string
+		firestore FirestoreOptions
+		want      []string
+	}{
+		{
+			name:    "keeps deployed database",
+			envVars: map[string]string{"PASSWORD": "secret", "MY_VAR": "new"},
+			want:    []string{"--update-env-vars", "MY_VAR=new"},
+		},
+		{
+			name:    "unchanged",
+			envVars: map[string]string{"PASSWORD": "secret"},
+		},
+		{
+			name:      "database passed",
+			envVars:   map[string]string{"PASSWORD": "secret"},
+			firestore: FirestoreOptions{Database: "litmus-prod"},
+			want:      []string{"--update-env-vars", "FIRESTORE_DATABASE=litmus-prod"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := updateOnlyEnvArgs(deployed, nil, tt.envVars, nil, tt.firestore)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("updateOnlyEnvArgs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
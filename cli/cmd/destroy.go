@@ -15,67 +15,146 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
-	"log"
 	"os/exec"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/briandowns/spinner"
 	"github.com/google/litmus/cli/analytics"
+	"github.com/google/litmus/cli/logger"
 	"github.com/google/litmus/cli/utils"
 )
 
-// DestroyResources removes all resources created by the Litmus application.
-func DestroyResources(projectID, region string, preserveData, quiet bool) {
+// DestroyTargets lists the resource groups accepted by destroy --only.
+var DestroyTargets = []string{"service", "job", "secrets", "service-accounts", "analytics", "bucket", "proxies"}
+
+// ParseDestroyTargets parses the comma-separated --only value.
+func ParseDestroyTargets(spec string) ([]string, error) {
+	var targets []string
+	for _, target := range strings.Split(spec, ",") {
+		target = strings.TrimSpace(target)
+		if target == "" {
+			continue
+		}
+		if !slices.Contains(DestroyTargets, target) {
+			return nil, fmt.Errorf("invalid --only target '%s': must be one of %s", target, strings.Join(DestroyTargets, ", "))
+		}
+		targets = append(targets, target)
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("--only requires at least one of %s", strings.Join(DestroyTargets, ", "))
+	}
+	return targets, nil
+}
+
+// DestroyResources removes the resources created by the Litmus application.
+// If only is empty, everything except proxies is removed; otherwise only the
+// listed resource groups (see DestroyTargets) are. Data is kept with
+// preserveData in both cases, and the service accounts with
+// keepServiceAccounts. With an --instance, analytics are shared with other
+// instances and only removed through --only, and only the instance's own
+// Firestore database is deleted.
+func DestroyResources(projectID, region string, only []string, preserveData, keepServiceAccounts, quiet bool) error {
 	s := spinner.New(spinner.CharSets[14], 100*time.Millisecond)
+
+	// selected reports whether a resource group should be deleted
+	selected := func(target string) bool {
+		if keepServiceAccounts && target == "service-accounts" {
+			return false // Reused across deployments
+		}
+		if len(only) == 0 {
+			if utils.Instance != "" && target == "analytics" {
+				return false // Shared by all instances in the project
+			}
+			return target != "proxies" // Proxies are only removed on request
+		}
+		return slices.Contains(only, target)
+	}
+	if preserveData && (slices.Contains(only, "bucket") || slices.Contains(only, "analytics")) {
+		logger.Warnf("--preserve-data is set, skipping the files bucket and analytics.")
+	}
+	if keepServiceAccounts && slices.Contains(only, "service-accounts") {
+		logger.Warnf("--keep-service-accounts is set, skipping the service accounts.")
+	}
+
+	plan, err := planDestroy(projectID, region, selected, !preserveData && len(only) == 0, preserveData)
+	if err != nil {
+		return err
+	}
+	if len(plan) == 0 {
+		if !quiet {
+			fmt.Println("No Litmus resources found, nothing to delete.")
+		}
+		return nil
+	}
+
 	if !quiet {
-		if !utils.ConfirmPrompt(fmt.Sprintf("\nThis will delete all Litmus resources in the project '%s'. Are you sure you want to continue?", projectID)) {
+		fmt.Println("\nThe following resources will be deleted:")
+		for _, item := range plan {
+			fmt.Printf("  - %s\n", item)
+		}
+		message := fmt.Sprintf("\nThis will delete all Litmus resources in the project '%s'. Are you sure you want to continue?", projectID)
+		if utils.Instance != "" {
+			message = fmt.Sprintf("\nThis will delete the Litmus instance '%s' in the project '%s'. Are you sure you want to continue?", utils.Instance, projectID)
+		}
+		if len(only) > 0 {
+			message = fmt.Sprintf("\nThis will delete the Litmus %s in the project '%s'. Are you sure you want to continue?", strings.Join(only, ", "), projectID)
+		}
+		confirmed, err := utils.ConfirmPrompt(message)
+		if err != nil {
+			return err
+		}
+		if !confirmed {
 			fmt.Println("Aborting destruction.")
-			return
+			return nil
 		}
 	}
 
 	deleteResource := func(resourceType, resourceName string) {
 		var cmd *exec.Cmd
 		if resourceType == "service" {
-			cmd = exec.Command("gcloud", "run", "services", "delete", resourceName,
+			cmd = utils.Command("gcloud", "run", "services", "delete", resourceName,
 				"--project", projectID,
 				"--region", region,
 				"--quiet",
 			)
 		} else if resourceType == "job" {
-			cmd = exec.Command("gcloud", "run", "jobs", "delete", resourceName,
+			cmd = utils.Command("gcloud", "run", "jobs", "delete", resourceName,
 				"--project", projectID,
 				"--region", region,
 				"--quiet",
 			)
 		} else if resourceType == "secret" {
-			cmd = exec.Command("gcloud", "secrets", "delete", resourceName,
+			cmd = utils.Command("gcloud", "secrets", "delete", resourceName,
 				"--project", projectID,
 				"--quiet",
 			)
 		} else if resourceType == "serviceAccount" {
-			cmd = exec.Command("gcloud", "iam", "service-accounts", "delete", resourceName,
+			cmd = utils.Command("gcloud", "iam", "service-accounts", "delete", resourceName,
 				"--project", projectID,
 				"--quiet",
 			)
 		} else if resourceType == "bucket" {
-			cmd = exec.Command("gcloud", "storage", "rm", "-r", fmt.Sprintf("gs://%s", resourceName))
+			cmd = utils.Command("gcloud", "storage", "rm", "-r", fmt.Sprintf("gs://%s", resourceName))
 		} else if resourceType == "firestore" {
-			cmd = exec.Command("gcloud", "firestore", "databases", "delete",
+			cmd = utils.Command("gcloud", "firestore", "databases", "delete",
 				"--project", projectID,
 				"--database", resourceName,
 				"--quiet",
 			)
 		} else if resourceType == "bqDataset" { // Added BigQuery dataset deletion
-			cmd = exec.Command(
+			cmd = utils.Command(
 				"bq", "rm",
 				"--project_id", projectID,
 				"--dataset", "--force", // Force delete the dataset
 				fmt.Sprintf("%s:%s", projectID, resourceName),
 			)
 		} else {
-			log.Fatalf("Invalid resource type: %s", resourceType)
+			logger.Errorf("Invalid resource type: %s", resourceType)
+			return
 		}
 
 		if !quiet {
@@ -85,64 +164,164 @@ func DestroyResources(projectID, region string, preserveData, quiet bool) {
 		}
 
 		if err := cmd.Run(); err != nil {
-			if !quiet {
-				log.Printf("Error removing %s: %v. You might need to remove it manually.\n", resourceType, err)
-			}
+			logger.Warnf("Error removing %s: %v. You might need to remove it manually.", resourceType, err)
 		} else if !quiet {
 			fmt.Printf("Done! Deleted %s '%s'.\n", resourceType, resourceName)
 		}
 	}
 
-	// --- Delete Cloud Run service ---
-	deleteResource("service", "litmus-api")
-
-	// --- Delete Cloud Run job ---
-	deleteResource("job", "litmus-worker")
+	proxiesDeleted := false
+	for _, item := range plan {
+		switch item.resourceType {
+		case "proxy":
+			if proxiesDeleted {
+				continue
+			}
+			if err := DestroyAllProxyServices(projectID, region, true); err != nil {
+				return fmt.Errorf("error destroying proxy services: %w", err)
+			}
+			proxiesDeleted = true
+			if !quiet {
+				fmt.Println("Done! Deleted proxy services.")
+			}
+		case "analytics":
+			deleteResource("bqDataset", item.name)
+			if !quiet {
+				s.Suffix = " Removing analytics... "
+				s.Start()
+				defer s.Stop()
+			}
+			if err := analytics.DestroyAnalytics(projectID, region, true); err != nil {
+				return fmt.Errorf("error destroying analytics: %w", err)
+			}
+		default:
+			deleteResource(item.resourceType, item.name)
+		}
+	}
 
-	// --- Delete Secrets from Secret Manager ---
-	secretsToDelete := []string{"litmus-password", "litmus-service-url"}
-	for _, secretID := range secretsToDelete {
-		deleteResource("secret", secretID)
+	if !quiet {
+		fmt.Println("\nResource destruction complete.")
 	}
+	return nil
+}
 
-	// --- Delete Service Accounts ---
-	serviceAccountsToDelete := []string{
-		fmt.Sprintf("%s-api@%s.iam.gserviceaccount.com", projectID, projectID),
-		fmt.Sprintf("%s-worker@%s.iam.gserviceaccount.com", projectID, projectID),
+// destroyItem is a resource that destroy will delete.
+type destroyItem struct {
+	resourceType string // As accepted by deleteResource, or "proxy" / "analytics"
+	name         string
+	description  string
+}
+
+func (i destroyItem) String() string {
+	return fmt.Sprintf("%s '%s'", i.description, i.name)
+}
+
+// planDestroy lists the existing resources in the selected groups, in the
+// order they're deleted. Resources that don't exist are left out, so the
+// user confirms against what is actually deployed. The Firestore database is
+// only included with withFirestore, the bucket and analytics only without
+// preserveData.
+func planDestroy(projectID, region string, selected func(string) bool, withFirestore, preserveData bool) ([]destroyItem, error) {
+	var plan []destroyItem
+
+	if selected("service") {
+		if name := utils.ResourceName("litmus-api"); utils.ServiceExists(projectID, region, name) {
+			plan = append(plan, destroyItem{"service", name, "Cloud Run service"})
+		}
 	}
-	for _, sa := range serviceAccountsToDelete {
-		deleteResource("serviceAccount", sa)
+	if selected("job") {
+		if name := utils.ResourceName("litmus-worker"); utils.JobExists(projectID, region, name) {
+			plan = append(plan, destroyItem{"job", name, "Cloud Run job"})
+		}
 	}
-
-	// --- Conditionally Delete Files Bucket ---
-	if !preserveData {
-		bucketName := fmt.Sprintf("%s-litmus-files", projectID)
-		deleteResource("bucket", bucketName)
+	if selected("secrets") {
+		for _, name := range []string{utils.ResourceName("litmus-password"), utils.ResourceName("litmus-service-url")} {
+			if utils.SecretExists(projectID, name) {
+				plan = append(plan, destroyItem{"secret", name, "Secret"})
+			}
+		}
 	}
-
-	// --- Conditionally Delete Firestore Database ---
-	if !preserveData {
-		deleteResource("firestore", "(default)")
+	if selected("service-accounts") {
+		for _, id := range []string{utils.ServiceAccountID(projectID, "api"), utils.ServiceAccountID(projectID, "worker")} {
+			email := fmt.Sprintf("%s@%s.iam.gserviceaccount.com", id, projectID)
+			if utils.ServiceAccountExists(projectID, email) {
+				plan = append(plan, destroyItem{"serviceAccount", email, "Service account"})
+			}
+		}
 	}
-
-	// --- Conditionally Delete BigQuery Dataset ---
-	if !preserveData {
-		deleteResource("bqDataset", "litmus_analytics")
+	if selected("proxies") {
+		services, err := ListProxyServices(projectID, true)
+		if err != nil {
+			return nil, err
+		}
+		for _, service := range services {
+			plan = append(plan, destroyItem{"proxy", service.Name, fmt.Sprintf("Proxy service (%s)", proxyRegion(service, region))})
+		}
 	}
-
-	// Destroy Analytics
-	if !preserveData {
-		if !quiet {
-			s.Suffix = " Removing analytics... "
-			s.Start()
-			defer s.Stop()
+	if !preserveData && selected("bucket") {
+		if name := utils.ResourceName(fmt.Sprintf("%s-litmus-files", projectID)); utils.BucketExists(projectID, name) {
+			plan = append(plan, destroyItem{"bucket", name, "Files bucket"})
 		}
-		if err := analytics.DestroyAnalytics(projectID, region, true); err != nil {
-			utils.HandleGcloudError(err)
+	}
+	if withFirestore {
+		database, managed, err := deployedFirestoreDatabase(projectID, region)
+		if err != nil {
+			logger.Warnf("Unable to find the Firestore database of the deployment, it will not be deleted: %v", err)
+		} else if !managed {
+			logger.Infof("Keeping the Firestore database '%s', it was deployed with --skip-firestore.", database)
+		} else if utils.Instance != "" && database != (FirestoreOptions{}).database() {
+			logger.Infof("Keeping the Firestore database '%s', it may be shared with other instances.", database)
+		} else if exists, err := utils.FirestoreDatabaseExists(projectID, database); err != nil {
+			logger.Warnf("Unable to check for the Firestore database, it will not be deleted: %v", err)
+		} else if exists {
+			plan = append(plan, destroyItem{"firestore", database, "Firestore database"})
 		}
 	}
+	if !preserveData && selected("analytics") && analyticsExists(projectID) {
+		plan = append(plan, destroyItem{"analytics", "litmus_analytics", "BigQuery dataset and log sinks"})
+	}
+	return plan, nil
+}
 
-	if !quiet {
-		fmt.Println("\nResource destruction complete.")
+// deployedFirestoreDatabase returns the Firestore database the deployed API
+// service uses, from its FIRESTORE_DATABASE variable, and whether Litmus
+// manages it (see utils.FirestoreLabel). Deployments made before the database
+// was configurable use DefaultFirestoreDatabase and are managed.
+func deployedFirestoreDatabase(projectID, region string) (string, bool, error) {
+	apiService := utils.ResourceName("litmus-api")
+	output, err := utils.Command(
+		"gcloud", "run", "services", "describe", apiService,
+		"--project", projectID,
+		"--region", region,
+		"--format=json",
+	).Output()
+	if err != nil {
+		return "", false, fmt.Errorf("error describing Cloud Run service '%s': %v", apiService, err)
+	}
+
+	var service map[string]interface{}
+	if err := json.Unmarshal(output, &service); err != nil {
+		return "", false, fmt.Errorf("error parsing JSON output: %v", err)
+	}
+	database := serviceEnvVar(service, "FIRESTORE_DATABASE")
+	if database == "" {
+		database = DefaultFirestoreDatabase
+	}
+	metadata, _ := service["metadata"].(map[string]interface{})
+	labels, _ := metadata["labels"].(map[string]interface{})
+	return database, labels[utils.FirestoreLabel] != "external", nil
+}
+
+// analyticsExists reports whether the analytics dataset or either of its
+// log sinks exists.
+func analyticsExists(projectID string) bool {
+	if utils.Command("bq", "--project_id", projectID, "show", fmt.Sprintf("%s:litmus_analytics", projectID)).Run() == nil {
+		return true
+	}
+	for _, sink := range []string{"litmus-proxy-sink", "litmus-core-sink"} {
+		if utils.Command("gcloud", "logging", "sinks", "describe", sink, "--project", projectID).Run() == nil {
+			return true
+		}
 	}
-}
\ No newline at end of file
+	return false
+}
@@ -0,0 +1,129 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/litmus/cli/utils"
+)
+
+// apiServiceJSON returns the gcloud run services describe output of an API
+// service with the given FIRESTORE_DATABASE and litmus-firestore label.
+func apiServiceJSON(database, label string) string {
+	env := "[]"
+	if database != "" {
+		env = fmt.Sprintf(`[{"name": "FIRESTORE_DATABASE", "value": %q}]`, database)
+	}
+	labels := "{}"
+	if label != "" {
+		labels = fmt.Sprintf(`{"litmus-firestore": %q}`, label)
+	}
+	return fmt.Sprintf(`{
+  "metadata": {"name": "litmus-api", "labels": %s},
+  "spec": {"template": {"spec": {"containers": [{"env": %s}]}}}
+}`, labels, env)
+}
+
+func TestPlanDestroyFirestore(t *testing.T) {
+	tests := []struct {
+		name      string
+		instance  string
+		service   string // Describe output, empty if the service is missing
+		databases string // Firestore databases in the project
+		want      []destroyItem
+	}{
+		{
+			name:      "named database",
+			service:   apiServiceJSON("litmus-db", "managed"),
+			databases: "projects/my-proj/databases/(default)\nprojects/my-proj/databases/litmus-db\n",
+			want:      []destroyItem{{"firestore", "litmus-db", "Firestore database"}},
+		},
+		{
+			name:      "default database",
+			service:   apiServiceJSON("(default)", "managed"),
+			databases: "projects/my-proj/databases/(default)\n",
+			want:      []destroyItem{{"firestore", "(default)", "Firestore database"}},
+		},
+		{
+			name:      "deployed before the label",
+			service:   apiServiceJSON("", ""),
+			databases: "projects/my-proj/databases/(default)\n",
+			want:      []destroyItem{{"firestore", "(default)", "Firestore database"}},
+		},
+		{
+			name:      "skipped firestore",
+			service:   apiServiceJSON("shared-db", "external"),
+			databases: "projects/my-proj/databases/shared-db\n",
+		},
+		{
+			name:      "database already deleted",
+			service:   apiServiceJSON("litmus-db", "managed"),
+			databases: "projects/my-proj/databases/(default)\n",
+		},
+		{
+			name:      "instance database",
+			instance:  "staging",
+			service:   apiServiceJSON("litmus-staging", "managed"),
+			databases: "projects/my-proj/databases/(default)\nprojects/my-proj/databases/litmus-staging\n",
+			want:      []destroyItem{{"firestore", "litmus-staging", "Firestore database"}},
+		},
+		{
+			name:      "instance on a shared database",
+			instance:  "staging",
+			service:   apiServiceJSON("(default)", "managed"),
+			databases: "projects/my-proj/databases/(default)\n",
+		},
+		{
+			name:      "service missing",
+			databases: "projects/my-proj/databases/(default)\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saved := utils.Instance
+			t.Cleanup(func() { utils.Instance = saved })
+			utils.Instance = tt.instance
+
+			fakeCommands(t, func(args []string) (string, int) {
+				switch strings.Join(args[:4], " ") {
+				case "gcloud run services describe":
+					if tt.service == "" {
+						return "ERROR: Cannot find service [litmus-api]", 1
+					}
+					return tt.service, 0
+				case "gcloud firestore databases list":
+					return tt.databases, 0
+				}
+				t.Errorf("unexpected command %v", args)
+				return "", 1
+			})
+
+			// Only the Firestore database is planned without any other group
+			none := func(string) bool { return false }
+			plan, err := planDestroy("my-proj", "europe-west4", none, true, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(plan, tt.want) {
+				t.Errorf("plan = %v, want %v", plan, tt.want)
+			}
+		})
+	}
+}
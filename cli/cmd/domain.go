@@ -0,0 +1,144 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/litmus/cli/utils"
+)
+
+// domainRegex matches a fully qualified domain name such as litmus.example.com.
+var domainRegex = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,63}$`)
+
+// MapDomain creates a Cloud Run domain mapping for the 'litmus-api' service
+// and prints the DNS records that must be added for it. The domain is stored
+// in Secret Manager so that status and open can use it once it is active.
+func MapDomain(projectID, region, domain string, quiet bool) error {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	if !domainRegex.MatchString(domain) {
+		return fmt.Errorf("invalid domain '%s': expected a domain name such as litmus.example.com", domain)
+	}
+
+	if !quiet {
+		confirmed, err := utils.ConfirmPrompt(fmt.Sprintf("\nThis will map the domain '%s' to the Litmus API in the project '%s' and region '%s'. Are you sure you want to continue?", domain, projectID, region))
+		if err != nil {
+			return err
+		}
+		if !confirmed {
+			fmt.Println("\nAborting domain mapping.")
+			return nil
+		}
+	}
+
+	createCmd := utils.Command(
+		"gcloud", "beta", "run", "domain-mappings", "create",
+		"--service", utils.ResourceName("litmus-api"),
+		"--domain", domain,
+		"--project", projectID,
+		"--region", region,
+	)
+	output, err := createCmd.CombinedOutput()
+	if err != nil {
+		if !strings.Contains(string(output), "already exists") {
+			return fmt.Errorf("error creating domain mapping: %v\nOutput: %s", err, output)
+		}
+		if !quiet {
+			fmt.Printf("Domain mapping for '%s' already exists.\n", domain)
+		}
+	}
+
+	if err := utils.CreateOrUpdateSecret(projectID, utils.ResourceName("litmus-domain"), domain, true); err != nil {
+		return fmt.Errorf("error storing domain in Secret Manager: %w", err)
+	}
+
+	records, err := domainMappingRecords(projectID, region, domain)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\nAdd the following DNS records for '%s' at your DNS provider:\n", domain)
+	for _, record := range records {
+		fmt.Printf("  %-6s %-30s %s\n", record.Type, record.Name, record.Rrdata)
+	}
+	fmt.Println("\nThe certificate is issued once the records resolve, which can take a while.")
+	fmt.Println("Until then, 'litmus status' and 'litmus open' keep using the default URL.")
+	return nil
+}
+
+// dnsRecord is a DNS record required by a Cloud Run domain mapping.
+type dnsRecord struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Rrdata string `json:"rrdata"`
+}
+
+// domainMappingRecords returns the DNS records of a domain mapping.
+func domainMappingRecords(projectID, region, domain string) ([]dnsRecord, error) {
+	output, err := utils.Command(
+		"gcloud", "beta", "run", "domain-mappings", "describe",
+		"--domain", domain,
+		"--project", projectID,
+		"--region", region,
+		"--format=json(status.resourceRecords)",
+	).Output()
+	if err != nil {
+		return nil, fmt.Errorf("error describing domain mapping: %v", err)
+	}
+
+	var mapping struct {
+		Status struct {
+			ResourceRecords []dnsRecord `json:"resourceRecords"`
+		} `json:"status"`
+	}
+	if err := json.Unmarshal(output, &mapping); err != nil {
+		return nil, fmt.Errorf("error parsing domain mapping: %v", err)
+	}
+	for i := range mapping.Status.ResourceRecords {
+		if mapping.Status.ResourceRecords[i].Name == "" {
+			mapping.Status.ResourceRecords[i].Name = domain
+		}
+	}
+	return mapping.Status.ResourceRecords, nil
+}
+
+// resolveServiceURL returns the URL to reach Litmus: the mapped custom domain
+// if one is configured and serving, otherwise the default Cloud Run URL.
+func resolveServiceURL(projectID string) (string, error) {
+	serviceURL, err := utils.AccessServiceURL(projectID)
+	if err != nil {
+		return "", err
+	}
+
+	domain, err := utils.AccessSecret(projectID, utils.ResourceName("litmus-domain"))
+	if err != nil || domain == "" {
+		return serviceURL, nil
+	}
+	domainURL := "https://" + utils.RemoveAnsiEscapeSequences(domain)
+
+	// The mapping is active once DNS resolves and the certificate is issued
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Head(domainURL)
+	if err != nil {
+		return serviceURL, nil
+	}
+	resp.Body.Close()
+	return domainURL, nil
+}
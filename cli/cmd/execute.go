@@ -19,35 +19,66 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
+	"os"
+	"strings"
 
 	"github.com/google/litmus/cli/utils"
 )
 
-// ExecutePayload sends a payload to the deployed Litmus endpoint.
-func ExecutePayload(projectID, payload string) {
-	serviceURL, err := utils.AccessSecret(projectID, "litmus-service-url")
+// ReadPayload reads an execute payload from r, e.g. stdin or a file named by
+// source. Valid JSON is sent as is, anything else as a string without its
+// trailing newline. An empty input is an error rather than an empty request.
+func ReadPayload(r io.Reader, source string) (interface{}, error) {
+	data, err := io.ReadAll(r)
 	if err != nil {
-		log.Fatalf("Error retrieving service URL from Secret Manager: %v", err)
+		return nil, fmt.Errorf("error reading payload from %s: %v", source, err)
 	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, fmt.Errorf("no payload in %s: the input is empty", source)
+	}
+	if json.Valid(data) {
+		return json.RawMessage(bytes.TrimSpace(data)), nil
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
 
-	requestBody, err := json.Marshal(map[string]string{
+// ExecutePayload sends a payload to the deployed Litmus endpoint. payload is
+// a string or, as returned by ReadPayload, a json.RawMessage. With stream
+// set, the response body is written to stdout as it arrives instead of being
+// buffered, so streaming responses render live.
+func ExecutePayload(projectID string, payload interface{}, stream bool) error {
+	serviceURL, err := utils.AccessServiceURL(projectID)
+	if err != nil {
+		return fmt.Errorf("error retrieving service URL from Secret Manager: %v", err)
+	}
+
+	requestBody, err := json.Marshal(map[string]interface{}{
 		"message": payload,
 	})
 	if err != nil {
-		log.Fatalf("Error marshaling JSON: %v", err)
+		return fmt.Errorf("error marshaling JSON: %v", err)
 	}
 
 	resp, err := http.Post(serviceURL, "application/json", bytes.NewBuffer(requestBody))
 	if err != nil {
-		log.Fatalf("Error sending request: %v", err)
+		return fmt.Errorf("error sending request: %v", err)
 	}
 	defer resp.Body.Close()
 
+	if stream {
+		// os.Stdout is unbuffered, so each chunk is printed as soon as it is read
+		if _, err := io.Copy(os.Stdout, resp.Body); err != nil {
+			return fmt.Errorf("error streaming response body: %v", err)
+		}
+		fmt.Println()
+		return nil
+	}
+
 	responseBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		log.Fatalf("Error reading response body: %v", err)
+		return fmt.Errorf("error reading response body: %v", err)
 	}
 	fmt.Println("Response:", string(responseBody))
-}
\ No newline at end of file
+	return nil
+}
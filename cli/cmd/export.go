@@ -0,0 +1,182 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/google/litmus/cli/api"
+)
+
+// exportFormatVersion is the version of the export archive layout. Bump it
+// whenever the layout changes so that import can reject or convert old archives.
+//
+// Layout (all files are JSON):
+//
+//	manifest.json            exportManifest
+//	templates/<id>.json      template as returned by GET /templates/<id>, with template_id
+//	runs/index.json          run list as returned by GET /runs/ ([]api.RunInfo)
+//	runs/<id>.json           run details as returned by GET /runs/status/<id>
+const exportFormatVersion = 1
+
+// exportManifest describes the contents of an export archive.
+type exportManifest struct {
+	Format    string   `json:"format"`
+	Version   int      `json:"version"`
+	CreatedAt string   `json:"created_at"`
+	ProjectID string   `json:"project_id"`
+	Templates []string `json:"templates"`
+	Runs      []string `json:"runs"`
+}
+
+// ExportData writes all templates and runs of a Litmus deployment to a
+// gzipped tar archive.
+func ExportData(projectID, outputPath string, quiet bool) error {
+	if outputPath == "" {
+		outputPath = "litmus-backup.tar.gz"
+	}
+
+	manifest := exportManifest{
+		Format:    "litmus-export",
+		Version:   exportFormatVersion,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+		ProjectID: projectID,
+	}
+	files := make(map[string][]byte)
+
+	// --- Templates ---
+	body, err := apiRequest(projectID, "GET", "/templates/", nil)
+	if err != nil {
+		return fmt.Errorf("error listing templates: %w", err)
+	}
+	var templateList struct {
+		Templates []api.TemplateInfo `json:"templates"`
+	}
+	if err := json.Unmarshal(body, &templateList); err != nil {
+		return fmt.Errorf("error decoding templates: %w", err)
+	}
+	for _, info := range templateList.Templates {
+		body, err := apiRequest(projectID, "GET", "/templates/"+url.PathEscape(info.TemplateID), nil)
+		if err != nil {
+			return fmt.Errorf("error exporting template '%s': %w", info.TemplateID, err)
+		}
+		var template map[string]interface{}
+		if err := json.Unmarshal(body, &template); err != nil {
+			return fmt.Errorf("error decoding template '%s': %w", info.TemplateID, err)
+		}
+		template["template_id"] = info.TemplateID
+		data, err := json.MarshalIndent(template, "", "  ")
+		if err != nil {
+			return fmt.Errorf("error encoding template '%s': %w", info.TemplateID, err)
+		}
+		files["templates/"+info.TemplateID+".json"] = data
+		manifest.Templates = append(manifest.Templates, info.TemplateID)
+	}
+
+	// --- Runs ---
+	body, err = apiRequest(projectID, "GET", "/runs/", nil)
+	if err != nil {
+		return fmt.Errorf("error listing runs: %w", err)
+	}
+	var runList struct {
+		Runs []api.RunInfo `json:"runs"`
+	}
+	if err := json.Unmarshal(body, &runList); err != nil {
+		return fmt.Errorf("error decoding runs: %w", err)
+	}
+	data, err := json.MarshalIndent(runList.Runs, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding runs: %w", err)
+	}
+	files["runs/index.json"] = data
+	for _, run := range runList.Runs {
+		body, err := apiRequest(projectID, "GET", "/runs/status/"+url.PathEscape(run.RunID), nil)
+		if err != nil {
+			return fmt.Errorf("error exporting run '%s': %w", run.RunID, err)
+		}
+		files["runs/"+run.RunID+".json"] = body
+		manifest.Runs = append(manifest.Runs, run.RunID)
+	}
+
+	data, err = json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding manifest: %w", err)
+	}
+	files["manifest.json"] = data
+
+	if err := writeArchive(outputPath, files); err != nil {
+		return err
+	}
+
+	if !quiet {
+		fmt.Printf("Exported %d templates and %d runs to %s\n", len(manifest.Templates), len(manifest.Runs), outputPath)
+	}
+	return nil
+}
+
+// writeArchive writes files to a gzipped tar archive, manifest first.
+func writeArchive(outputPath string, files map[string][]byte) (err error) {
+	file, err := os.Create(outputPath)
+	if err != nil {
+		return fmt.Errorf("error creating archive: %w", err)
+	}
+	defer func() {
+		if closeErr := file.Close(); err == nil && closeErr != nil {
+			err = fmt.Errorf("error writing archive: %w", closeErr)
+		}
+	}()
+
+	gzipWriter := gzip.NewWriter(file)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	names := []string{"manifest.json"}
+	for name := range files {
+		if name != "manifest.json" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names[1:])
+
+	now := time.Now()
+	for _, name := range names {
+		header := &tar.Header{
+			Name:    name,
+			Mode:    0644,
+			Size:    int64(len(files[name])),
+			ModTime: now,
+		}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return fmt.Errorf("error writing archive: %w", err)
+		}
+		if _, err := tarWriter.Write(files[name]); err != nil {
+			return fmt.Errorf("error writing archive: %w", err)
+		}
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		return fmt.Errorf("error writing archive: %w", err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return fmt.Errorf("error writing archive: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/litmus/cli/utils"
+)
+
+// gcloudResponder returns the output and exit code of a faked command.
+type gcloudResponder func(args []string) (string, int)
+
+// fakeCommands replaces the commands started by utils.Command with a helper
+// process answering as respond says, and returns the command lines it ran.
+func fakeCommands(t *testing.T, respond gcloudResponder) func() [][]string {
+	t.Helper()
+	var mu sync.Mutex
+	var calls [][]string
+
+	saved := utils.ExecCommand
+	t.Cleanup(func() { utils.ExecCommand = saved })
+	utils.ExecCommand = func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+		args := append([]string{name}, arg...)
+		mu.Lock()
+		calls = append(calls, args)
+		mu.Unlock()
+
+		output, exitCode := respond(args)
+		cmd := exec.CommandContext(ctx, os.Args[0], "-test.run=TestHelperProcess")
+		cmd.Env = append(os.Environ(),
+			"LITMUS_HELPER_PROCESS=1",
+			"LITMUS_HELPER_OUTPUT="+output,
+			"LITMUS_HELPER_EXIT="+strconv.Itoa(exitCode),
+		)
+		return cmd
+	}
+
+	return func() [][]string {
+		mu.Lock()
+		defer mu.Unlock()
+		return calls
+	}
+}
+
+// TestHelperProcess is the fake command started by fakeCommands.
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("LITMUS_HELPER_PROCESS") != "1" {
+		return
+	}
+	fmt.Print(os.Getenv("LITMUS_HELPER_OUTPUT"))
+	exitCode, _ := strconv.Atoi(os.Getenv("LITMUS_HELPER_EXIT"))
+	os.Exit(exitCode)
+}
+
+// flagValue returns the value following flag in args.
+func flagValue(args []string, flag string) (string, bool) {
+	for i, arg := range args {
+		if arg == flag && i+1 < len(args) {
+			return args[i+1], true
+		}
+		if value, ok := strings.CutPrefix(arg, flag+"="); ok {
+			return value, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,160 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/google/litmus/cli/api"
+)
+
+// ImportData recreates the templates of an archive written by ExportData in
+// the target deployment. onConflict is "skip" (default) or "overwrite" and
+// decides what happens to templates that already exist.
+func ImportData(projectID, inputPath, onConflict string, quiet bool) error {
+	if inputPath == "" {
+		return fmt.Errorf("an archive is required (--input litmus-backup.tar.gz)")
+	}
+	if onConflict == "" {
+		onConflict = "skip"
+	}
+	if onConflict != "skip" && onConflict != "overwrite" {
+		return fmt.Errorf("invalid --on-conflict '%s': must be 'skip' or 'overwrite'", onConflict)
+	}
+
+	files, err := readArchive(inputPath)
+	if err != nil {
+		return err
+	}
+
+	var manifest exportManifest
+	if err := json.Unmarshal(files["manifest.json"], &manifest); err != nil || manifest.Format != "litmus-export" {
+		return fmt.Errorf("'%s' is not a Litmus export archive", inputPath)
+	}
+	if manifest.Version > exportFormatVersion {
+		return fmt.Errorf("archive format version %d is newer than supported version %d, please update the Litmus CLI", manifest.Version, exportFormatVersion)
+	}
+
+	// Find the templates that already exist in the target deployment
+	body, err := apiRequest(projectID, "GET", "/templates/", nil)
+	if err != nil {
+		return fmt.Errorf("error listing templates: %w", err)
+	}
+	var templateList struct {
+		Templates []api.TemplateInfo `json:"templates"`
+	}
+	if err := json.Unmarshal(body, &templateList); err != nil {
+		return fmt.Errorf("error decoding templates: %w", err)
+	}
+	existing := make(map[string]bool)
+	for _, template := range templateList.Templates {
+		existing[template.TemplateID] = true
+	}
+
+	created, updated, skipped, failed := 0, 0, 0, 0
+	for _, templateID := range manifest.Templates {
+		data, ok := files["templates/"+templateID+".json"]
+		if !ok {
+			fmt.Printf("Failed  %s: missing from archive\n", templateID)
+			failed++
+			continue
+		}
+
+		if problems := validateTemplate(data); len(problems) > 0 {
+			fmt.Printf("Failed  %s: invalid template (%s: %s)\n", templateID, problems[0].Field, problems[0].Message)
+			failed++
+			continue
+		}
+
+		switch {
+		case existing[templateID] && onConflict == "skip":
+			if !quiet {
+				fmt.Printf("Skipped %s: already exists\n", templateID)
+			}
+			skipped++
+		case existing[templateID]:
+			if _, err := apiRequest(projectID, "PUT", "/templates/update", data); err != nil {
+				fmt.Printf("Failed  %s: %v\n", templateID, err)
+				failed++
+				continue
+			}
+			if !quiet {
+				fmt.Printf("Updated %s\n", templateID)
+			}
+			updated++
+		default:
+			if _, err := apiRequest(projectID, "POST", "/templates/add", data); err != nil {
+				fmt.Printf("Failed  %s: %v\n", templateID, err)
+				failed++
+				continue
+			}
+			if !quiet {
+				fmt.Printf("Created %s\n", templateID)
+			}
+			created++
+		}
+	}
+
+	fmt.Printf("\nImported templates from %s: %d created, %d updated, %d skipped, %d failed\n", inputPath, created, updated, skipped, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d template(s) failed to import", failed)
+	}
+	return nil
+}
+
+// readArchive reads all regular files of a gzipped tar archive into memory.
+func readArchive(inputPath string) (map[string][]byte, error) {
+	file, err := os.Open(inputPath)
+	if err != nil {
+		return nil, fmt.Errorf("error opening archive: %w", err)
+	}
+	defer file.Close()
+
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading archive: %w", err)
+	}
+	defer gzipReader.Close()
+
+	files := make(map[string][]byte)
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading archive: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := path.Clean(strings.TrimPrefix(header.Name, "./"))
+		data, err := io.ReadAll(tarReader)
+		if err != nil {
+			return nil, fmt.Errorf("error reading '%s' from archive: %w", header.Name, err)
+		}
+		files[name] = data
+	}
+	return files, nil
+}
@@ -0,0 +1,237 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/litmus/cli/logger"
+	"github.com/google/litmus/cli/utils"
+)
+
+// inventoryItem is a Litmus resource found in the project.
+type inventoryItem struct {
+	Category string `json:"category"`
+	Name     string `json:"name"`
+	Location string `json:"location,omitempty"`
+	Created  string `json:"created,omitempty"`
+}
+
+// inventoryCategory lists the resources of one kind.
+type inventoryCategory struct {
+	name string
+	list func(projectID string) ([]inventoryItem, error)
+}
+
+// inventoryCategories are listed in the order destroy deletes them. Resources
+// are matched by the litmus-managed label where the resource type has labels,
+// and by name otherwise or when deployed before labels were set, so all
+// instances and leftovers of failed deploys show up.
+var inventoryCategories = []inventoryCategory{
+	{"Cloud Run services", listRunResources("services", "litmus-")},
+	{"Cloud Run jobs", listRunResources("jobs", "litmus-worker")},
+	{"Secrets", listSecrets},
+	{"Service accounts", listServiceAccounts},
+	{"Buckets", listBuckets},
+	{"BigQuery datasets", listDatasets},
+	{"Log sinks", listLogSinks},
+}
+
+// ListAllResources prints every Litmus resource in the project, grouped by
+// kind, without changing anything. Proxies are listed with the Cloud Run
+// services. With asJSON, the resources are printed as a JSON array.
+func ListAllResources(projectID string, asJSON bool) error {
+	var items []inventoryItem
+	for _, category := range inventoryCategories {
+		found, err := category.list(projectID)
+		if err != nil {
+			logger.Warnf("Unable to list %s: %v", strings.ToLower(category.name), err)
+			continue
+		}
+		for _, item := range found {
+			item.Category = category.name
+			items = append(items, item)
+		}
+	}
+
+	if asJSON {
+		if items == nil {
+			items = []inventoryItem{}
+		}
+		data, err := json.MarshalIndent(items, "", "  ")
+		if err != nil {
+			return fmt.Errorf("error encoding resources: %w", err)
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	if len(items) == 0 {
+		fmt.Printf("No Litmus resources found in project '%s'.\n", projectID)
+		return nil
+	}
+	fmt.Printf("Litmus resources in project '%s':\n", projectID)
+	category := ""
+	for _, item := range items {
+		if item.Category != category {
+			category = item.Category
+			fmt.Printf("\n%s:\n", category)
+		}
+		line := "  " + item.Name
+		if item.Location != "" {
+			line += fmt.Sprintf(" (%s)", item.Location)
+		}
+		if item.Created != "" {
+			line += ", created " + item.Created
+		}
+		fmt.Println(line)
+	}
+	return nil
+}
+
+// listRunResources returns a lister for Cloud Run services or jobs in all
+// regions, matching the litmus-managed label or the name prefix.
+func listRunResources(resourceType, namePrefix string) func(string) ([]inventoryItem, error) {
+	return func(projectID string) ([]inventoryItem, error) {
+		output, err := utils.Command(
+			"gcloud", "run", resourceType, "list",
+			"--project", projectID,
+			"--filter", fmt.Sprintf("metadata.labels.%s=true OR metadata.name ~ ^%s", utils.ManagedLabel, namePrefix),
+			"--format=json",
+		).Output()
+		if err != nil {
+			return nil, err
+		}
+
+		var resources []struct {
+			Metadata struct {
+				Name              string            `json:"name"`
+				CreationTimestamp string            `json:"creationTimestamp"`
+				Labels            map[string]string `json:"labels"`
+			} `json:"metadata"`
+		}
+		if err := json.Unmarshal(output, &resources); err != nil {
+			return nil, fmt.Errorf("error parsing JSON output: %w", err)
+		}
+
+		var items []inventoryItem
+		for _, resource := range resources {
+			items = append(items, inventoryItem{
+				Name:     resource.Metadata.Name,
+				Location: resource.Metadata.Labels["cloud.googleapis.com/location"],
+				Created:  resource.Metadata.CreationTimestamp,
+			})
+		}
+		return items, nil
+	}
+}
+
+// listSecrets returns the secrets Litmus stores, for all instances.
+func listSecrets(projectID string) ([]inventoryItem, error) {
+	return listValues(utils.Command(
+		"gcloud", "secrets", "list",
+		"--project", projectID,
+		"--filter", "name ~ /secrets/litmus-(password|service-url|domain)",
+		"--format=value(name.basename(),createTime)",
+	).Output())
+}
+
+// listServiceAccounts returns the API and worker service accounts, for all
+// instances. Service accounts have no creation time.
+func listServiceAccounts(projectID string) ([]inventoryItem, error) {
+	return listValues(utils.Command(
+		"gcloud", "iam", "service-accounts", "list",
+		"--project", projectID,
+		"--filter", fmt.Sprintf("email ~ ^%s-(api|worker)", projectID),
+		"--format=value(email)",
+	).Output())
+}
+
+// listBuckets returns the files and analytics buckets.
+func listBuckets(projectID string) ([]inventoryItem, error) {
+	return listValues(utils.Command(
+		"gcloud", "storage", "buckets", "list",
+		"--project", projectID,
+		"--filter", fmt.Sprintf("labels.%s=true OR name ~ ^%s-litmus-", utils.ManagedLabel, projectID),
+		"--format=value(name,creation_time)",
+	).Output())
+}
+
+// listDatasets returns the analytics datasets. The bq tool lists datasets
+// without their creation time.
+func listDatasets(projectID string) ([]inventoryItem, error) {
+	output, err := utils.Command("bq", "--project_id", projectID, "ls", "--format=json").Output()
+	if err != nil {
+		return nil, err
+	}
+	// bq prints nothing when the project has no datasets
+	if len(strings.TrimSpace(string(output))) == 0 {
+		return nil, nil
+	}
+
+	var datasets []struct {
+		DatasetReference struct {
+			DatasetID string `json:"datasetId"`
+		} `json:"datasetReference"`
+		Location string            `json:"location"`
+		Labels   map[string]string `json:"labels"`
+	}
+	if err := json.Unmarshal(output, &datasets); err != nil {
+		return nil, fmt.Errorf("error parsing JSON output: %w", err)
+	}
+
+	var items []inventoryItem
+	for _, dataset := range datasets {
+		id := dataset.DatasetReference.DatasetID
+		if dataset.Labels[utils.ManagedLabel] != "true" && !strings.HasPrefix(id, "litmus_") {
+			continue
+		}
+		items = append(items, inventoryItem{Name: id, Location: dataset.Location})
+	}
+	return items, nil
+}
+
+// listLogSinks returns the analytics log sinks.
+func listLogSinks(projectID string) ([]inventoryItem, error) {
+	return listValues(utils.Command(
+		"gcloud", "logging", "sinks", "list",
+		"--project", projectID,
+		"--filter", "name ~ ^litmus-",
+		"--format=value(name,createTime)",
+	).Output())
+}
+
+// listValues parses gcloud value() output with the name and, optionally, the
+// creation time on each line.
+func listValues(output []byte, err error) ([]inventoryItem, error) {
+	if err != nil {
+		return nil, err
+	}
+	var items []inventoryItem
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		item := inventoryItem{Name: fields[0]}
+		if len(fields) > 1 {
+			item.Created = fields[1]
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
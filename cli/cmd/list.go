@@ -15,62 +15,30 @@
 package cmd
 
 import (
-	"encoding/json"
 	"fmt"
-	"log"
-	"net/http"
 
-	"github.com/google/litmus/cli/api"
-	"github.com/google/litmus/cli/utils"
+	"github.com/google/litmus/cli/client"
 )
 
-// ListRuns retrieves and displays a list of Litmus runs.
-func ListRuns(projectID string) error {
-	serviceURL, err := utils.AccessSecret(projectID, "litmus-service-url")
+// ListRuns retrieves and displays the Litmus runs selected by filter.
+func ListRuns(projectID string, filter client.RunFilter) error {
+	c, err := newClient(projectID)
 	if err != nil {
-		log.Fatalf("Error retrieving service URL from Secret Manager: %v", err)
+		return err
 	}
 
-	serviceURL = utils.RemoveAnsiEscapeSequences(serviceURL) 
-
-	username, password, err := utils.GetAuthCredentials(projectID)
-	if err != nil {
-		return fmt.Errorf("error getting authentication credentials: %w", err)
-	}
-
-	// Create HTTP client
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", serviceURL+"/runs/", nil)
-	if err != nil {
-		return fmt.Errorf("error creating request: %w", err)
-	}
-
-	// Set basic auth header
-	req.SetBasicAuth(username, password)
-
-	resp, err := client.Do(req)
+	runs, err := c.ListRuns(filter)
 	if err != nil {
-		log.Fatalf("Error sending request: %v", err)
-	}
-	defer resp.Body.Close()
-
-	// Decode the response into a struct that matches the API response
-	var response struct {
-		Runs []api.RunInfo `json:"runs"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		log.Fatalf("Error decoding response: %v", err)
+		return err
 	}
 
-	runs := response.Runs // Access the runs slice from the decoded response
-
 	if len(runs) == 0 {
 		fmt.Println("No runs found.")
 	} else {
 		fmt.Println("Runs:")
 		for _, run := range runs {
-			fmt.Printf("Run ID: %s, Status: %s, Progress: %s, StartTime: %s, URL: %s/#/runs/%s\n", run.RunID, run.Status, run.Progress, run.StartTime, serviceURL, run.RunID)
+			fmt.Printf("Run ID: %s, Status: %s, Progress: %s, StartTime: %s, URL: %s/#/runs/%s\n", run.RunID, run.Status, run.Progress, run.StartTime, c.ServiceURL(), run.RunID)
 		}
 	}
 	return nil
-}
\ No newline at end of file
+}
@@ -15,52 +15,101 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
-	"log"
 	"net/url"
-	"os/exec"
-	"runtime"
 
 	"github.com/google/litmus/cli/utils"
 )
 
 // OpenLitmus opens the Litmus application in a browser,
 // including the username and password in the URL.
-func OpenLitmus(projectID string) {
+func OpenLitmus(projectID string) error {
 	ShowStatus(projectID) // First, show the status so the user knows the credentials
 
-	serviceURL, _ := utils.AccessSecret(projectID, "litmus-service-url")
+	serviceURL, _ := resolveServiceURL(projectID)
 	username := "admin"
-	password, _ := utils.AccessSecret(projectID, "litmus-password")
+	password, _ := utils.AccessSecret(projectID, utils.ResourceName("litmus-password"))
 
-	noAServiceURL := utils.RemoveAnsiEscapeSequences(serviceURL)
-
-	parsedURL, err := url.Parse(noAServiceURL)
+	parsedURL, err := url.Parse(serviceURL)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("error parsing service URL: %w", err)
 	}
 
 	parsedURL.User = url.UserPassword(username, password)
 
 	finalURL := parsedURL.String()
-	openBrowser(finalURL)
+	return utils.OpenBrowser(finalURL)
 }
 
-// openBrowser opens the specified URL in the default browser.
-func openBrowser(url string) {
-	var err error
-
-	switch runtime.GOOS {
-	case "linux":
-		err = exec.Command("xdg-open", url).Start()
-	case "windows":
-		err = exec.Command("rundll32", "url.dll,FileProtocolHandler", url).Start()
-	case "darwin":
-		err = exec.Command("open", url).Start()
-	default:
-		err = fmt.Errorf("unsupported platform")
+// OpenProxy prints the URL of a deployed Litmus proxy and opens it in a
+// browser, unless printOnly is set. For Vertex AI proxies, an example request
+// through the proxy is printed first.
+func OpenProxy(projectID, region, serviceName string, printOnly bool) error {
+	if serviceName == "" {
+		return fmt.Errorf("a proxy service name is required")
+	}
+
+	if projectID == "" {
+		var err error
+		projectID, err = utils.GetDefaultProjectID()
+		if err != nil {
+			return err
+		}
+	}
+
+	if region == "" {
+		region = utils.DefaultRegion
 	}
+
+	service, proxyURL, err := describeProxy(projectID, region, serviceName)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-}
\ No newline at end of file
+
+	upstreamURL := serviceEnvVar(service, "UPSTREAM_URL")
+	vertexRegion, isVertex := utils.VertexRegion(upstreamURL)
+
+	fmt.Println(proxyURL)
+	if isVertex {
+		fmt.Println("\nThis proxy forwards to Vertex AI. Send requests under a litmus-context- path prefix to group them, e.g.:")
+		fmt.Printf(`
+  curl -X POST "%s/litmus-context-my-run/v1/projects/%s/locations/%s/publishers/google/models/gemini-1.5-flash-002:generateContent" \
+    -H "Authorization: Bearer $(gcloud auth print-access-token)" \
+    -H "Content-Type: application/json" \
+    -H "X-Litmus-Request: my-request-id" \
+    -d '{"contents": [{"role": "user", "parts": [{"text": "Hello"}]}]}'
+`, proxyURL, projectID, vertexRegion)
+	}
+
+	if printOnly {
+		return nil
+	}
+	return utils.OpenBrowser(proxyURL)
+}
+
+// describeProxy returns the JSON description of a proxy's Cloud Run service
+// and its URL.
+func describeProxy(projectID, region, serviceName string) (map[string]interface{}, string, error) {
+	describeCmd := utils.Command(
+		"gcloud", "run", "services", "describe", serviceName,
+		"--project", projectID,
+		"--region", region,
+		"--format=json",
+	)
+	output, err := describeCmd.Output()
+	if err != nil {
+		return nil, "", fmt.Errorf("error describing Cloud Run service '%s': %v", serviceName, err)
+	}
+
+	var service map[string]interface{}
+	if err := json.Unmarshal(output, &service); err != nil {
+		return nil, "", fmt.Errorf("error parsing JSON output: %v", err)
+	}
+	status, _ := service["status"].(map[string]interface{})
+	proxyURL, _ := status["url"].(string)
+	if proxyURL == "" {
+		return nil, "", fmt.Errorf("Cloud Run service '%s' has no URL yet", serviceName)
+	}
+	return service, proxyURL, nil
+}
@@ -0,0 +1,54 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+// openProxyServiceJSON is the gcloud run services describe output for a
+// proxy in front of a non-Vertex upstream.
+const openProxyServiceJSON = `{
+  "metadata": {"name": "my-proxy"},
+  "spec": {"template": {"spec": {"containers": [{"env": [{"name": "UPSTREAM_URL", "value": "https://api.example.com"}]}]}}},
+  "status": {"url": "https://my-proxy.a.run.app"}
+}`
+
+func TestOpenProxyUsesRegion(t *testing.T) {
+	const region = "europe-west4"
+
+	calls := fakeCommands(t, func(args []string) (string, int) {
+		if got, _ := flagValue(args, "--region"); got != region {
+			return "not found", 1
+		}
+		return openProxyServiceJSON, 0
+	})
+
+	if err := OpenProxy("my-proj", region, "my-proxy", true); err != nil {
+		t.Fatal(err)
+	}
+
+	ran := calls()
+	if len(ran) != 1 {
+		t.Fatalf("ran %d commands, want the service lookup: %v", len(ran), ran)
+	}
+	if got, ok := flagValue(ran[0], "--region"); !ok || got != region {
+		t.Errorf("%s ran with --region %q, want %q", strings.Join(ran[0], " "), got, region)
+	}
+	if got, _ := flagValue(ran[0], "--project"); got != "my-proj" {
+		t.Errorf("%s ran with --project %q, want my-proj", strings.Join(ran[0], " "), got)
+	}
+}
@@ -18,7 +18,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"math/rand"
-	"os/exec"
 	"regexp"
 	"strings"
 	"time"
@@ -27,6 +26,17 @@ import (
 	"github.com/google/litmus/cli/utils"
 )
 
+// proxyLabels are set on every proxy deployed by the CLI. Proxies are
+// discovered by these labels rather than by name, so list and destroy-all
+// never touch unrelated services, including the litmus-managed API service.
+const proxyLabels = "litmus-component=proxy,litmus-managed=true"
+
+// proxyImage is the proxy container image, without a tag.
+const proxyImage = "europe-docker.pkg.dev/litmusai-prod/litmus/proxy"
+
+// serviceNameRegex matches valid Cloud Run service names.
+var serviceNameRegex = regexp.MustCompile(`^[a-z]([a-z0-9-]{0,47}[a-z0-9])?$`)
+
 // ProxyService represents a deployed Litmus proxy Cloud Run service.
 type ProxyService struct {
 	Name        string
@@ -36,22 +46,33 @@ type ProxyService struct {
 	URL         string
 }
 
-// DeployProxy deploys a Litmus proxy to Google Cloud Run.
-func DeployProxy(projectID, region, upstreamURL string, quiet bool) error {
+// DeployProxy deploys a Litmus proxy to Google Cloud Run. If serviceName is
+// empty, a name is generated from the upstream URL.
+func DeployProxy(projectID, region, upstreamURL, serviceName string, quiet bool) error {
+	if serviceName != "" && !serviceNameRegex.MatchString(serviceName) {
+		return fmt.Errorf("invalid service name '%s': must be at most 49 lowercase letters, digits or hyphens, start with a letter and not end with a hyphen", serviceName)
+	}
+
 	if projectID == "" {
 		var err error
 		projectID, err = utils.GetDefaultProjectID()
 		if err != nil {
-			utils.HandleGcloudError(err)
 			return err
 		}
 	}
 
 	if region == "" {
-		region = "us-central1" // Default region
+		region = utils.DefaultRegion
 	}
 
-	if upstreamURL == "" {
+	if upstreamURL != "" {
+		if err := utils.ValidateUpstreamURL(upstreamURL); err != nil {
+			return err
+		}
+	} else {
+		if !utils.IsInteractive() {
+			return fmt.Errorf("no upstream URL given and stdin is not a terminal: pass --upstream-url <host>")
+		}
 		var err error
 		upstreamURL, err = utils.SelectUpstreamURL()
 		if err != nil {
@@ -62,12 +83,18 @@ func DeployProxy(projectID, region, upstreamURL string, quiet bool) error {
 		}
 	}
 
-	// Generate a unique service name
-	serviceName := generateProxyServiceName(upstreamURL)
+	// Generate a unique service name unless one was provided
+	if serviceName == "" {
+		serviceName = generateProxyServiceName(upstreamURL)
+	}
 
 	if !quiet {
 		// --- Confirm deployment ---
-		if !utils.ConfirmPrompt(fmt.Sprintf("\nThis will deploy the Litmus proxy '%s' in the project '%s' and region '%s' with upstream URL '%s'. Are you sure you want to continue?", serviceName, projectID, region, upstreamURL)) {
+		confirmed, err := utils.ConfirmPrompt(fmt.Sprintf("\nThis will deploy the Litmus proxy '%s' in the project '%s' and region '%s' with upstream URL '%s'. Are you sure you want to continue?", serviceName, projectID, region, upstreamURL))
+		if err != nil {
+			return err
+		}
+		if !confirmed {
 			fmt.Println("\nAborting deployment.")
 			return nil
 		}
@@ -82,13 +109,14 @@ func DeployProxy(projectID, region, upstreamURL string, quiet bool) error {
 	}
 
 	// Construct the deploy command
-	deployCmd := exec.Command(
+	deployCmd := utils.Command(
 		"gcloud", "run", "deploy", serviceName,
-		"--image", "europe-docker.pkg.dev/litmusai-prod/litmus/proxy:latest",
+		"--image", proxyImage+":latest",
 		"--project", projectID,
 		"--region", region,
 		"--allow-unauthenticated",
 		"--set-env-vars", fmt.Sprintf("PROJECT_ID=%s,UPSTREAM_URL=%s", projectID, upstreamURL),
+		"--labels", proxyLabels,
 	)
 
 	output, err := deployCmd.CombinedOutput()
@@ -103,28 +131,105 @@ func DeployProxy(projectID, region, upstreamURL string, quiet bool) error {
 	// Extract and print the service URL
 	serviceURL := utils.ExtractServiceURL(string(output))
 	if !quiet {
-		fmt.Println("\nAll deployments completed \n")
+		fmt.Print("\nAll deployments completed \n\n")
 		fmt.Printf("Proxy URL for '%s': %s\n", serviceName, serviceURL)
 	}
 
 	return nil
 }
 
+// UpdateProxy rolls out a new image and/or configuration to an existing Litmus
+// proxy, keeping its service URL. The image tag defaults to "latest";
+// upstreamURL and envVars are only changed if given.
+func UpdateProxy(projectID, region, serviceName, imageTag, upstreamURL string, envVars map[string]string, quiet bool) error {
+	if serviceName == "" {
+		return fmt.Errorf("a proxy service name is required")
+	}
+
+	if projectID == "" {
+		var err error
+		projectID, err = utils.GetDefaultProjectID()
+		if err != nil {
+			return err
+		}
+	}
+
+	if region == "" {
+		region = utils.DefaultRegion
+	}
+
+	if imageTag == "" {
+		imageTag = "latest"
+	}
+
+	if upstreamURL != "" {
+		if err := utils.ValidateUpstreamURL(upstreamURL); err != nil {
+			return err
+		}
+	}
+
+	if !quiet {
+		// --- Confirm update ---
+		confirmed, err := utils.ConfirmPrompt(fmt.Sprintf("\nThis will update the Litmus proxy '%s' in the project '%s' and region '%s' to image tag '%s'. Are you sure you want to continue?", serviceName, projectID, region, imageTag))
+		if err != nil {
+			return err
+		}
+		if !confirmed {
+			fmt.Println("\nAborting update.")
+			return nil
+		}
+	}
+
+	if !quiet {
+		// --- Update Cloud Run service ---
+		s := spinner.New(spinner.CharSets[14], 100*time.Millisecond) // Create a new spinner instance
+		s.Suffix = fmt.Sprintf(" Updating Cloud Run service '%s'...", serviceName)
+		s.Start()
+		defer s.Stop()
+	}
+
+	// Construct the update command
+	updateCmd := utils.Command(
+		"gcloud", "run", "services", "update", serviceName,
+		"--image", fmt.Sprintf("%s:%s", proxyImage, imageTag),
+		"--project", projectID,
+		"--region", region,
+		"--update-labels", proxyLabels,
+	)
+	if upstreamURL != "" {
+		updateCmd.Args = append(updateCmd.Args, "--update-env-vars", fmt.Sprintf("UPSTREAM_URL=%s", upstreamURL))
+	}
+	for name, value := range envVars {
+		updateCmd.Args = append(updateCmd.Args, "--update-env-vars", fmt.Sprintf("%s=%s", name, value))
+	}
+
+	output, err := updateCmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("error updating Cloud Run service: %v\nOutput: %s", err, output)
+	}
+
+	if !quiet {
+		fmt.Println("Done! Updated Proxy.")
+		fmt.Printf("Proxy URL for '%s': %s\n", serviceName, utils.ExtractServiceURL(string(output)))
+	}
+
+	return nil
+}
+
 // ListProxyServices lists all deployed Litmus proxy Cloud Run services.
 func ListProxyServices(projectID string, quiet bool) ([]ProxyService, error) {
 	if projectID == "" {
 		var err error
 		projectID, err = utils.GetDefaultProjectID()
 		if err != nil {
-			utils.HandleGcloudError(err)
 			return nil, err
 		}
 	}
 
-	cmd := exec.Command(
+	cmd := utils.Command(
 		"gcloud", "run", "services", "list",
 		"--project", projectID,
-		"--filter", "aiplatform-litmus", // Filter by services starting with "litmus-proxy"
+		"--filter", "metadata.labels.litmus-managed=true AND metadata.labels.litmus-component=proxy",
 		"--format=json",
 	)
 
@@ -155,13 +260,15 @@ func ListProxyServices(projectID string, quiet bool) ([]ProxyService, error) {
 	for _, service := range services {
 		metadata := service["metadata"].(map[string]interface{})
 		status := service["status"].(map[string]interface{})
-		address := status["url"].(string)
-		// Extract the name regardless of annotations
+		address, _ := status["url"].(string)
+		labels, _ := metadata["labels"].(map[string]interface{})
+		region, _ := labels["cloud.googleapis.com/location"].(string)
 		proxyServices = append(proxyServices, ProxyService{
-			Name:      metadata["name"].(string),
-			ProjectID: projectID,
-			URL:       address,
-			// Region and UpstreamURL are not needed for listing names
+			Name:        metadata["name"].(string),
+			ProjectID:   projectID,
+			Region:      region,
+			UpstreamURL: serviceEnvVar(service, "UPSTREAM_URL"),
+			URL:         address,
 		})
 	}
 
@@ -169,7 +276,7 @@ func ListProxyServices(projectID string, quiet bool) ([]ProxyService, error) {
 		if len(proxyServices) > 0 {
 			fmt.Println("Deployed Litmus Proxy services:")
 			for _, s := range proxyServices {
-				fmt.Printf("- %s: %s\n", s.Name, s.URL) // Print name and URL
+				fmt.Printf("- %s (%s): %s -> %s\n", s.Name, s.Region, s.URL, s.UpstreamURL)
 			}
 		} else {
 			fmt.Println("No Litmus Proxy services found.")
@@ -179,19 +286,84 @@ func ListProxyServices(projectID string, quiet bool) ([]ProxyService, error) {
 	return proxyServices, nil
 }
 
-// DestroyProxyService deletes a deployed Litmus proxy Cloud Run service.
+// GetProxyURL returns the URL of a deployed Litmus proxy.
+func GetProxyURL(projectID, region, serviceName string) (string, error) {
+	if serviceName == "" {
+		return "", fmt.Errorf("a proxy service name is required")
+	}
+
+	if projectID == "" {
+		var err error
+		projectID, err = utils.GetDefaultProjectID()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if region == "" {
+		region = utils.DefaultRegion
+	}
+
+	describeCmd := utils.Command(
+		"gcloud", "run", "services", "describe", serviceName,
+		"--project", projectID,
+		"--region", region,
+		"--format=value(status.url)",
+	)
+	output, err := describeCmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("error describing Cloud Run service '%s': %v", serviceName, err)
+	}
+
+	serviceURL := strings.TrimSpace(utils.RemoveAnsiEscapeSequences(string(output)))
+	if serviceURL == "" {
+		return "", fmt.Errorf("Cloud Run service '%s' has no URL yet", serviceName)
+	}
+	return serviceURL, nil
+}
+
+// serviceEnvVar returns the value of an environment variable of the first
+// container in a Cloud Run service's JSON description.
+func serviceEnvVar(service map[string]interface{}, name string) string {
+	for _, entry := range containerEnv(service) {
+		variable, _ := entry.(map[string]interface{})
+		if variable["name"] == name {
+			value, _ := variable["value"].(string)
+			return value
+		}
+	}
+	return ""
+}
+
+// containerEnv returns the env entries of the first container of a Cloud Run
+// service described as JSON.
+func containerEnv(service map[string]interface{}) []interface{} {
+	spec, _ := service["spec"].(map[string]interface{})
+	template, _ := spec["template"].(map[string]interface{})
+	templateSpec, _ := template["spec"].(map[string]interface{})
+	containers, _ := templateSpec["containers"].([]interface{})
+	if len(containers) == 0 {
+		return nil
+	}
+	container, _ := containers[0].(map[string]interface{})
+	env, _ := container["env"].([]interface{})
+	return env
+}
+
+// DestroyProxyService deletes a deployed Litmus proxy Cloud Run service in
+// region. A service picked from the interactive list is deleted in the
+// region it's deployed in.
 func DestroyProxyService(projectID, serviceName, region string, quiet bool) error {
 	if projectID == "" {
 		var err error
 		projectID, err = utils.GetDefaultProjectID()
 		if err != nil {
-			utils.HandleGcloudError(err)
 			return err
 		}
 	}
 
 	if region == "" {
-		region = "us-central1" // Default region
+		region = utils.DefaultRegion
 	}
 
 	// If serviceName is empty, prompt the user to select a service
@@ -208,7 +380,7 @@ func DestroyProxyService(projectID, serviceName, region string, quiet bool) erro
 			return nil
 		}
 
-		if !quiet {
+		if !quiet && !utils.AssumeYes && utils.IsInteractive() {
 			fmt.Println("\nLitmus Proxy services found:")
 			for i, s := range services {
 				fmt.Printf("%d. %s\n", i+1, s.Name)
@@ -232,22 +404,29 @@ func DestroyProxyService(projectID, serviceName, region string, quiet bool) erro
 			}
 
 			serviceName = services[choice-1].Name
+			if services[choice-1].Region != "" {
+				region = services[choice-1].Region
+			}
 		} else {
-			// In quiet mode, return an error if no service name is provided
-			return fmt.Errorf("service name is required in quiet mode")
+			// Without interactive selection, return an error if no service name is provided
+			return fmt.Errorf("service name is required in quiet or --yes mode, or when stdin is not a terminal")
 		}
 	}
 
 	// --- Confirm deletion ---
 	if !quiet {
-		if !utils.ConfirmPrompt(fmt.Sprintf("\nThis will delete the Litmus proxy service '%s' in the project '%s' and region '%s'. Are you sure you want to continue?", serviceName, projectID, region)) {
+		confirmed, err := utils.ConfirmPrompt(fmt.Sprintf("\nThis will delete the Litmus proxy service '%s' in the project '%s' and region '%s'. Are you sure you want to continue?", serviceName, projectID, region))
+		if err != nil {
+			return err
+		}
+		if !confirmed {
 			fmt.Println("\nAborting deletion.")
 			return nil
 		}
 	}
 
 	// Construct the delete command
-	deleteCmd := exec.Command(
+	deleteCmd := utils.Command(
 		"gcloud", "run", "services", "delete", serviceName,
 		"--project", projectID,
 		"--region", region,
@@ -266,19 +445,20 @@ func DestroyProxyService(projectID, serviceName, region string, quiet bool) erro
 	return nil
 }
 
-// DestroyAllProxyServices deletes all deployed Litmus proxy Cloud Run services.
+// DestroyAllProxyServices deletes all deployed Litmus proxy Cloud Run
+// services, each in the region it's deployed in. region is only used for
+// services whose region is unknown.
 func DestroyAllProxyServices(projectID, region string, quiet bool) error {
 	if projectID == "" {
 		var err error
 		projectID, err = utils.GetDefaultProjectID()
 		if err != nil {
-			utils.HandleGcloudError(err)
 			return err
 		}
 	}
 
 	if region == "" {
-		region = "us-central1" // Default region
+		region = utils.DefaultRegion
 	}
 
 	services, err := ListProxyServices(projectID, true)
@@ -295,7 +475,15 @@ func DestroyAllProxyServices(projectID, region string, quiet bool) error {
 
 	// --- Confirm deletion (only in non-quiet mode) ---
 	if !quiet {
-		if !utils.ConfirmPrompt(fmt.Sprintf("\nThis will delete ALL Litmus proxy services in the project '%s' and region '%s'. Are you sure you want to continue?", projectID, region)) {
+		fmt.Println("\nLitmus Proxy services found:")
+		for _, s := range services {
+			fmt.Printf("- %s (%s)\n", s.Name, proxyRegion(s, region))
+		}
+		confirmed, err := utils.ConfirmPrompt(fmt.Sprintf("\nThis will delete ALL %d Litmus proxy services in the project '%s'. Are you sure you want to continue?", len(services), projectID))
+		if err != nil {
+			return err
+		}
+		if !confirmed {
 			fmt.Println("\nAborting deletion.")
 			return nil
 		}
@@ -303,7 +491,7 @@ func DestroyAllProxyServices(projectID, region string, quiet bool) error {
 
 	// --- Iterate through services and delete them ---
 	for _, s := range services {
-		err := DestroyProxyService(projectID, s.Name, region, true)
+		err := DestroyProxyService(projectID, s.Name, proxyRegion(s, region), true)
 		if err != nil {
 			return err
 		}
@@ -319,17 +507,28 @@ func DestroyAllProxyServices(projectID, region string, quiet bool) error {
 	return nil
 }
 
+// proxyRegion returns the region s is deployed in, or fallback if unknown.
+func proxyRegion(s ProxyService, fallback string) string {
+	if s.Region != "" {
+		return s.Region
+	}
+	return fallback
+}
+
 // generateProxyServiceName generates a service name in the format
-// "<region>-aiplatform-litmus-<random hash>".
+// "<region>-aiplatform-litmus-<random hash>", or "litmus-proxy-<random hash>"
+// for upstreams that are not regional Vertex AI endpoints.
 func generateProxyServiceName(upstreamURL string) string {
-	parts := strings.Split(upstreamURL, "-")
-	regionAiplatform := strings.Join(parts[:2], "-") // Extract "<region>-aiplatform"
-
 	rand.Seed(time.Now().UnixNano())
 	letters := []rune("abcdefghijklmnopqrstuvwxyz")
 	var hash []rune
 	for i := 0; i < 4; i++ {
 		hash = append(hash, letters[rand.Intn(len(letters))])
 	}
-	return fmt.Sprintf("%s-aiplatform-litmus-%s", regionAiplatform, string(hash))
+
+	region, ok := utils.VertexRegion(upstreamURL)
+	if !ok || !serviceNameRegex.MatchString(region) {
+		return fmt.Sprintf("litmus-proxy-%s", string(hash))
+	}
+	return fmt.Sprintf("%s-aiplatform-litmus-%s", region, string(hash))
 }
@@ -0,0 +1,115 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/litmus/cli/utils"
+)
+
+// proxyServicesJSON is the gcloud run services list output for two proxies,
+// one of them without a location label.
+const proxyServicesJSON = `[
+  {
+    "metadata": {"name": "us-east1-aiplatform-litmus-abcd", "labels": {"cloud.googleapis.com/location": "us-east1"}},
+    "spec": {"template": {"spec": {"containers": [{"env": [{"name": "UPSTREAM_URL", "value": "us-east1-aiplatform.googleapis.com"}]}]}}},
+    "status": {"url": "https://us-east1-aiplatform-litmus-abcd.a.run.app"}
+  },
+  {
+    "metadata": {"name": "shared-litmus-proxy", "labels": {}},
+    "status": {"url": "https://shared-litmus-proxy.a.run.app"}
+  }
+]`
+
+// deletedServices returns "<service> <region>" for each service delete in calls.
+func deletedServices(calls [][]string) []string {
+	var deleted []string
+	for _, args := range calls {
+		if len(args) > 4 && strings.Join(args[:4], " ") == "gcloud run services delete" {
+			region, _ := flagValue(args, "--region")
+			deleted = append(deleted, args[4]+" "+region)
+		}
+	}
+	return deleted
+}
+
+func TestDestroyProxyService(t *testing.T) {
+	tests := []struct {
+		name   string
+		region string
+		want   []string
+	}{
+		{name: "region", region: "europe-west4", want: []string{"my-proxy europe-west4"}},
+		{name: "default region", want: []string{"my-proxy " + utils.DefaultRegion}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := fakeCommands(t, func(args []string) (string, int) { return "", 0 })
+
+			if err := DestroyProxyService("my-proj", "my-proxy", tt.region, true); err != nil {
+				t.Fatal(err)
+			}
+			if got := deletedServices(calls()); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("deleted %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDestroyProxyServiceError(t *testing.T) {
+	fakeCommands(t, func(args []string) (string, int) { return "ERROR: permission denied", 1 })
+
+	err := DestroyProxyService("my-proj", "my-proxy", "europe-west4", true)
+	if err == nil || !strings.Contains(err.Error(), "permission denied") {
+		t.Errorf("error = %v, want the gcloud output", err)
+	}
+}
+
+func TestDestroyAllProxyServices(t *testing.T) {
+	calls := fakeCommands(t, func(args []string) (string, int) {
+		if strings.Join(args[:4], " ") == "gcloud run services list" {
+			return proxyServicesJSON, 0
+		}
+		return "", 0
+	})
+
+	// Each proxy is deleted where it's deployed, the region flag is the
+	// fallback for the one without a location label
+	if err := DestroyAllProxyServices("my-proj", "europe-west4", true); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"us-east1-aiplatform-litmus-abcd us-east1",
+		"shared-litmus-proxy europe-west4",
+	}
+	if got := deletedServices(calls()); !reflect.DeepEqual(got, want) {
+		t.Errorf("deleted %v, want %v", got, want)
+	}
+}
+
+func TestDestroyAllProxyServicesNone(t *testing.T) {
+	calls := fakeCommands(t, func(args []string) (string, int) { return "[]", 0 })
+
+	if err := DestroyAllProxyServices("my-proj", "europe-west4", true); err != nil {
+		t.Fatal(err)
+	}
+	if got := deletedServices(calls()); len(got) != 0 {
+		t.Errorf("deleted %v, want nothing", got)
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/litmus/cli/utils"
+)
+
+const (
+	// DefaultProxyTestContext is the Litmus context of proxy test requests.
+	DefaultProxyTestContext = "litmus-proxy-test"
+	// proxyTestModel is the model the default Vertex AI test request calls.
+	proxyTestModel = "gemini-1.5-flash-002"
+	// proxyTestPayload is a minimal generateContent request.
+	proxyTestPayload = `{"contents": [{"role": "user", "parts": [{"text": "Reply with OK"}]}], "generationConfig": {"maxOutputTokens": 5}}`
+)
+
+// SendProxyTestRequest sends a request through a deployed proxy under the
+// litmus-context-<litmusContext> path and prints the status, the latency and
+// how to find the request's log entry. Vertex AI proxies get a minimal
+// generateContent request; payloadPath replaces its body, and is required
+// for other upstreams, where it's posted to the proxy root.
+func SendProxyTestRequest(projectID, region, serviceName, litmusContext, payloadPath string) error {
+	if serviceName == "" {
+		return fmt.Errorf("a proxy service name is required")
+	}
+	if litmusContext == "" {
+		litmusContext = DefaultProxyTestContext
+	}
+
+	service, proxyURL, err := describeProxy(projectID, region, serviceName)
+	if err != nil {
+		return err
+	}
+	upstreamURL := serviceEnvVar(service, "UPSTREAM_URL")
+	vertexRegion, isVertex := utils.VertexRegion(upstreamURL)
+
+	payload := []byte(proxyTestPayload)
+	if payloadPath != "" {
+		payload, err = os.ReadFile(payloadPath)
+		if err != nil {
+			return fmt.Errorf("error reading payload file: %w", err)
+		}
+	} else if !isVertex {
+		return fmt.Errorf("proxy '%s' forwards to '%s', not Vertex AI. Pass the request body to send with --file", serviceName, upstreamURL)
+	}
+
+	path := "/"
+	if isVertex {
+		path = fmt.Sprintf("/v1/projects/%s/locations/%s/publishers/google/models/%s:generateContent", projectID, vertexRegion, proxyTestModel)
+	}
+	requestURL := fmt.Sprintf("%s/litmus-context-%s%s", strings.TrimSuffix(proxyURL, "/"), litmusContext, path)
+
+	token, err := utils.Command("gcloud", "auth", "print-access-token").Output()
+	if err != nil {
+		return utils.AuthError(fmt.Errorf("error getting an access token: %w", err))
+	}
+
+	requestID := fmt.Sprintf("litmus-proxy-test-%d", time.Now().UnixNano())
+	req, err := http.NewRequest(http.MethodPost, requestURL, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Litmus-Request", requestID)
+
+	fmt.Printf("POST %s\n", requestURL)
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return utils.TransientError(fmt.Errorf("error sending request through proxy '%s': %w", serviceName, err))
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	latency := time.Since(start).Round(time.Millisecond)
+
+	fmt.Printf("Status:  %s\n", resp.Status)
+	fmt.Printf("Latency: %s\n", latency)
+	fmt.Printf("Context: %s\n", litmusContext)
+	fmt.Printf("Request: %s\n", requestID)
+	fmt.Println("\nThe request is logged to the litmus-proxy-log log within a few seconds:")
+	fmt.Printf("  gcloud logging read 'logName=\"projects/%s/logs/litmus-proxy-log\" AND jsonPayload.tracingID=\"%s\"' --project %s --freshness 10m\n", projectID, requestID, projectID)
+	fmt.Println("With analytics deployed, it's also exported to the litmus_proxy_log table of the litmus_analytics dataset.")
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("the request through proxy '%s' failed with %s: %s", serviceName, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
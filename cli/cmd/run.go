@@ -17,61 +17,32 @@ package cmd
 import (
 	"encoding/json"
 	"fmt"
-	"io"
-	"log"
-	"net/http"
+	"strings"
 
-	"github.com/google/litmus/cli/api"
+	"github.com/google/litmus/cli/client"
 	"github.com/google/litmus/cli/utils"
 )
 
+// runIDLabel is the log label the worker sets to the run ID on every entry
+// it writes to litmus-worker-log.
+const runIDLabel = "run_id"
+
 // OpenRun opens the URL associated with a specific Litmus run ID in the browser.
 func OpenRun(projectID, runID string) error {
-	serviceURL, err := utils.AccessSecret(projectID, "litmus-service-url")
-	if err != nil {
-		log.Fatalf("Error retrieving service URL from Secret Manager: %v", err)
-	}
-	serviceURL = utils.RemoveAnsiEscapeSequences(serviceURL)
-
-	username, password, err := utils.GetAuthCredentials(projectID)
+	c, err := newClient(projectID)
 	if err != nil {
-		return fmt.Errorf("error getting authentication credentials: %w", err)
+		return err
 	}
 
-	runURL := fmt.Sprintf("%s/runs/status/%s", serviceURL, runID)
+	runURL := fmt.Sprintf("%s/runs/status/%s", c.ServiceURL(), runID)
 	fmt.Println(runURL)
 
-	// Create HTTP client
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", runURL, nil)
-	if err != nil {
-		return fmt.Errorf("error creating request: %w", err)
-	}
-
-	// Set basic auth header
-	req.SetBasicAuth(username, password)
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("error making request: %w", err)
-	}
-	defer resp.Body.Close() // Close the body AFTER reading
-
-	// Handle the response (check for success/errors)
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("unexpected status code: %s, response: %s", resp.Status, string(body))
+	runDetails, err := c.GetRun(runID)
+	if client.IsNotFound(err) {
+		return fmt.Errorf("%w. Run 'litmus ls' to see the available runs", err)
 	}
-
-	body, err := io.ReadAll(resp.Body) // Read the body here
 	if err != nil {
-		return fmt.Errorf("error reading response body: %w", err)
-	}
-
-	// Unmarshal the JSON response
-	var runDetails api.RunDetails
-	if err := json.Unmarshal(body, &runDetails); err != nil {
-		return fmt.Errorf("error unmarshalling JSON response: %w", err)
+		return err
 	}
 
 	// Now you can access the data in a structured way:
@@ -88,4 +59,61 @@ func OpenRun(projectID, runID string) error {
 
 	return nil
 
-}
\ No newline at end of file
+}
+
+// workerLogEntry is the subset of a Cloud Logging entry printed by ShowRunLogs.
+type workerLogEntry struct {
+	Timestamp   string                 `json:"timestamp"`
+	Severity    string                 `json:"severity"`
+	TextPayload string                 `json:"textPayload"`
+	JSONPayload map[string]interface{} `json:"jsonPayload"`
+}
+
+// ShowRunLogs prints the worker's log entries for a run, oldest first. It
+// relies on the worker labelling its entries with the run ID (see runIDLabel)
+// and only finds entries from the last 30 days.
+func ShowRunLogs(projectID, runID string) error {
+	if projectID == "" {
+		var err error
+		projectID, err = utils.GetDefaultProjectID()
+		if err != nil {
+			return err
+		}
+	}
+
+	filter := fmt.Sprintf(`logName="projects/%s/logs/litmus-worker-log" AND labels.%s="%s"`, projectID, runIDLabel, runID)
+	readCmd := utils.Command(
+		"gcloud", "logging", "read", filter,
+		"--project", projectID,
+		"--order", "asc",
+		"--freshness", "30d",
+		"--format=json",
+	)
+	output, err := readCmd.Output()
+	if err != nil {
+		return fmt.Errorf("error reading worker logs: %w", err)
+	}
+
+	var entries []workerLogEntry
+	if err := json.Unmarshal(output, &entries); err != nil {
+		return fmt.Errorf("error parsing worker logs: %w", err)
+	}
+	if len(entries) == 0 {
+		fmt.Printf("No worker logs found for run '%s'. Runs started by a worker without the '%s' log label have none.\n", runID, runIDLabel)
+		return nil
+	}
+
+	for _, entry := range entries {
+		message := strings.TrimRight(entry.TextPayload, "\n")
+		if message == "" && entry.JSONPayload != nil {
+			payload, _ := json.Marshal(entry.JSONPayload)
+			message = string(payload)
+		}
+		severity := entry.Severity
+		if severity == "" {
+			severity = "DEFAULT"
+		}
+		fmt.Printf("%s %-8s %s\n", entry.Timestamp, severity, message)
+	}
+	return nil
+}
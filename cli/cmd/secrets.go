@@ -0,0 +1,68 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/litmus/cli/utils"
+)
+
+// managedSecret is a Secret Manager secret written by Litmus.
+type managedSecret struct {
+	name      string // Base name, suffixed by utils.ResourceName
+	sensitive bool   // Masked unless revealed
+	optional  bool   // Only written by some commands
+}
+
+// managedSecrets are the secrets deploy and domain map store.
+var managedSecrets = []managedSecret{
+	{name: "litmus-service-url"},
+	{name: "litmus-password", sensitive: true},
+	{name: "litmus-domain", optional: true},
+}
+
+// ShowSecrets prints the values of the Litmus-managed secrets, for support
+// and debugging. Sensitive values are masked unless reveal is set.
+func ShowSecrets(projectID string, reveal bool) error {
+	found := false
+	for _, secret := range managedSecrets {
+		secretID := utils.ResourceName(secret.name)
+		value, err := utils.AccessSecret(projectID, secretID)
+		switch {
+		case err != nil && secret.optional:
+			fmt.Printf("%-28s (not set)\n", secretID)
+			continue
+		case err != nil:
+			fmt.Printf("%-28s (not accessible: %v)\n", secretID, err)
+			continue
+		}
+		found = true
+
+		if secret.sensitive && !reveal {
+			value = fmt.Sprintf("%s (%d characters, pass --reveal to show)", strings.Repeat("*", 8), len(value))
+		} else {
+			// Quote the value so stray whitespace and escape sequences show
+			value = fmt.Sprintf("%q", value)
+		}
+		fmt.Printf("%-28s %s\n", secretID, value)
+	}
+
+	if !found {
+		return fmt.Errorf("no Litmus secrets are accessible in project '%s', is Litmus deployed?", projectID)
+	}
+	return nil
+}
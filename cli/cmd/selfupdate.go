@@ -0,0 +1,230 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/google/litmus/cli/utils"
+)
+
+// DefaultReleaseURL is where the release workflow publishes the production
+// CLI, as <os>/litmus with its sha256sum in <os>/litmus.sha256. A different
+// base URL with the same layout can be set with --release-url or
+// LITMUS_RELEASE_URL, e.g. .../litmus-cloud/uat for the uat builds.
+const DefaultReleaseURL = "https://storage.googleapis.com/litmus-cloud/prod"
+
+// platformDir returns the directory the release workflow publishes the
+// binary for the current platform in. Only linux and macOS builds are
+// published; the macOS build also runs on Apple silicon.
+func platformDir() (string, error) {
+	switch {
+	case runtime.GOOS == "linux" && runtime.GOARCH == "amd64":
+		return "linux", nil
+	case runtime.GOOS == "darwin":
+		return "osx", nil
+	}
+	return "", fmt.Errorf("no Litmus CLI binary is published for %s/%s, build it from source instead", runtime.GOOS, runtime.GOARCH)
+}
+
+// SelfUpdate compares the running CLI with the binary published at releaseURL
+// and, unless checkOnly is set, downloads it, verifies it against the
+// published sha256 checksum and replaces the running executable. It returns
+// whether an update is available.
+func SelfUpdate(releaseURL string, checkOnly, quiet bool) (bool, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return false, fmt.Errorf("error locating the running executable: %w", err)
+	}
+	if executable, err = filepath.EvalSymlinks(executable); err != nil {
+		return false, fmt.Errorf("error locating the running executable: %w", err)
+	}
+	return selfUpdate(releaseURL, executable, checkOnly, quiet)
+}
+
+// selfUpdate implements SelfUpdate for the binary at executable. Published
+// builds carry the branch name rather than a release version, so the binaries
+// are compared by their sha256 checksums.
+func selfUpdate(releaseURL, executable string, checkOnly, quiet bool) (bool, error) {
+	if releaseURL == "" {
+		releaseURL = os.Getenv("LITMUS_RELEASE_URL")
+	}
+	if releaseURL == "" {
+		releaseURL = DefaultReleaseURL
+	}
+	dir, err := platformDir()
+	if err != nil {
+		return false, err
+	}
+	binaryURL := fmt.Sprintf("%s/%s/litmus", strings.TrimSuffix(releaseURL, "/"), dir)
+
+	expected, err := fetchChecksum(binaryURL + ".sha256")
+	if err != nil {
+		return false, err
+	}
+	installed, err := fileChecksum(executable)
+	if err != nil {
+		return false, err
+	}
+
+	current, commit, _ := utils.BuildInfo()
+	if installed == expected {
+		if !quiet {
+			fmt.Printf("Litmus CLI %s (%s) is up-to-date.\n", current, commit)
+		}
+		return false, nil
+	}
+	if checkOnly {
+		fmt.Printf("A new Litmus CLI is available at %s (installed: %s, %s). Run 'litmus self-update' to install it.\n", binaryURL, current, commit)
+		return true, nil
+	}
+
+	if !quiet {
+		prompt := fmt.Sprintf("\nThis will replace %s (%s, %s) with the Litmus CLI from %s. Are you sure you want to continue?", executable, current, commit, binaryURL)
+		confirmed, err := utils.ConfirmPrompt(prompt)
+		if err != nil {
+			return true, err
+		}
+		if !confirmed {
+			fmt.Println("\nAborting self-update.")
+			return true, nil
+		}
+	}
+
+	if err := replaceExecutable(executable, binaryURL, expected); err != nil {
+		return true, err
+	}
+
+	if !quiet {
+		fmt.Printf("Updated the Litmus CLI from %s.\n", binaryURL)
+	}
+	return true, nil
+}
+
+// fileChecksum returns the hex sha256 checksum of the file at path.
+func fileChecksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("error reading %s: %w", path, err)
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", fmt.Errorf("error reading %s: %w", path, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// download GETs url and returns the response of a successful request.
+func download(url string) (*http.Response, error) {
+	client := &http.Client{Timeout: 5 * time.Minute}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, utils.TransientError(fmt.Errorf("error downloading %s: %w", url, err))
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, utils.HTTPStatusError(resp.StatusCode, fmt.Errorf("error downloading %s: %s", url, resp.Status))
+	}
+	return resp, nil
+}
+
+// fetchChecksum returns the checksum from a sha256sum file for a single
+// binary. The release workflow builds the binary as main, so the file name on
+// the line isn't checked.
+func fetchChecksum(checksumURL string) (string, error) {
+	resp, err := download(checksumURL)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	if scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 0 && len(fields[0]) == sha256.Size*2 {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", utils.TransientError(fmt.Errorf("error reading %s: %w", checksumURL, err))
+	}
+	return "", fmt.Errorf("no sha256 checksum in %s", checksumURL)
+}
+
+// replaceExecutable downloads binaryURL next to executable, checks its sha256
+// checksum and renames it over executable, so the running binary is either
+// kept or fully replaced.
+func replaceExecutable(executable, binaryURL, expected string) error {
+	resp, err := download(binaryURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// The temporary file must be on the same file system for the rename
+	tmp, err := os.CreateTemp(filepath.Dir(executable), ".litmus-update-*")
+	if err != nil {
+		return fmt.Errorf("error creating a file next to %s: %w", executable, err)
+	}
+	defer os.Remove(tmp.Name()) // No-op once renamed
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, hash), resp.Body); err != nil {
+		tmp.Close()
+		return utils.TransientError(fmt.Errorf("error downloading %s: %w", binaryURL, err))
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing %s: %w", tmp.Name(), err)
+	}
+	if actual := hex.EncodeToString(hash.Sum(nil)); actual != expected {
+		return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", binaryURL, expected, actual)
+	}
+
+	info, err := os.Stat(executable)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", executable, err)
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()|0o111); err != nil {
+		return fmt.Errorf("error making %s executable: %w", tmp.Name(), err)
+	}
+
+	// Windows can't replace a running executable, but it can rename it
+	if runtime.GOOS == "windows" {
+		old := executable + ".old"
+		os.Remove(old)
+		if err := os.Rename(executable, old); err != nil {
+			return fmt.Errorf("error moving %s aside: %w", executable, err)
+		}
+	}
+	if err := os.Rename(tmp.Name(), executable); err != nil {
+		if runtime.GOOS == "windows" {
+			os.Rename(executable+".old", executable)
+		}
+		return fmt.Errorf("error replacing %s: %w", executable, err)
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newReleaseServer serves binary and its checksum in the layout of the
+// release workflow, e.g. /prod/linux/litmus and /prod/linux/litmus.sha256.
+func newReleaseServer(t *testing.T, binary []byte, checksum string) string {
+	t.Helper()
+	dir, err := platformDir()
+	if err != nil {
+		t.Skip(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/prod/"+dir+"/litmus", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(binary)
+	})
+	mux.HandleFunc("/prod/"+dir+"/litmus.sha256", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(checksum + "  main\n"))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server.URL + "/prod"
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func writeExecutable(t *testing.T, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "litmus")
+	if err := os.WriteFile(path, data, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSelfUpdate(t *testing.T) {
+	installed := []byte("installed build")
+	published := []byte("published build")
+
+	tests := []struct {
+		name          string
+		executable    []byte
+		checksum      string
+		checkOnly     bool
+		wantAvailable bool
+		wantErr       bool
+		want          []byte
+	}{
+		{
+			name:       "up-to-date",
+			executable: published,
+			checksum:   sha256Hex(published),
+			want:       published,
+		},
+		{
+			name:          "check only",
+			executable:    installed,
+			checksum:      sha256Hex(published),
+			checkOnly:     true,
+			wantAvailable: true,
+			want:          installed,
+		},
+		{
+			name:          "update",
+			executable:    installed,
+			checksum:      sha256Hex(published),
+			wantAvailable: true,
+			want:          published,
+		},
+		{
+			name:          "checksum mismatch",
+			executable:    installed,
+			checksum:      sha256Hex([]byte("tampered build")),
+			wantAvailable: true,
+			wantErr:       true,
+			want:          installed,
+		},
+		{
+			name:       "malformed checksum file",
+			executable: installed,
+			checksum:   "not-a-checksum",
+			wantErr:    true,
+			want:       installed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			releaseURL := newReleaseServer(t, published, tt.checksum)
+			executable := writeExecutable(t, tt.executable)
+
+			available, err := selfUpdate(releaseURL, executable, tt.checkOnly, true)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("selfUpdate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if available != tt.wantAvailable {
+				t.Errorf("selfUpdate() available = %v, want %v", available, tt.wantAvailable)
+			}
+
+			got, err := os.ReadFile(executable)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != string(tt.want) {
+				t.Errorf("executable = %q, want %q", got, tt.want)
+			}
+			info, err := os.Stat(executable)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode().Perm()&0o111 == 0 {
+				t.Errorf("executable mode = %v, want it executable", info.Mode())
+			}
+			// No temporary files may be left next to the executable
+			entries, err := os.ReadDir(filepath.Dir(executable))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 {
+				t.Errorf("directory has %d entries, want only the executable", len(entries))
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"sync"
+	"time"
+
+	"github.com/briandowns/spinner"
+)
+
+// phaseSpinner shows a single spinner across the phases of a command. Starting
+// a phase while the spinner is running only updates its suffix, and start and
+// stop can be called from several goroutines. A disabled phaseSpinner does
+// nothing, so callers don't need to check quiet.
+type phaseSpinner struct {
+	mu      sync.Mutex
+	s       *spinner.Spinner
+	enabled bool
+	active  bool
+}
+
+// newPhaseSpinner returns a stopped spinner, disabled if quiet is set. The
+// spinner draws nothing when stdout isn't a terminal.
+func newPhaseSpinner(quiet bool) *phaseSpinner {
+	return &phaseSpinner{
+		s:       spinner.New(spinner.CharSets[14], 100*time.Millisecond),
+		enabled: !quiet,
+	}
+}
+
+// start shows the spinner with suffix, or updates the suffix of the running
+// spinner.
+func (p *phaseSpinner) start(suffix string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.enabled {
+		return
+	}
+	if p.active {
+		p.s.Lock()
+		p.s.Suffix = suffix
+		p.s.Unlock()
+		return
+	}
+	p.s.Suffix = suffix
+	p.s.Start()
+	p.active = true
+}
+
+// stop erases the spinner if it is running. Call it before printing, so the
+// output isn't interleaved with the spinner.
+func (p *phaseSpinner) stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.active {
+		return
+	}
+	p.s.Stop()
+	p.active = false
+}
@@ -1,73 +1,146 @@
 package cmd
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
-	"io"
-	"log"
-	"net/http"
+	"net/url"
 	"time"
 
+	"github.com/google/litmus/cli/client"
+	"github.com/google/litmus/cli/logger"
 	"github.com/google/litmus/cli/utils"
 )
 
+// WaitForRun polls the run status with exponential backoff between these
+// intervals, starting over whenever the run makes progress.
+const (
+	runPollMinInterval = 2 * time.Second
+	runPollMaxInterval = 30 * time.Second
+)
+
+// maxRunPollErrors is how many transient errors in a row WaitForRun
+// tolerates before giving up.
+const maxRunPollErrors = 5
+
 // SubmitRun submits a Litmus run.
 func SubmitRun(templateID, runID, projectID, authToken string) error {
-	serviceURL, err := utils.AccessSecret(projectID, "litmus-service-url")
+	c, err := newClient(projectID)
 	if err != nil {
-		log.Fatalf("Error retrieving service URL from Secret Manager: %v", err)
+		return err
 	}
-	
-	serviceURL = utils.RemoveAnsiEscapeSequences(serviceURL) 
-
-	username, password, err := utils.GetAuthCredentials(projectID)
-	if err != nil {
-		return fmt.Errorf("error getting authentication credentials: %w", err)
+	err = c.SubmitRun(templateID, runID, authToken)
+	if client.IsNotFound(err) {
+		return fmt.Errorf("%w. Run 'litmus templates list' to see the available templates", err)
 	}
+	return err
+}
 
-	url := fmt.Sprintf("%s/runs/submit_simple", serviceURL)
-	payload := map[string]interface{}{
-		"run_id":      runID,
-		"template_id": templateID,
-	}
-	// Add authToken to payload only if it's set
-	if authToken != "" {
-		payload["auth_token"] = authToken 
-	}
-	
-	payloadJSON, err := json.Marshal(payload)
+// WaitForRun polls the status of a Litmus run until it completes or the
+// timeout expires (0 waits indefinitely), then prints a pass/fail summary.
+// It returns true if every test case passed.
+func WaitForRun(projectID, runID string, timeout time.Duration) (bool, error) {
+	c, err := newClient(projectID)
 	if err != nil {
-		return fmt.Errorf("error marshaling JSON payload: %w", err)
+		return false, err
 	}
 
-	client := &http.Client{
-		Timeout: 10 * time.Second,
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(payloadJSON))
-	if err != nil {
-		return fmt.Errorf("error creating request: %w", err)
+	fmt.Printf("Waiting for run %s to complete...\n", runID)
+	lastProgress := ""
+	interval := runPollMinInterval
+	pollErrors := 0
+	for {
+		status, err := fetchRunStatus(c, runID)
+		if err != nil {
+			// Auth and not found errors won't go away by polling again
+			if utils.ExitCode(err) != utils.ExitTransient {
+				return false, err
+			}
+			pollErrors++
+			if pollErrors >= maxRunPollErrors {
+				return false, fmt.Errorf("giving up after %d errors checking run %s: %w", pollErrors, runID, err)
+			}
+			logger.Warnf("Error checking run status (%d/%d): %v", pollErrors, maxRunPollErrors, err)
+		} else {
+			pollErrors = 0
+			if status.Progress != lastProgress && status.Progress != "" {
+				fmt.Printf("Status: %s, progress: %s\n", status.Status, status.Progress)
+				lastProgress = status.Progress
+				// Poll quickly again while the run is moving
+				interval = runPollMinInterval
+			}
+			if status.Status == "Completed" {
+				return printRunSummary(runID, status), nil
+			}
+		}
+
+		if !deadline.IsZero() {
+			remaining := time.Until(deadline)
+			if remaining <= 0 {
+				return false, utils.TransientError(fmt.Errorf("timed out after %s waiting for run %s to complete", timeout, runID))
+			}
+			time.Sleep(min(interval, remaining))
+		} else {
+			time.Sleep(interval)
+		}
+		interval = min(interval*2, runPollMaxInterval)
 	}
-	req.Header.Set("Content-Type", "application/json")
+}
 
-	// Set basic auth header
-	req.SetBasicAuth(username, password)
+// runStatus is the subset of the /runs/status response needed to wait for a run.
+type runStatus struct {
+	Status    string `json:"status"`
+	Progress  string `json:"progress"`
+	TestCases []struct {
+		ID       string `json:"id"`
+		Response struct {
+			// A string for test runs, a boolean assessment for test missions
+			Status interface{} `json:"status"`
+			Error  string      `json:"error"`
+		} `json:"response"`
+	} `json:"testCases"`
+}
 
-	resp, err := client.Do(req)
+// fetchRunStatus retrieves the current status of a run.
+func fetchRunStatus(c *client.Client, runID string) (*runStatus, error) {
+	body, err := c.Do("GET", "/runs/status/"+url.PathEscape(runID), nil)
 	if err != nil {
-		return fmt.Errorf("error making request: %w", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	// Handle the response (check for success/errors)
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("unexpected status code: %s, response: %s", resp.Status, string(body))
+	var status runStatus
+	if err := json.Unmarshal(body, &status); err != nil {
+		return nil, fmt.Errorf("error unmarshalling JSON response: %w", err)
 	}
+	return &status, nil
+}
 
-	// Handle successful response (You might want to process the response here)
-	//fmt.Println("Run submitted successfully.")
+// printRunSummary prints the pass/fail counts of a completed run and
+// returns true if no test case failed.
+func printRunSummary(runID string, status *runStatus) bool {
+	passed, failed := 0, 0
+	for _, testCase := range status.TestCases {
+		switch testCase.Response.Status {
+		case "Failed", "Error", false:
+			failed++
+			if testCase.Response.Error != "" {
+				fmt.Printf("  %s: %v (%s)\n", testCase.ID, testCase.Response.Status, testCase.Response.Error)
+			} else {
+				fmt.Printf("  %s: %v\n", testCase.ID, testCase.Response.Status)
+			}
+		default:
+			passed++
+		}
+	}
 
-	return nil
-}
\ No newline at end of file
+	result := "PASSED"
+	if failed > 0 {
+		result = "FAILED"
+	}
+	fmt.Printf("Run %s %s: %d passed, %d failed, %d total\n", runID, result, passed, failed, len(status.TestCases))
+	return failed == 0
+}
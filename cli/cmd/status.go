@@ -16,26 +16,133 @@ package cmd
 
 import (
 	"fmt"
+	"net/http"
+	"strings"
+	"time"
 
 	"github.com/google/litmus/cli/utils"
 )
 
 // ShowStatus displays the status of the Litmus deployment.
 func ShowStatus(projectID string) {
-	serviceURL, err := utils.AccessSecret(projectID, "litmus-service-url")
+	serviceURL, err := resolveServiceURL(projectID)
 	if err != nil {
 		fmt.Println("Litmus is not deployed or there was an error retrieving the status.")
 		return
 	}
 
-	password, err := utils.AccessSecret(projectID, "litmus-password")
+	password, err := utils.AccessSecret(projectID, utils.ResourceName("litmus-password"))
 	if err != nil {
 		fmt.Println("Error retrieving password from Secret Manager:", err)
 		return
 	}
 
 	fmt.Println("Litmus Deployment Status:")
+	if utils.Instance != "" {
+		fmt.Println("Instance:", utils.Instance)
+	}
 	fmt.Println("URL:", serviceURL)
 	fmt.Println("User: admin")
 	fmt.Println("Password:", password)
-}
\ No newline at end of file
+}
+
+// CheckHealth checks that the API service and the worker job exist in region
+// and probes the API with an authenticated request. It returns true if both
+// are healthy.
+func CheckHealth(projectID, region string) bool {
+	fmt.Println("\nHealth:")
+	healthy := true
+
+	// The probe goes to the stored URL, which works wherever the API is
+	// deployed, so check the service in the region the command targets first
+	apiService := utils.ResourceName("litmus-api")
+	if !utils.ServiceExists(projectID, region, apiService) {
+		fmt.Printf("API:    service '%s' not found in region '%s'\n", apiService, region)
+		healthy = false
+	} else if apiStatus, err := probeAPI(projectID); err != nil {
+		fmt.Println("API:    unreachable -", err)
+		healthy = false
+	} else if apiStatus != http.StatusOK {
+		fmt.Printf("API:    unhealthy (HTTP %d %s)\n", apiStatus, http.StatusText(apiStatus))
+		healthy = false
+	} else {
+		fmt.Printf("API:    reachable (HTTP %d %s)\n", apiStatus, http.StatusText(apiStatus))
+	}
+
+	workerJob := utils.ResourceName("litmus-worker")
+	if utils.JobExists(projectID, region, workerJob) {
+		fmt.Printf("Worker: job '%s' exists\n", workerJob)
+	} else {
+		fmt.Printf("Worker: job '%s' not found in region '%s'\n", workerJob, region)
+		healthy = false
+	}
+
+	return healthy
+}
+
+// probeAPI makes an authenticated request to the runs endpoint and returns
+// the HTTP status code.
+func probeAPI(projectID string) (int, error) {
+	serviceURL, err := utils.AccessServiceURL(projectID)
+	if err != nil {
+		return 0, fmt.Errorf("error retrieving service URL from Secret Manager: %w", err)
+	}
+
+	username, password, err := utils.GetAuthCredentials(projectID)
+	if err != nil {
+		return 0, fmt.Errorf("error getting authentication credentials: %w", err)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	req, err := http.NewRequest("GET", serviceURL+"/runs/", nil)
+	if err != nil {
+		return 0, fmt.Errorf("error creating request: %w", err)
+	}
+	req.SetBasicAuth(username, password)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// ShowImageVersions prints the images deployed for the API service and the
+// worker job, with the digest of the API revision that is serving traffic.
+func ShowImageVersions(projectID, region string) {
+	fmt.Println("\nImages:")
+
+	apiImage, err := describeImage(projectID, region, "services", utils.ResourceName("litmus-api"), "spec.template.spec.containers[0].image")
+	if err != nil {
+		fmt.Println("API:    unknown -", err)
+	} else {
+		digest, err := deployedAPIDigest(projectID, region)
+		if err != nil || digest == "" {
+			fmt.Println("API:   ", apiImage)
+		} else {
+			fmt.Printf("API:    %s (%s)\n", apiImage, digest)
+		}
+	}
+
+	workerImage, err := describeImage(projectID, region, "jobs", utils.ResourceName("litmus-worker"), "spec.template.spec.template.spec.containers[0].image")
+	if err != nil {
+		fmt.Println("Worker: unknown -", err)
+	} else {
+		fmt.Println("Worker:", workerImage)
+	}
+}
+
+// describeImage returns the image of a Cloud Run service or job.
+func describeImage(projectID, region, resourceType, name, field string) (string, error) {
+	output, err := utils.Command(
+		"gcloud", "run", resourceType, "describe", name,
+		"--project", projectID,
+		"--region", region,
+		fmt.Sprintf("--format=value(%s)", field),
+	).Output()
+	if err != nil {
+		return "", fmt.Errorf("error describing '%s': %v", name, err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
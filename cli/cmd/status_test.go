@@ -0,0 +1,84 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckHealthUsesRegion(t *testing.T) {
+	const region = "europe-west4"
+
+	// The worker job exists in the region, the API service doesn't, so the
+	// check fails before probing the API
+	calls := fakeCommands(t, func(args []string) (string, int) {
+		if got, _ := flagValue(args, "--region"); got != region {
+			return "", 0
+		}
+		if strings.Join(args[:4], " ") == "gcloud run jobs list" {
+			return "litmus-worker\n", 0
+		}
+		return "", 0
+	})
+
+	if CheckHealth("my-proj", region) {
+		t.Error("CheckHealth() = true, want false without the API service")
+	}
+
+	ran := calls()
+	if len(ran) != 2 {
+		t.Fatalf("ran %d commands, want the service and job lookups: %v", len(ran), ran)
+	}
+	for _, args := range ran {
+		if got, ok := flagValue(args, "--region"); !ok || got != region {
+			t.Errorf("%s ran with --region %q, want %q", strings.Join(args, " "), got, region)
+		}
+		if got, _ := flagValue(args, "--project"); got != "my-proj" {
+			t.Errorf("%s ran with --project %q, want my-proj", strings.Join(args, " "), got)
+		}
+	}
+}
+
+func TestShowImageVersionsUsesRegion(t *testing.T) {
+	const region = "europe-west4"
+
+	calls := fakeCommands(t, func(args []string) (string, int) {
+		if got, _ := flagValue(args, "--region"); got != region {
+			return "not found", 1
+		}
+		format, _ := flagValue(args, "--format")
+		switch {
+		case strings.Contains(format, "latestReadyRevisionName"):
+			return "litmus-api-00001\n", 0
+		case strings.Contains(format, "imageDigest"):
+			return "sha256:abc\n", 0
+		default:
+			return "gcr.io/my-proj/image:latest\n", 0
+		}
+	})
+
+	ShowImageVersions("my-proj", region)
+
+	ran := calls()
+	if len(ran) != 4 {
+		t.Fatalf("ran %d commands, want the API, revision and worker lookups: %v", len(ran), ran)
+	}
+	for _, args := range ran {
+		if got, ok := flagValue(args, "--region"); !ok || got != region {
+			t.Errorf("%s ran with --region %q, want %q", strings.Join(args, " "), got, region)
+		}
+	}
+}
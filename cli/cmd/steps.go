@@ -0,0 +1,144 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/litmus/cli/logger"
+)
+
+// Step statuses reported by stepRecorder.
+const (
+	stepDone    = "done"
+	stepSkipped = "skipped"
+	stepFailed  = "failed"
+)
+
+// Progress output formats accepted by --progress.
+const (
+	ProgressSpinner = "spinner" // Spinners and human-readable messages
+	ProgressJSON    = "json"    // Newline-delimited JSON progress events on stdout
+)
+
+var (
+	progressMu     sync.Mutex
+	progressFormat = ProgressSpinner
+)
+
+// SetProgressFormat selects how long-running commands report progress.
+func SetProgressFormat(name string) error {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name != ProgressSpinner && name != ProgressJSON {
+		return fmt.Errorf("invalid progress format '%s' (expected spinner or json)", name)
+	}
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	progressFormat = name
+	return nil
+}
+
+// ProgressIsJSON reports whether progress is written as JSON events, in which
+// case commands skip their spinners and human-readable output.
+func ProgressIsJSON() bool {
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	return progressFormat == ProgressJSON
+}
+
+// progressEvent is a line written to stdout with --progress json.
+type progressEvent struct {
+	Phase   string `json:"phase"`
+	Percent int    `json:"percent"`
+	Message string `json:"message"`
+}
+
+// emitProgress writes a progress event if --progress json is set.
+func emitProgress(phase string, percent int, message string) {
+	if !ProgressIsJSON() {
+		return
+	}
+	line, err := json.Marshal(progressEvent{phase, percent, message})
+	if err != nil {
+		return
+	}
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	fmt.Fprintf(os.Stdout, "%s\n", line)
+}
+
+// stepRecorder times the steps of a long-running command and reports each
+// one as a structured event (see logger.Event) and, with --progress json, as
+// a progress event.
+type stepRecorder struct {
+	name   string
+	detail string
+	start  time.Time
+
+	total     int // Expected number of steps, used for the percentage
+	completed int
+}
+
+// expect sets the number of steps the command expects to run. Optional steps
+// that end up running past the estimate keep the percentage below 100 until
+// complete is called.
+func (r *stepRecorder) expect(total int) {
+	r.total = total
+}
+
+// percent estimates how far along the command is.
+func (r *stepRecorder) percent() int {
+	if r.total <= 0 {
+		return 0
+	}
+	return min(r.completed*100/r.total, 99)
+}
+
+// begin starts timing a step. detail describes what the step acts on.
+func (r *stepRecorder) begin(name, detail string) {
+	r.name, r.detail, r.start = name, detail, time.Now()
+	emitProgress(name, r.percent(), detail)
+}
+
+// end reports the current step with the given status.
+func (r *stepRecorder) end(status string) {
+	if r.name == "" {
+		return
+	}
+	logger.Event(r.name, status, r.detail, time.Since(r.start))
+	r.completed++
+	emitProgress(r.name, r.percent(), status)
+	r.name = ""
+}
+
+// complete reports that the command has finished successfully.
+func (r *stepRecorder) complete(message string) {
+	emitProgress("complete", 100, message)
+}
+
+// fail reports the current step, if any, as failed with err as its detail.
+// It is meant to be deferred with the command's returned error.
+func (r *stepRecorder) fail(err error) {
+	if err == nil || r.name == "" {
+		return
+	}
+	r.detail = err.Error()
+	r.end(stepFailed)
+}
@@ -0,0 +1,402 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/google/litmus/cli/api"
+	"github.com/google/litmus/cli/client"
+	"github.com/google/litmus/cli/utils"
+)
+
+// ListTemplates retrieves and displays the Litmus test templates.
+func ListTemplates(projectID string, jsonOutput bool) error {
+	body, err := apiRequest(projectID, "GET", "/templates/", nil)
+	if err != nil {
+		return err
+	}
+
+	var response struct {
+		Templates []api.TemplateInfo `json:"templates"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return fmt.Errorf("error decoding response: %w", err)
+	}
+
+	if jsonOutput {
+		return printJSON(response.Templates)
+	}
+
+	if len(response.Templates) == 0 {
+		fmt.Println("No templates found.")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TEMPLATE ID\tTYPE")
+	for _, template := range response.Templates {
+		fmt.Fprintf(w, "%s\t%s\n", template.TemplateID, template.TemplateType)
+	}
+	return w.Flush()
+}
+
+// GetTemplate retrieves and displays a single Litmus test template.
+func GetTemplate(projectID, templateID string, jsonOutput bool) error {
+	body, err := apiRequest(projectID, "GET", "/templates/"+url.PathEscape(templateID), nil)
+	if client.IsNotFound(err) {
+		return fmt.Errorf("%w. Run 'litmus templates list' to see the available templates", err)
+	}
+	if err != nil {
+		return err
+	}
+
+	var template map[string]interface{}
+	if err := json.Unmarshal(body, &template); err != nil {
+		return fmt.Errorf("error decoding response: %w", err)
+	}
+
+	if jsonOutput {
+		return printJSON(template)
+	}
+
+	keys := make([]string, 0, len(template))
+	for key := range template {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FIELD\tVALUE")
+	fmt.Fprintf(w, "template_id\t%s\n", templateID)
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s\t%s\n", key, summarizeValue(template[key]))
+	}
+	return w.Flush()
+}
+
+// CreateTemplate creates a Litmus test template from a JSON file.
+func CreateTemplate(projectID, filePath string) error {
+	if filePath == "" {
+		return fmt.Errorf("a template file is required (--file template.json)")
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return fmt.Errorf("error reading template file: %w", err)
+	}
+	if !json.Valid(data) {
+		return fmt.Errorf("template file '%s' does not contain valid JSON", filePath)
+	}
+
+	body, err := apiRequest(projectID, "POST", "/templates/add", data)
+	if err != nil {
+		return err
+	}
+
+	var response struct {
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &response); err == nil && response.Message != "" {
+		fmt.Println(response.Message)
+	} else {
+		fmt.Println("Template created successfully.")
+	}
+	return nil
+}
+
+// apiRequest sends an authenticated request to the Litmus API and
+// returns the response body.
+func apiRequest(projectID, method, path string, payload []byte) ([]byte, error) {
+	c, err := newClient(projectID)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(method, path, payload)
+}
+
+// newClient returns an API client for the Litmus deployment in projectID.
+func newClient(projectID string) (*client.Client, error) {
+	serviceURL, err := utils.AccessServiceURL(projectID)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving service URL from Secret Manager: %w", err)
+	}
+
+	username, password, err := utils.GetAuthCredentials(projectID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting authentication credentials: %w", err)
+	}
+	return client.New(serviceURL, username, password), nil
+}
+
+// printJSON prints v as indented JSON.
+func printJSON(v interface{}) error {
+	output, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling JSON: %w", err)
+	}
+	fmt.Println(string(output))
+	return nil
+}
+
+// summarizeValue formats a template field for table output, summarizing
+// arrays and objects instead of printing them in full.
+func summarizeValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "-"
+	case []interface{}:
+		return fmt.Sprintf("[%d items]", len(v))
+	case map[string]interface{}:
+		return fmt.Sprintf("{%d fields}", len(v))
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// templateFields lists the fields accepted by the /templates/add endpoint.
+var templateFields = map[string]bool{
+	"template_id":           true,
+	"template_type":         true,
+	"mission_duration":      true,
+	"template_data":         true,
+	"test_pre_request":      true,
+	"test_post_request":     true,
+	"test_request":          true,
+	"template_llm_prompt":   true,
+	"template_input_field":  true,
+	"template_output_field": true,
+	"evaluation_types":      true,
+}
+
+// templateProblem is a single issue found while validating a template file.
+type templateProblem struct {
+	Field   string
+	Line    int // 0 if the field is missing from the file
+	Message string
+}
+
+// ErrInvalidTemplate is returned by ValidateTemplate when the template has
+// problems, after they have been reported.
+var ErrInvalidTemplate = errors.New("invalid template")
+
+// ValidateTemplate checks a template JSON file locally against the format
+// expected by the Litmus API and reports every problem found.
+func ValidateTemplate(filePath string) error {
+	if filePath == "" {
+		return fmt.Errorf("a template file is required (--file template.json)")
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return fmt.Errorf("error reading template file: %w", err)
+	}
+
+	problems := validateTemplate(data)
+	if len(problems) == 0 {
+		fmt.Printf("Template file '%s' is valid.\n", filePath)
+		return nil
+	}
+
+	for _, problem := range problems {
+		location := filePath
+		if problem.Line > 0 {
+			location = fmt.Sprintf("%s:%d", filePath, problem.Line)
+		}
+		if problem.Field != "" {
+			fmt.Printf("%s: %s: %s\n", location, problem.Field, problem.Message)
+		} else {
+			fmt.Printf("%s: %s\n", location, problem.Message)
+		}
+	}
+	return fmt.Errorf("template file '%s' has %d problem(s): %w", filePath, len(problems), ErrInvalidTemplate)
+}
+
+// validateTemplate returns the problems found in the template JSON, sorted by line.
+func validateTemplate(data []byte) []templateProblem {
+	var parsed interface{}
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			return []templateProblem{{Line: lineAt(data, syntaxErr.Offset), Message: "invalid JSON: " + syntaxErr.Error()}}
+		}
+		return []templateProblem{{Message: "invalid JSON: " + err.Error()}}
+	}
+
+	template, ok := parsed.(map[string]interface{})
+	if !ok {
+		return []templateProblem{{Line: 1, Message: "template must be a JSON object"}}
+	}
+
+	offsets := make(map[string]int64)
+	walkJSON(json.NewDecoder(bytes.NewReader(data)), "", offsets)
+
+	var problems []templateProblem
+	report := func(field, format string, args ...interface{}) {
+		line := 0
+		if offset, ok := offsets[field]; ok {
+			line = lineAt(data, offset)
+		}
+		problems = append(problems, templateProblem{Field: field, Line: line, Message: fmt.Sprintf(format, args...)})
+	}
+
+	for field := range template {
+		if !templateFields[field] {
+			report(field, "unknown field")
+		}
+	}
+
+	if id, ok := template["template_id"].(string); !ok || id == "" {
+		report("template_id", "is required and must be a non-empty string")
+	}
+
+	templateType, _ := template["template_type"].(string)
+	if templateType != "Test Run" && templateType != "Test Mission" {
+		report("template_type", "is required and must be either 'Test Run' or 'Test Mission'")
+	}
+
+	if templateType == "Test Mission" {
+		duration, ok := template["mission_duration"].(float64)
+		if !ok || duration != float64(int(duration)) || duration <= 0 {
+			report("mission_duration", "is required for a 'Test Mission' and must be a positive integer")
+		}
+	}
+
+	for _, field := range []string{"template_input_field", "template_output_field"} {
+		if value, ok := template[field].(string); !ok || value == "" {
+			report(field, "is required and must be a non-empty string")
+		}
+	}
+
+	if value, ok := template["template_llm_prompt"]; ok && value != nil {
+		if _, isString := value.(string); !isString {
+			report("template_llm_prompt", "must be a string")
+		}
+	}
+
+	if _, ok := template["test_request"]; !ok {
+		report("test_request", "is required")
+	}
+	for _, field := range []string{"test_request", "test_pre_request", "test_post_request"} {
+		if value, ok := template[field]; ok && value != nil && !isRequestObject(value) {
+			report(field, "must be a JSON object or a string containing a JSON object")
+		}
+	}
+
+	if value, ok := template["evaluation_types"]; ok && value != nil {
+		if _, isObject := value.(map[string]interface{}); !isObject {
+			report("evaluation_types", "must be a JSON object (e.g. {\"ragas\": true})")
+		}
+	}
+
+	testCases, ok := template["template_data"].([]interface{})
+	switch {
+	case !ok:
+		report("template_data", "is required and must be an array of test cases")
+	case len(testCases) == 0:
+		report("template_data", "must contain at least one test case")
+	}
+	for i, testCase := range testCases {
+		field := fmt.Sprintf("template_data[%d]", i)
+		fields, ok := testCase.(map[string]interface{})
+		if !ok {
+			report(field, "test case must be a JSON object")
+			continue
+		}
+		if templateType == "Test Mission" {
+			if query, ok := fields["query"].(string); !ok || query == "" {
+				report(field, "test case for a 'Test Mission' requires a non-empty 'query'")
+			}
+		} else if len(fields) == 0 {
+			report(field, "test case has no fields")
+		}
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		if problems[i].Line != problems[j].Line {
+			return problems[i].Line < problems[j].Line
+		}
+		return problems[i].Field < problems[j].Field
+	})
+	return problems
+}
+
+// isRequestObject reports whether value is a JSON object, either inline or
+// encoded as a string (the API accepts both).
+func isRequestObject(value interface{}) bool {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return true
+	case string:
+		var decoded map[string]interface{}
+		return json.Unmarshal([]byte(v), &decoded) == nil
+	default:
+		return false
+	}
+}
+
+// walkJSON records the input offset of every value in the document, keyed by
+// its field path (e.g. "template_data[2].query").
+func walkJSON(dec *json.Decoder, path string, offsets map[string]int64) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	offsets[path] = dec.InputOffset()
+
+	delim, ok := token.(json.Delim)
+	if !ok {
+		return nil
+	}
+	switch delim {
+	case '{':
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			child := fmt.Sprint(key)
+			if path != "" {
+				child = path + "." + child
+			}
+			if err := walkJSON(dec, child, offsets); err != nil {
+				return err
+			}
+		}
+	case '[':
+		for i := 0; dec.More(); i++ {
+			if err := walkJSON(dec, fmt.Sprintf("%s[%d]", path, i), offsets); err != nil {
+				return err
+			}
+		}
+	}
+	_, err = dec.Token() // Closing delimiter
+	return err
+}
+
+// lineAt returns the 1-based line number of the given byte offset.
+func lineAt(data []byte, offset int64) int {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
@@ -0,0 +1,53 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateTemplateErrors(t *testing.T) {
+	dir := t.TempDir()
+	invalid := filepath.Join(dir, "invalid.json")
+	if err := os.WriteFile(invalid, []byte(`{"template_id": `), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		filePath    string
+		wantInvalid bool
+	}{
+		{name: "missing --file", filePath: ""},
+		{name: "unreadable file", filePath: filepath.Join(dir, "missing.json")},
+		{name: "invalid template", filePath: invalid, wantInvalid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateTemplate(tt.filePath)
+			if err == nil {
+				t.Fatal("ValidateTemplate() = nil, want an error")
+			}
+			// Only reported template problems may be left unprinted
+			if got := errors.Is(err, ErrInvalidTemplate); got != tt.wantInvalid {
+				t.Errorf("errors.Is(%v, ErrInvalidTemplate) = %v, want %v", err, got, tt.wantInvalid)
+			}
+		})
+	}
+}
@@ -15,9 +15,9 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
-	"log"
-	"os/exec"
+	"sort"
 	"strings"
 	"time"
 
@@ -26,39 +26,79 @@ import (
 )
 
 // UpdateApplication updates the Litmus application to the latest version.
-func UpdateApplication(projectID, region string, env string, quiet bool) {
+// envVars and secretEnvVars are compared with the environment of the deployed
+// API service, and only the variables that differ are changed on the service
+// and job. An empty value removes a variable. job changes the task settings of
+// the worker job.
+func UpdateApplication(projectID, region string, env string, images ImageOptions, job JobOptions, envVars map[string]string, secretEnvVars []SecretEnvVar, quiet bool) error {
+	if err := images.Validate(); err != nil {
+		return err
+	}
+	if err := job.Validate(); err != nil {
+		return err
+	}
+	job.warn()
+	apiImage, workerImage := images.Resolve(env)
+	apiService := utils.ResourceName("litmus-api")
+	workerJob := utils.ResourceName("litmus-worker")
+
+	var diff envDiff
+	if len(envVars) > 0 || len(secretEnvVars) > 0 {
+		deployedVars, deployedSecrets, err := deployedEnv(projectID, region, apiService)
+		if err != nil {
+			return err
+		}
+		diff = diffEnv(deployedVars, deployedSecrets, envVars, secretEnvVars)
+		if !quiet {
+			diff.print()
+		}
+	}
+
 	s := spinner.New(spinner.CharSets[14], 100*time.Millisecond)
 
 	if !quiet {
-		if !utils.ConfirmPrompt(fmt.Sprintf("\nThis will update Litmus resources in the project '%s'. Are you sure you want to continue?", projectID)) {
+		confirmed, err := utils.ConfirmPrompt(fmt.Sprintf("\nThis will update Litmus resources in the project '%s'. Are you sure you want to continue?", projectID))
+		if err != nil {
+			return err
+		}
+		if !confirmed {
 			fmt.Println("\nAborting update.")
-			return
+			return nil
+		}
+	}
+
+	if len(secretEnvVars) > 0 {
+		serviceAccounts := []string{
+			fmt.Sprintf("%s@%s.iam.gserviceaccount.com", utils.ServiceAccountID(projectID, "api"), projectID),
+			fmt.Sprintf("%s@%s.iam.gserviceaccount.com", utils.ServiceAccountID(projectID, "worker"), projectID),
+		}
+		if err := prepareSecretEnvVars(projectID, secretEnvVars, serviceAccounts, quiet); err != nil {
+			return fmt.Errorf("error configuring secret-backed environment variables: %v", err)
 		}
 	}
 
-    // --- Update Cloud Run service ---
+	// --- Update Cloud Run service ---
 	if !quiet {
-		s.Suffix = " Updating Cloud Run service 'litmus-api'... "
+		s.Suffix = fmt.Sprintf(" Updating Cloud Run service '%s'... ", apiService)
 		s.Start()
 		defer s.Stop()
 	}
 
-	apiImage := fmt.Sprintf("europe-docker.pkg.dev/litmusai-%s/litmus/api:latest",env)
-
-	updateServiceCmd := exec.Command(
-		"gcloud", "run", "deploy", "litmus-api",
+	updateServiceCmd := utils.Command(
+		"gcloud", "run", "deploy", apiService,
 		"--project", projectID,
 		"--region", region,
-		"--image", apiImage, 
+		"--image", apiImage,
 		"--no-traffic", // Stop traffic during the update
 	)
+	updateServiceCmd.Args = append(updateServiceCmd.Args, diff.args()...)
 	output, err := updateServiceCmd.CombinedOutput()
 	if err != nil {
-		log.Fatalf("Error updating Cloud Run service: %v\nOutput: %s", err, output)
+		return fmt.Errorf("error updating Cloud Run service: %v\nOutput: %s", err, output)
 	}
 
 	if !quiet {
-		fmt.Println("Done! Updated API.\n")
+		fmt.Print("Done! Updated API.\n\n")
 	}
 	// Route traffic back to the updated service
 	if !quiet {
@@ -67,39 +107,39 @@ func UpdateApplication(projectID, region string, env string, quiet bool) {
 		defer s.Stop()
 	}
 
-	routeTrafficCmd := exec.Command(
-		"gcloud", "run", "services", "update-traffic", "litmus-api",
+	routeTrafficCmd := utils.Command(
+		"gcloud", "run", "services", "update-traffic", apiService,
 		"--project", projectID,
 		"--region", region,
 		"--to-latest",
 	)
 	if err := routeTrafficCmd.Run(); err != nil {
-		log.Fatalf("Error routing traffic to the updated service: %v", err)
+		return fmt.Errorf("error routing traffic to the updated service: %v", err)
 	}
 
 	if !quiet {
 		fmt.Println("Done! Routed traffic to the updated service.")
 	}
 
-    // --- Update Cloud Run job ---
+	// --- Update Cloud Run job ---
 	if !quiet {
-		s.Suffix = " Updating Cloud Run job 'litmus-worker'... "
+		s.Suffix = fmt.Sprintf(" Updating Cloud Run job '%s'... ", workerJob)
 		s.Start()
 		defer s.Stop()
 	}
 
-	workerImage := fmt.Sprintf("europe-docker.pkg.dev/litmusai-%s/litmus/worker:latest",env)
-
-	updateJobCmd := exec.Command(
-		"gcloud", "run", "jobs", "update", "litmus-worker", 
+	updateJobCmd := utils.Command(
+		"gcloud", "run", "jobs", "update", workerJob,
 		"--project", projectID,
 		"--region", region,
-		"--image", workerImage, 
+		"--image", workerImage,
 	)
+	updateJobCmd.Args = append(updateJobCmd.Args, diff.args()...)
+	updateJobCmd.Args = append(updateJobCmd.Args, job.args()...)
 	output, err = updateJobCmd.CombinedOutput()
 	if err != nil {
 		if !strings.Contains(string(output), "already exists with the same image") {
-			log.Fatalf("Error updating Cloud Run job: %v\nOutput: %s", err, output)
+			return fmt.Errorf("error updating Cloud Run job: %v\nOutput: %s", err, output)
 		} else if !quiet { // If the job exists with the same image, inform the user
 			fmt.Println("Cloud Run job already up-to-date.")
 		}
@@ -110,4 +150,218 @@ func UpdateApplication(projectID, region string, env string, quiet bool) {
 	if !quiet {
 		fmt.Println("\nLitmus application updated successfully!")
 	}
-}
\ No newline at end of file
+	return nil
+}
+
+// CheckForUpdate compares the image digest of the deployed 'litmus-api' service
+// against the digest of the latest image for the given environment (or the
+// overridden API image).
+// It returns true if an update is available.
+func CheckForUpdate(projectID, region, env string, images ImageOptions, quiet bool) (bool, error) {
+	if err := images.Validate(); err != nil {
+		return false, err
+	}
+	apiImage, _ := images.Resolve(env)
+
+	deployedDigest, err := deployedAPIDigest(projectID, region)
+	if err != nil {
+		return false, err
+	}
+
+	// Get the image digest of the latest tag in Artifact Registry
+	latestCmd := utils.Command(
+		"gcloud", "artifacts", "docker", "images", "describe", apiImage,
+		"--format=value(image_summary.digest)",
+	)
+	output, err := latestCmd.CombinedOutput()
+	if err != nil {
+		return false, fmt.Errorf("error describing image '%s': %v\nOutput: %s", apiImage, err, output)
+	}
+	latestDigest := extractDigest(string(output))
+
+	if deployedDigest == "" || latestDigest == "" {
+		return false, fmt.Errorf("unable to determine image digests (deployed: '%s', latest: '%s')", deployedDigest, latestDigest)
+	}
+
+	updateAvailable := deployedDigest != latestDigest
+	if !quiet {
+		fmt.Println("Deployed image digest:", deployedDigest)
+		fmt.Println("Latest image digest:  ", latestDigest)
+		if updateAvailable {
+			fmt.Println("An update is available. Run 'litmus update' to apply it.")
+		} else {
+			fmt.Println("Litmus is up-to-date.")
+		}
+	}
+
+	return updateAvailable, nil
+}
+
+// deployedAPIDigest returns the image digest of the revision currently
+// serving the 'litmus-api' service.
+func deployedAPIDigest(projectID, region string) (string, error) {
+	// Get the revision currently serving the service
+	apiService := utils.ResourceName("litmus-api")
+	revisionCmd := utils.Command(
+		"gcloud", "run", "services", "describe", apiService,
+		"--project", projectID,
+		"--region", region,
+		"--format=value(status.latestReadyRevisionName)",
+	)
+	output, err := revisionCmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("error describing Cloud Run service: %v\nOutput: %s", err, output)
+	}
+	revision := strings.TrimSpace(string(output))
+	if revision == "" {
+		return "", fmt.Errorf("no ready revision found for service '%s'", apiService)
+	}
+
+	// Get the image digest of the deployed revision
+	deployedCmd := utils.Command(
+		"gcloud", "run", "revisions", "describe", revision,
+		"--project", projectID,
+		"--region", region,
+		"--format=value(status.imageDigest)",
+	)
+	output, err = deployedCmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("error describing Cloud Run revision: %v\nOutput: %s", err, output)
+	}
+	return extractDigest(string(output)), nil
+}
+
+// extractDigest extracts the "sha256:..." digest from gcloud output,
+// which may be either a bare digest or a fully qualified image reference.
+func extractDigest(output string) string {
+	output = strings.TrimSpace(output)
+	if i := strings.LastIndex(output, "@"); i != -1 {
+		output = output[i+1:]
+	}
+	return output
+}
+
+// envDiff is the change update applies to the API and worker environment.
+type envDiff struct {
+	updated        map[string]string // Added or changed variables
+	secrets        map[string]string // Added or changed secrets, as SECRET:VERSION
+	removed        []string          // Variables to remove
+	removedSecrets []string          // Secret-backed variables to remove
+	lines          []string          // Human-readable description of each change
+}
+
+// deployedEnv returns the plain and secret-backed environment variables of a
+// Cloud Run service. Secret references are returned as SECRET:VERSION.
+func deployedEnv(projectID, region, serviceName string) (map[string]string, map[string]string, error) {
+	describeCmd := utils.Command(
+		"gcloud", "run", "services", "describe", serviceName,
+		"--project", projectID,
+		"--region", region,
+		"--format=json",
+	)
+	output, err := describeCmd.Output()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error describing Cloud Run service '%s': %v", serviceName, err)
+	}
+	var service map[string]interface{}
+	if err := json.Unmarshal(output, &service); err != nil {
+		return nil, nil, fmt.Errorf("error parsing JSON output: %v", err)
+	}
+
+	vars := make(map[string]string)
+	secrets := make(map[string]string)
+	for _, entry := range containerEnv(service) {
+		variable, _ := entry.(map[string]interface{})
+		name, _ := variable["name"].(string)
+		if valueFrom, ok := variable["valueFrom"].(map[string]interface{}); ok {
+			ref, _ := valueFrom["secretKeyRef"].(map[string]interface{})
+			secret, _ := ref["name"].(string)
+			version, _ := ref["key"].(string)
+			secrets[name] = secret + ":" + version
+			continue
+		}
+		value, _ := variable["value"].(string)
+		vars[name] = value
+	}
+	return vars, secrets, nil
+}
+
+// diffEnv compares the requested variables with the deployed ones.
+func diffEnv(deployedVars, deployedSecrets, envVars map[string]string, secretEnvVars []SecretEnvVar) envDiff {
+	diff := envDiff{updated: make(map[string]string), secrets: make(map[string]string)}
+
+	names := make([]string, 0, len(envVars))
+	for name := range envVars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := envVars[name]
+		current, deployed := deployedVars[name]
+		_, deployedAsSecret := deployedSecrets[name]
+		switch {
+		case value == "" && deployed:
+			diff.removed = append(diff.removed, name)
+			diff.lines = append(diff.lines, fmt.Sprintf("- %s", name))
+		case value == "" && deployedAsSecret:
+			diff.removedSecrets = append(diff.removedSecrets, name)
+			diff.lines = append(diff.lines, fmt.Sprintf("- %s", name))
+		case value == "":
+			// Removing a variable that isn't set is a no-op
+		case !deployed:
+			diff.updated[name] = value
+			diff.lines = append(diff.lines, fmt.Sprintf("+ %s=%s", name, value))
+		case current != value:
+			diff.updated[name] = value
+			diff.lines = append(diff.lines, fmt.Sprintf("~ %s=%s (was %s)", name, value, current))
+		}
+	}
+
+	for _, secretEnvVar := range secretEnvVars {
+		ref := secretEnvVar.Secret + ":" + secretEnvVar.Version
+		current, deployed := deployedSecrets[secretEnvVar.Name]
+		switch {
+		case !deployed:
+			diff.secrets[secretEnvVar.Name] = ref
+			diff.lines = append(diff.lines, fmt.Sprintf("+ %s from secret %s", secretEnvVar.Name, ref))
+		case current != ref:
+			diff.secrets[secretEnvVar.Name] = ref
+			diff.lines = append(diff.lines, fmt.Sprintf("~ %s from secret %s (was %s)", secretEnvVar.Name, ref, current))
+		case secretEnvVar.Value != "":
+			// The reference is unchanged, the new value is picked up by the
+			// new revision when the version is "latest"
+			diff.lines = append(diff.lines, fmt.Sprintf("~ %s from secret %s (new value)", secretEnvVar.Name, ref))
+		}
+	}
+	return diff
+}
+
+// args returns the gcloud flags applying the diff.
+func (d envDiff) args() []string {
+	var args []string
+	for name, value := range d.updated {
+		args = append(args, "--update-env-vars", fmt.Sprintf("%s=%s", name, value))
+	}
+	for name, ref := range d.secrets {
+		args = append(args, "--update-secrets", fmt.Sprintf("%s=%s", name, ref))
+	}
+	if len(d.removed) > 0 {
+		args = append(args, "--remove-env-vars", strings.Join(d.removed, ","))
+	}
+	if len(d.removedSecrets) > 0 {
+		args = append(args, "--remove-secrets", strings.Join(d.removedSecrets, ","))
+	}
+	return args
+}
+
+// print describes the diff.
+func (d envDiff) print() {
+	if len(d.lines) == 0 {
+		fmt.Println("Environment variables are unchanged.")
+		return
+	}
+	fmt.Println("Environment variable changes:")
+	for _, line := range d.lines {
+		fmt.Println("  " + line)
+	}
+}
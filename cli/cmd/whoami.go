@@ -0,0 +1,55 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/google/litmus/cli/utils"
+)
+
+// ShowWhoami prints the project, region and gcloud account commands will act
+// on, where the project and region came from, and whether Litmus is deployed
+// in the project.
+func ShowWhoami(projectID, projectSource, region, regionSource string) error {
+	account, err := utils.GetGcloudAccount()
+	if err != nil {
+		return err
+	}
+	if account == "" {
+		account = "(none, run 'gcloud auth login')"
+	}
+
+	if projectID == "" {
+		fmt.Println("Project: (none, pass --project or run 'gcloud config set project <project_id>')")
+		fmt.Printf("Region:  %s (%s)\n", region, regionSource)
+		fmt.Printf("Account: %s\n", account)
+		return nil
+	}
+
+	fmt.Printf("Project: %s (%s)\n", projectID, projectSource)
+	fmt.Printf("Region:  %s (%s)\n", region, regionSource)
+	fmt.Printf("Account: %s\n", account)
+	if utils.Instance != "" {
+		fmt.Printf("Instance: %s\n", utils.Instance)
+	}
+
+	if _, err := utils.AccessSecret(projectID, utils.ResourceName("litmus-service-url")); err != nil {
+		fmt.Println("Litmus:  not deployed (or the service URL secret is not accessible)")
+	} else {
+		fmt.Println("Litmus:  deployed")
+	}
+	return nil
+}
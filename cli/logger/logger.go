@@ -0,0 +1,191 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level represents the severity of a log message.
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// String returns the lowercase name of the level.
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	default:
+		return fmt.Sprintf("level(%d)", int(l))
+	}
+}
+
+// Format is the encoding of log messages.
+type Format int
+
+const (
+	FormatText Format = iota // "[INFO] message"
+	FormatJSON               // One JSON object per line
+)
+
+var (
+	mu     sync.Mutex
+	level            = LevelInfo
+	format           = FormatText
+	output io.Writer = os.Stderr
+)
+
+// ParseLevel converts a level name (debug, info, warn, error) into a Level.
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "debug":
+		return LevelDebug, nil
+	case "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	default:
+		return LevelInfo, fmt.Errorf("invalid log level '%s' (expected debug, info, warn or error)", name)
+	}
+}
+
+// ParseFormat converts a format name (text, json) into a Format.
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "text":
+		return FormatText, nil
+	case "json":
+		return FormatJSON, nil
+	default:
+		return FormatText, fmt.Errorf("invalid log format '%s' (expected text or json)", name)
+	}
+}
+
+// SetFormat sets the encoding of log messages. With FormatJSON, step events
+// (see Event) are written too.
+func SetFormat(f Format) {
+	mu.Lock()
+	defer mu.Unlock()
+	format = f
+}
+
+// SetLevel sets the minimum level of messages that are written.
+func SetLevel(l Level) {
+	mu.Lock()
+	defer mu.Unlock()
+	level = l
+}
+
+// GetLevel returns the current minimum level.
+func GetLevel() Level {
+	mu.Lock()
+	defer mu.Unlock()
+	return level
+}
+
+// SetOutput sets the destination for log messages (default: stderr).
+func SetOutput(w io.Writer) {
+	mu.Lock()
+	defer mu.Unlock()
+	output = w
+}
+
+// Enabled reports whether messages at the given level are written.
+func Enabled(l Level) bool {
+	return l >= GetLevel()
+}
+
+// Debugf logs a debug message.
+func Debugf(format string, args ...interface{}) {
+	logf(LevelDebug, format, args...)
+}
+
+// Infof logs an informational message.
+func Infof(format string, args ...interface{}) {
+	logf(LevelInfo, format, args...)
+}
+
+// Warnf logs a warning message.
+func Warnf(format string, args ...interface{}) {
+	logf(LevelWarn, format, args...)
+}
+
+// Errorf logs an error message.
+func Errorf(format string, args ...interface{}) {
+	logf(LevelError, format, args...)
+}
+
+// Event records the outcome of a step of a long-running operation, such as
+// a deploy, for automation. It is only written with FormatJSON, as
+// {"step", "status", "detail", "duration_ms"}.
+func Event(step, status, detail string, duration time.Duration) {
+	mu.Lock()
+	defer mu.Unlock()
+	if format != FormatJSON {
+		return
+	}
+	writeJSON(struct {
+		Step       string `json:"step"`
+		Status     string `json:"status"`
+		Detail     string `json:"detail"`
+		DurationMs int64  `json:"duration_ms"`
+	}{step, status, detail, duration.Milliseconds()})
+}
+
+func logf(l Level, msgFormat string, args ...interface{}) {
+	mu.Lock()
+	defer mu.Unlock()
+	if l < level {
+		return
+	}
+	message := strings.TrimRight(fmt.Sprintf(msgFormat, args...), "\n")
+	if format == FormatJSON {
+		writeJSON(struct {
+			Level   string `json:"level"`
+			Message string `json:"message"`
+		}{l.String(), message})
+		return
+	}
+	fmt.Fprintf(output, "[%s] %s\n", strings.ToUpper(l.String()), message)
+}
+
+// writeJSON writes v as a single line. The caller must hold mu.
+func writeJSON(v interface{}) {
+	line, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(output, "%s\n", line)
+}
@@ -15,19 +15,29 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/google/litmus/cli/analytics"
+	"github.com/google/litmus/cli/client"
 	"github.com/google/litmus/cli/cmd"
+	"github.com/google/litmus/cli/logger"
 	"github.com/google/litmus/cli/tunnel"
 	"github.com/google/litmus/cli/utils"
 	"github.com/google/uuid"
 )
 
 func main() {
+	defer utils.CloseSecrets()
+
 	// Get default project ID
 	projectID, err := utils.GetDefaultProjectID()
 	if err != nil {
@@ -42,35 +52,371 @@ func main() {
 	}
 
 	command := os.Args[1]
-	region := "us-central1" // Default region
+	region := utils.DefaultRegion
+	projectSource := "gcloud config"
+	if os.Getenv("CLOUDSDK_CORE_PROJECT") != "" {
+		projectSource = "CLOUDSDK_CORE_PROJECT"
+	}
+	regionSource := "default"
 	var runID string
-	quiet := false           // Check for --quiet flag
-	preserveData := false // Flag to preserve data
+	quiet := false               // Check for --quiet flag
+	preserveData := false        // Flag to preserve data
+	keepServiceAccounts := false // Keep the service accounts on destroy
+	check := false               // Only check for updates
+	envFile := ""                // Optional dotenv-style file with environment variables
+	cliEnvVars := make(map[string]string)
+	var secretEnvVars []cmd.SecretEnvVar
+	logLevel := ""                     // Explicit log level, overrides --quiet
+	logFormat := ""                    // Log format: text or json
+	progress := ""                     // Progress format: spinner or json
+	jsonOutput := false                // Print JSON instead of tables
+	filePath := ""                     // Input file for commands that read one (e.g. templates create)
+	wait := false                      // Block until a started run completes
+	var timeout time.Duration          // Maximum time to wait or deploy, 0 is no limit
+	stream := false                    // Print execute responses as they arrive
+	upstreamURL := ""                  // Upstream host for proxy deploy
+	serviceName := ""                  // Explicit service name for proxy deploy
+	imageTag := ""                     // Image tag for proxy update
+	var images cmd.ImageOptions        // API and worker image overrides
+	var job cmd.JobOptions             // Worker job task settings
+	var firestore cmd.FirestoreOptions // Firestore database used by deploy
+	kmsKey := ""                       // Customer-managed encryption key for deploy
+	logFilter := ""                    // Extra filter for the analytics log sinks
+	var since time.Duration            // How far back analytics backfill reads logs
+	var tableExpiration time.Duration  // Lifetime of analytics table partitions, 0 keeps them
+	var runFilter client.RunFilter     // Runs shown by ls
+	dataset := ""                      // Dataset named in analytics export-schema
+	health := false                    // Probe the API and worker in status
+	verbose := false                   // Show deployed image versions in status
+	var destroyOnly []string           // Resource groups to destroy, all if empty
+	outputPath := ""                   // Output file for export
+	inputPath := ""                    // Input archive for import
+	onConflict := ""                   // What import does with existing templates
+	passwordStdin := false             // Read the Litmus password from stdin
+	printOnly := false                 // Print the proxy URL instead of opening it
+	updateOnly := false                // Only redeploy the service and job in deploy
+	labels := make(map[string]string)  // Labels for deployed resources
+	litmusContext := ""                // Litmus context of proxy test requests
+	reveal := false                    // Show sensitive values in secrets show
+	releaseURL := ""                   // Base URL of the published CLI for self-update
+	dryRun := false                    // Print what analytics deploy would do
 
 	// Parse command-line arguments
-	args := os.Args[2:] // Skip program name and command
+	args := os.Args[2:]     // Skip program name and command
+	var positional []string // Arguments that are neither flags nor flag values
 	for i := 0; i < len(args); i++ {
 		switch args[i] {
 		case "--project":
 			if i+1 < len(args) {
 				projectID = args[i+1]
+				projectSource = "--project flag"
 				i++ // Skip the next argument (project ID)
 			} else {
 				fmt.Println("Error: --project flag requires an argument")
-				return
+				os.Exit(utils.ExitUserError)
 			}
 		case "--region":
 			if i+1 < len(args) {
 				region = args[i+1]
+				regionSource = "--region flag"
 				i++ // Skip the next argument (region)
 			} else {
 				fmt.Println("Error: --region flag requires an argument")
-				return
+				os.Exit(utils.ExitUserError)
 			}
 		case "--quiet":
 			quiet = true
+		case "--yes", "-y":
+			utils.AssumeYes = true
+		case "--instance", "--name-suffix":
+			if i+1 < len(args) {
+				if err := utils.ValidateInstance(args[i+1]); err != nil {
+					fmt.Println("Error:", err)
+					os.Exit(utils.ExitUserError)
+				}
+				utils.Instance = args[i+1]
+				i++ // Skip the next argument (instance)
+			} else {
+				fmt.Printf("Error: %s flag requires an argument\n", args[i])
+				os.Exit(utils.ExitUserError)
+			}
+		case "--json":
+			jsonOutput = true
+		case "--file":
+			if i+1 < len(args) {
+				filePath = args[i+1]
+				i++ // Skip the next argument (file path)
+			} else {
+				fmt.Println("Error: --file flag requires an argument")
+				os.Exit(utils.ExitUserError)
+			}
+		case "--context":
+			if i+1 < len(args) {
+				litmusContext = args[i+1]
+				i++
+			} else {
+				fmt.Println("Error: --context flag requires an argument")
+				os.Exit(utils.ExitUserError)
+			}
+		case "--status":
+			if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+				runFilter.Status = args[i+1]
+				i++ // Skip the next argument (status)
+			} else {
+				fmt.Println("Error: --status flag requires an argument")
+				os.Exit(utils.ExitUserError)
+			}
+		case "--template":
+			if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+				runFilter.TemplateID = args[i+1]
+				i++ // Skip the next argument (template ID)
+			} else {
+				fmt.Println("Error: --template flag requires an argument")
+				os.Exit(utils.ExitUserError)
+			}
+		case "--dataset":
+			if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+				dataset = args[i+1]
+				i++ // Skip the next argument (dataset)
+			} else {
+				fmt.Println("Error: --dataset flag requires an argument")
+				os.Exit(utils.ExitUserError)
+			}
+		case "--log-level":
+			if i+1 < len(args) {
+				logLevel = args[i+1]
+				i++ // Skip the next argument (log level)
+			} else {
+				fmt.Println("Error: --log-level flag requires an argument")
+				os.Exit(utils.ExitUserError)
+			}
+		case "--log-format":
+			if i+1 < len(args) {
+				logFormat = args[i+1]
+				i++ // Skip the next argument (log format)
+			} else {
+				fmt.Println("Error: --log-format flag requires an argument")
+				os.Exit(utils.ExitUserError)
+			}
+		case "--progress":
+			if i+1 < len(args) {
+				progress = args[i+1]
+				i++ // Skip the next argument (progress format)
+			} else {
+				fmt.Println("Error: --progress flag requires an argument")
+				os.Exit(utils.ExitUserError)
+			}
+		case "--upstreamURL", "--upstream-url":
+			if i+1 < len(args) && args[i+1] != "" && !strings.HasPrefix(args[i+1], "-") {
+				upstreamURL = args[i+1]
+				i++ // Skip the next argument (upstream URL)
+			} else {
+				fmt.Printf("Error: %s flag requires an argument\n", args[i])
+				os.Exit(utils.ExitUserError)
+			}
+		case "--name":
+			if i+1 < len(args) {
+				serviceName = args[i+1]
+				i++ // Skip the next argument (service name)
+			} else {
+				fmt.Println("Error: --name flag requires an argument")
+				os.Exit(utils.ExitUserError)
+			}
+		case "--log-filter":
+			if i+1 < len(args) {
+				logFilter = args[i+1]
+				i++ // Skip the next argument (log filter)
+			} else {
+				fmt.Println("Error: --log-filter flag requires an argument")
+				os.Exit(utils.ExitUserError)
+			}
+		case "--kms-key":
+			if i+1 < len(args) {
+				kmsKey = args[i+1]
+				i++ // Skip the next argument (KMS key)
+			} else {
+				fmt.Println("Error: --kms-key flag requires an argument")
+				os.Exit(utils.ExitUserError)
+			}
+		case "--image-repo", "--api-image", "--worker-image":
+			if i+1 < len(args) {
+				switch args[i] {
+				case "--image-repo":
+					images.Repo = strings.TrimSuffix(args[i+1], "/")
+				case "--api-image":
+					images.API = args[i+1]
+				case "--worker-image":
+					images.Worker = args[i+1]
+				}
+				i++ // Skip the next argument (image)
+			} else {
+				fmt.Printf("Error: %s flag requires an argument\n", args[i])
+				os.Exit(utils.ExitUserError)
+			}
+		case "--tasks", "--parallelism":
+			if i+1 < len(args) {
+				parsed, err := strconv.Atoi(args[i+1])
+				if err != nil || parsed <= 0 {
+					fmt.Printf("Error: %s requires a positive number\n", args[i])
+					os.Exit(utils.ExitUserError)
+				}
+				if args[i] == "--tasks" {
+					job.Tasks = parsed
+				} else {
+					job.Parallelism = parsed
+				}
+				i++ // Skip the next argument (count)
+			} else {
+				fmt.Printf("Error: %s flag requires an argument\n", args[i])
+				os.Exit(utils.ExitUserError)
+			}
+		case "--task-timeout":
+			if i+1 < len(args) {
+				parsed, err := time.ParseDuration(args[i+1])
+				if err != nil || parsed <= 0 {
+					fmt.Println("Error: --task-timeout requires a positive duration (e.g. 2h)")
+					os.Exit(utils.ExitUserError)
+				}
+				job.TaskTimeout = parsed
+				i++ // Skip the next argument (task timeout)
+			} else {
+				fmt.Println("Error: --task-timeout flag requires an argument")
+				os.Exit(utils.ExitUserError)
+			}
+		case "--image-tag":
+			if i+1 < len(args) {
+				imageTag = args[i+1]
+				i++ // Skip the next argument (image tag)
+			} else {
+				fmt.Println("Error: --image-tag flag requires an argument")
+				os.Exit(utils.ExitUserError)
+			}
+		case "--output", "-o":
+			if i+1 < len(args) {
+				outputPath = args[i+1]
+				i++ // Skip the next argument (output path)
+			} else {
+				fmt.Println("Error: --output flag requires an argument")
+				os.Exit(utils.ExitUserError)
+			}
+		case "--input", "-i":
+			if i+1 < len(args) {
+				inputPath = args[i+1]
+				i++ // Skip the next argument (input path)
+			} else {
+				fmt.Println("Error: --input flag requires an argument")
+				os.Exit(utils.ExitUserError)
+			}
+		case "--on-conflict":
+			if i+1 < len(args) {
+				onConflict = args[i+1]
+				i++ // Skip the next argument (conflict mode)
+			} else {
+				fmt.Println("Error: --on-conflict flag requires an argument")
+				os.Exit(utils.ExitUserError)
+			}
+		case "--only":
+			if i+1 < len(args) {
+				targets, err := cmd.ParseDestroyTargets(args[i+1])
+				if err != nil {
+					fmt.Println("Error:", err)
+					os.Exit(utils.ExitUserError)
+				}
+				destroyOnly = targets
+				i++ // Skip the next argument (resource list)
+			} else {
+				fmt.Println("Error: --only flag requires an argument")
+				os.Exit(utils.ExitUserError)
+			}
+		case "--password-stdin":
+			passwordStdin = true
+		case "--reveal":
+			reveal = true
+		case "--print":
+			printOnly = true
+		case "--verbose", "-v":
+			verbose = true
+		case "--health":
+			health = true
+		case "--stream":
+			stream = true
+		case "--wait":
+			wait = true
+		case "--timeout":
+			if i+1 < len(args) {
+				parsed, err := time.ParseDuration(args[i+1])
+				if err != nil || parsed <= 0 {
+					fmt.Println("Error: --timeout requires a positive duration (e.g. 30m)")
+					os.Exit(utils.ExitUserError)
+				}
+				timeout = parsed
+				i++ // Skip the next argument (timeout)
+			} else {
+				fmt.Println("Error: --timeout flag requires an argument")
+				os.Exit(utils.ExitUserError)
+			}
+		case "--since":
+			if i+1 < len(args) {
+				parsed, err := analytics.ParseSince(args[i+1])
+				if err != nil {
+					fmt.Println("Error: --since requires a positive duration (e.g. 24h or 7d)")
+					os.Exit(utils.ExitUserError)
+				}
+				since = parsed
+				i++ // Skip the next argument (since)
+			} else {
+				fmt.Println("Error: --since flag requires an argument")
+				os.Exit(utils.ExitUserError)
+			}
+		case "--table-expiration":
+			if i+1 < len(args) {
+				parsed, err := analytics.ParseSince(args[i+1])
+				if err != nil {
+					fmt.Println("Error: --table-expiration requires a positive duration (e.g. 720h or 90d)")
+					os.Exit(utils.ExitUserError)
+				}
+				tableExpiration = parsed
+				i++ // Skip the next argument (table expiration)
+			} else {
+				fmt.Println("Error: --table-expiration flag requires an argument")
+				os.Exit(utils.ExitUserError)
+			}
 		case "--preserve-data":
 			preserveData = true
+		case "--keep-service-accounts":
+			keepServiceAccounts = true
+		case "--dry-run":
+			dryRun = true
+		case "--update-only":
+			updateOnly = true
+		case "--skip-firestore":
+			firestore.Skip = true
+		case "--firestore-database":
+			if i+1 < len(args) {
+				firestore.Database = args[i+1]
+				i++ // Skip the next argument (database ID)
+			} else {
+				fmt.Println("Error: --firestore-database flag requires an argument")
+				os.Exit(utils.ExitUserError)
+			}
+		case "--check":
+			check = true
+		case "--release-url":
+			if i+1 < len(args) {
+				releaseURL = args[i+1]
+				i++ // Skip the next argument (release URL)
+			} else {
+				fmt.Println("Error: --release-url flag requires an argument")
+				os.Exit(utils.ExitUserError)
+			}
+		case "--env-file":
+			if i+1 < len(args) {
+				envFile = args[i+1]
+				i++ // Skip the next argument (env file path)
+			} else {
+				fmt.Println("Error: --env-file flag requires an argument")
+				os.Exit(utils.ExitUserError)
+			}
 		case "open": // Assuming "open" might also need a runID
 			if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
 				runID = args[i+1]
@@ -83,64 +429,212 @@ func main() {
 				i++
 			} else {
 				fmt.Println("Error: 'run' command requires a runID argument")
-				return
+				os.Exit(utils.ExitUserError)
+			}
+		case "--label", "--labels":
+			if i+1 < len(args) {
+				if err := utils.ParseLabels(args[i+1], labels); err != nil {
+					fmt.Println("Error:", err)
+					os.Exit(utils.ExitUserError)
+				}
+				i++
+			} else {
+				fmt.Printf("Error: %s flag requires an argument\n", args[i])
+				os.Exit(utils.ExitUserError)
+			}
+		case "--set-secret":
+			if i+1 < len(args) {
+				secretEnvVar, err := cmd.ParseSecretEnvVar(args[i+1])
+				if err != nil {
+					fmt.Println("Error:", err)
+					os.Exit(utils.ExitUserError)
+				}
+				secretEnvVars = append(secretEnvVars, secretEnvVar)
+				i++ // Skip the next argument (secret mapping)
+			} else {
+				fmt.Println("Error: --set-secret flag requires an argument")
+				os.Exit(utils.ExitUserError)
+			}
+		default:
+			// Collect positional arguments ("-" stands for stdin) and treat
+			// standalone KEY=VALUE tokens as environment variables. Flag
+			// values are consumed above and never reach this point.
+			if args[i] == "-" || !strings.HasPrefix(args[i], "-") {
+				positional = append(positional, args[i])
+				if key, value, ok := strings.Cut(args[i], "="); ok && key != "" {
+					cliEnvVars[key] = value
+				}
 			}
 		}
 	}
 
-	// Extract environment variables from command-line arguments
+	// Configure logging: --quiet only shows errors unless --log-level is given
+	if logLevel != "" {
+		level, err := logger.ParseLevel(logLevel)
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(utils.ExitUserError)
+		}
+		logger.SetLevel(level)
+	} else if quiet {
+		logger.SetLevel(logger.LevelError)
+	}
+	if logFormat != "" {
+		format, err := logger.ParseFormat(logFormat)
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(utils.ExitUserError)
+		}
+		logger.SetFormat(format)
+	}
+	if progress != "" {
+		if err := cmd.SetProgressFormat(progress); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(utils.ExitUserError)
+		}
+	}
+
+	if passwordStdin {
+		if err := utils.ReadPasswordFromStdin(); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(utils.ExitUserError)
+		}
+	}
+
+	// Merge environment variables: file values first, explicit CLI pairs override
 	envVars := make(map[string]string)
-	for _, arg := range args {
-		// Skip flags and commands
-		if strings.HasPrefix(arg, "-") || arg == command {
-			continue
+	if envFile != "" {
+		fileEnvVars, err := utils.ReadEnvFile(envFile)
+		if err != nil {
+			fmt.Println("Error reading env file:", err)
+			os.Exit(utils.ExitUserError)
 		}
-		parts := strings.Split(arg, "=")
-		if len(parts) == 2 {
-			envVars[parts[0]] = parts[1]
+		for key, value := range fileEnvVars {
+			envVars[key] = value
+		}
+	}
+	for key, value := range cliEnvVars {
+		envVars[key] = value
+	}
+
+	// Catch region typos before anything is created
+	switch command {
+	case "deploy", "update", "proxy":
+		if err := utils.ValidateRegion(region); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(utils.ExitUserError)
 		}
 	}
 
 	switch command {
 	case "deploy":
 		env := "prod"
-		if len(args) > 0 && !strings.HasPrefix(args[0], "-") { // Check if a service name is provided
+		if len(args) > 0 && !strings.HasPrefix(args[0], "-") && !strings.Contains(args[0], "=") { // Check if a service name is provided
 			env = args[0]
 		}
-		cmd.DeployApplication(projectID, region, envVars, env, quiet)
+		if err := cmd.DeployApplication(projectID, region, envVars, secretEnvVars, env, images, job, firestore, kmsKey, logFilter, labels, tableExpiration, timeout, updateOnly, quiet); err != nil {
+			utils.HandleGcloudError(err)
+		}
 	case "destroy":
-		cmd.DestroyResources(projectID, region, preserveData, quiet)
+		if err := cmd.DestroyResources(projectID, region, destroyOnly, preserveData, keepServiceAccounts, quiet); err != nil {
+			utils.HandleGcloudError(err)
+		}
 	case "update":
 		env := "prod"
-		if len(args) > 0 && !strings.HasPrefix(args[0], "-") { // Check if a service name is provided
+		if len(args) > 0 && !strings.HasPrefix(args[0], "-") && !strings.Contains(args[0], "=") { // Check if a service name is provided
 			env = args[0]
 		}
-		cmd.UpdateApplication(projectID, region, env, quiet)
-	case "execute":
-		if len(args) < 1 {
-			fmt.Println("Usage: litmus execute <payload>")
+		if check {
+			updateAvailable, err := cmd.CheckForUpdate(projectID, region, env, images, quiet)
+			if err != nil {
+				utils.HandleGcloudError(err)
+			}
+			if updateAvailable {
+				os.Exit(utils.ExitCheckFailed) // Non-zero so CI can gate on pending updates
+			}
 			return
 		}
-		payload := args[0]
-		cmd.ExecutePayload(projectID, payload)
+		if err := cmd.UpdateApplication(projectID, region, env, images, job, envVars, secretEnvVars, quiet); err != nil {
+			utils.HandleGcloudError(err)
+		}
+	case "execute":
+		var payload interface{}
+		source := ""
+		if filePath == "" {
+			if len(positional) > 0 {
+				source = positional[0]
+			}
+			// Without an argument, a piped stdin holds the payload
+			if source == "" && !utils.IsInteractive() {
+				source = "-"
+			}
+		}
+		switch {
+		case filePath != "":
+			file, err := os.Open(filePath)
+			if err != nil {
+				fmt.Println("Error:", err)
+				os.Exit(utils.ExitUserError)
+			}
+			payload, err = cmd.ReadPayload(file, filePath)
+			file.Close()
+			if err != nil {
+				fmt.Println("Error:", err)
+				os.Exit(utils.ExitUserError)
+			}
+		case source == "-":
+			if passwordStdin {
+				fmt.Println("Error: --password-stdin can't be combined with a payload read from stdin")
+				os.Exit(utils.ExitUserError)
+			}
+			var err error
+			payload, err = cmd.ReadPayload(os.Stdin, "stdin")
+			if err != nil {
+				fmt.Println("Error:", err)
+				os.Exit(utils.ExitUserError)
+			}
+		case source != "":
+			payload = source
+		default:
+			fmt.Println("Usage: litmus execute <payload|-> [--file <path>] [--stream]")
+			os.Exit(utils.ExitUserError)
+		}
+		if err := cmd.ExecutePayload(projectID, payload, stream); err != nil {
+			utils.HandleGcloudError(err)
+		}
 	case "ls":
-		cmd.ListRuns(projectID)
+		if since > 0 {
+			runFilter.Since = time.Now().Add(-since)
+		}
+		if err := cmd.ListRuns(projectID, runFilter); err != nil {
+			utils.HandleGcloudError(err)
+		}
 	case "tunnel":
 		// Tunnel command handling
-		tunnelFlags := flag.NewFlagSet("tunnel", flag.ExitOnError)
+		tunnelFlags := flag.NewFlagSet("tunnel", flag.ContinueOnError) // Parse errors exit with ExitUserError below
 		project := tunnelFlags.String("project", "", "Project ID for the Litmus instance")
-		port := tunnelFlags.Int("port", 8081, "Local port to tunnel to")
+		port := tunnelFlags.Int("port", 8081, "Local port to tunnel to, 0 picks a free port")
+		serviceURL := tunnelFlags.String("url", "", "Litmus service URL to tunnel to (default: the deployed service)")
 		quiet := tunnelFlags.Bool("quiet", false, "Suppress verbose output")
-	
-		// Check if there are any arguments for the tunnel command's flags
-		tunnelArgs := []string{}
-		if len(args) > 1 {
-			tunnelArgs = args[1:]
-		}
-	
-		if err := tunnelFlags.Parse(tunnelArgs); err != nil { // Parse tunnel flags
+		verbose := tunnelFlags.Bool("verbose", false, "Log each request and its response status")
+		open := tunnelFlags.Bool("open", false, "Open the tunnel URL in the default browser")
+		username := tunnelFlags.String("username", "", "Basic auth username (default: admin)")
+		password := tunnelFlags.String("password", "", "Basic auth password, skips Secret Manager")
+		credentialsFile := tunnelFlags.String("credentials-file", "", "File with username:password, skips Secret Manager")
+		passthroughAuth := tunnelFlags.Bool("passthrough-auth", false, "Forward the Authorization header to the app instead of checking basic auth")
+		tunnelFlags.BoolVar(passthroughAuth, "allow-any-auth", false, "Alias for --passthrough-auth")
+		tunnelFlags.Bool("password-stdin", false, "Read the password from stdin (handled globally)")
+		tunnelFlags.String("instance", "", "Litmus instance to tunnel to (handled globally)")
+		tunnelFlags.String("name-suffix", "", "Alias for --instance (handled globally)")
+		recordDir := tunnelFlags.String("record", "", "Directory to record each request/response pair to as JSON")
+		retries := tunnelFlags.Int("retries", 2, "Retries for idempotent requests while the service is starting up")
+		duration := tunnelFlags.Duration("duration", 0, "Close the tunnel after this long (e.g. 10m), 0 runs until interrupted")
+
+		if err := tunnelFlags.Parse(args); errors.Is(err, flag.ErrHelp) {
+			return // -h or --help, the usage has been printed
+		} else if err != nil {
 			fmt.Println("Error parsing tunnel flags:", err)
-			return
+			os.Exit(utils.ExitUserError)
 		}
 
 		projectIDForTunnel := projectID
@@ -148,39 +642,93 @@ func main() {
 			projectIDForTunnel = *project
 		}
 
-		serviceURL, err := utils.AccessSecret(projectIDForTunnel, "litmus-service-url")
-		if err != nil {
-			fmt.Println("Litmus is not deployed in the specified project. Please deploy Litmus before tunneling.")
-			return
+		if *retries < 0 {
+			fmt.Println("Error: --retries must not be negative")
+			os.Exit(utils.ExitUserError)
+		}
+
+		if *duration < 0 {
+			fmt.Println("Error: --duration must not be negative")
+			os.Exit(utils.ExitUserError)
+		}
+
+		// A deadline makes the context cancellable, so CreateTunnel no longer
+		// handles the signals itself
+		ctx := context.Background()
+		if *duration > 0 {
+			var stop context.CancelFunc
+			ctx, stop = signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			ctx, stop = context.WithTimeout(ctx, *duration)
+			defer stop()
 		}
-		serviceURL = utils.RemoveAnsiEscapeSequences(serviceURL)
 
-		if err := tunnel.CreateTunnel(serviceURL, *port, *quiet, projectIDForTunnel); err != nil { // Pass the Project ID
+		err := tunnel.CreateTunnel(ctx, projectIDForTunnel, tunnel.Options{
+			ServiceURL: *serviceURL,
+			LocalPort:  *port,
+			Retries:    *retries,
+			Verbose:    *verbose,
+			Open:       *open,
+			Quiet:      *quiet,
+			RecordDir:  *recordDir,
+
+			Username:        *username,
+			Password:        *password,
+			CredentialsFile: *credentialsFile,
+			PassthroughAuth: *passthroughAuth,
+		})
+		if err != nil {
+			utils.HandleGcloudError(err)
+		}
+	case "open-proxy":
+		if len(args) < 1 || strings.HasPrefix(args[0], "-") {
+			fmt.Println("Usage: litmus open-proxy <service_name> [--region <region>] [--print]")
+			os.Exit(utils.ExitUserError)
+		}
+		if err := cmd.OpenProxy(projectID, region, args[0], printOnly); err != nil {
 			utils.HandleGcloudError(err)
 		}
 	case "open":
 		if runID != "" {
-			cmd.OpenRun(projectID, runID) // Open specific run
+			err = cmd.OpenRun(projectID, runID) // Open specific run
 		} else {
-			cmd.OpenLitmus(projectID) // Open Litmus dashboard
+			err = cmd.OpenLitmus(projectID) // Open Litmus dashboard
+		}
+		if err != nil {
+			utils.HandleGcloudError(err)
 		}
 	case "run":
+		if len(args) > 0 && args[0] == "logs" {
+			if len(args) < 2 || strings.HasPrefix(args[1], "-") {
+				fmt.Println("Usage: litmus run logs <runID>")
+				os.Exit(utils.ExitUserError)
+			}
+			if err := cmd.ShowRunLogs(projectID, args[1]); err != nil {
+				utils.HandleGcloudError(err)
+			}
+			return
+		}
+		if runID == "" && len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+			runID = args[0]
+		}
 		if runID == "" {
 			fmt.Println("Error: 'run' command requires a runID argument")
-			return
+			os.Exit(utils.ExitUserError)
+		}
+		if err := cmd.OpenRun(projectID, runID); err != nil {
+			utils.HandleGcloudError(err)
 		}
-		cmd.OpenRun(projectID, runID)
 	case "start":
 		// 1. Handle TEMPLATE_ID
 		if len(args) < 1 {
 			fmt.Println("Error: 'start' command requires a TEMPLATE_ID argument")
-			return
+			os.Exit(utils.ExitUserError)
 		}
 		templateID := args[0]
 
 		// 2. Handle RUN_ID (generate if not provided)
 		runID := ""
-		if len(args) >= 2 { // Check if runID is provided
+		if len(args) >= 2 && !strings.HasPrefix(args[1], "-") { // Check if runID is provided
 			runID = args[1]
 		} else {
 			runID = uuid.New().String() // Generate a random UUID
@@ -194,25 +742,65 @@ func main() {
 		err := cmd.SubmitRun(templateID, runID, projectID, authToken)
 		if err != nil {
 			fmt.Printf("Error submitting run: %v\n", err)
-			return
+			os.Exit(utils.ExitCode(err))
 		}
 
 		fmt.Println("Run submitted successfully.")
+
+		if wait {
+			passed, err := cmd.WaitForRun(projectID, runID, timeout)
+			if err != nil {
+				utils.HandleGcloudError(err)
+			}
+			if !passed {
+				os.Exit(utils.ExitCheckFailed)
+			}
+		}
 	case "status":
 		cmd.ShowStatus(projectID)
+		if verbose {
+			cmd.ShowImageVersions(projectID, region)
+		}
+		if health && !cmd.CheckHealth(projectID, region) {
+			os.Exit(utils.ExitCheckFailed)
+		}
 	case "version":
 		utils.DisplayVersion()
+	case "self-update":
+		updateAvailable, err := cmd.SelfUpdate(releaseURL, check, quiet)
+		if err != nil {
+			utils.HandleGcloudError(err)
+		}
+		if check && updateAvailable {
+			os.Exit(utils.ExitCheckFailed) // Non-zero so scripts can gate on pending updates
+		}
+	case "whoami":
+		if err := cmd.ShowWhoami(projectID, projectSource, region, regionSource); err != nil {
+			utils.HandleGcloudError(err)
+		}
+	case "list-all":
+		if err := cmd.ListAllResources(projectID, jsonOutput); err != nil {
+			utils.HandleGcloudError(err)
+		}
+	case "secrets":
+		if len(args) < 1 || args[0] != "show" {
+			fmt.Println("Usage: litmus secrets show [--reveal]")
+			os.Exit(utils.ExitUserError)
+		}
+		if err := cmd.ShowSecrets(projectID, reveal); err != nil {
+			utils.HandleGcloudError(err)
+		}
 	case "analytics":
 		if len(args) < 1 {
 			fmt.Println("Invalid analytics subcommand.")
-			fmt.Println("Usage: litmus analytics [deploy | destroy]")
-			return
+			fmt.Println("Usage: litmus analytics [deploy | destroy | backfill | export-schema]")
+			os.Exit(utils.ExitUserError)
 		}
 
 		subcommand := args[0]
 		switch subcommand {
 		case "deploy":
-			err := analytics.DeployAnalytics(projectID, region, quiet)
+			err := analytics.DeployAnalytics(projectID, region, kmsKey, logFilter, labels, tableExpiration, dryRun, quiet)
 			if err != nil {
 				utils.HandleGcloudError(err)
 			}
@@ -221,28 +809,117 @@ func main() {
 			if err != nil {
 				utils.HandleGcloudError(err)
 			}
+		case "export-schema":
+			if err := analytics.ExportSchema(projectID, dataset, tableExpiration, jsonOutput); err != nil {
+				utils.HandleGcloudError(err)
+			}
+		case "backfill":
+			if since == 0 {
+				fmt.Println("Error: analytics backfill requires --since (e.g. --since 7d)")
+				os.Exit(utils.ExitUserError)
+			}
+			if err := analytics.BackfillAnalytics(projectID, since, quiet); err != nil {
+				utils.HandleGcloudError(err)
+			}
 		default:
 			fmt.Println("Invalid analytics subcommand:", subcommand)
-			fmt.Println("Usage: litmus analytics [deploy | destroy]")
+			fmt.Println("Usage: litmus analytics [deploy | destroy | backfill | export-schema]")
+			os.Exit(utils.ExitUserError)
+		}
+	case "export":
+		if err := cmd.ExportData(projectID, outputPath, quiet); err != nil {
+			utils.HandleGcloudError(err)
+		}
+	case "import":
+		if err := cmd.ImportData(projectID, inputPath, onConflict, quiet); err != nil {
+			utils.HandleGcloudError(err)
+		}
+	case "domain":
+		if len(args) < 2 || args[0] != "map" || strings.HasPrefix(args[1], "-") {
+			fmt.Println("Usage: litmus domain map <domain>")
+			os.Exit(utils.ExitUserError)
+		}
+		if err := cmd.MapDomain(projectID, region, args[1], quiet); err != nil {
+			utils.HandleGcloudError(err)
+		}
+	case "templates", "template":
+		if len(args) < 1 {
+			fmt.Println("Invalid templates subcommand.")
+			fmt.Println("Usage: litmus templates [list | get <template_id> | create --file <template.json> | validate --file <template.json>] [--json]")
+			os.Exit(utils.ExitUserError)
+		}
+
+		subcommand := args[0]
+		var err error
+		switch subcommand {
+		case "list":
+			err = cmd.ListTemplates(projectID, jsonOutput)
+		case "get":
+			if len(args) < 2 || strings.HasPrefix(args[1], "-") {
+				fmt.Println("Usage: litmus templates get <template_id> [--json]")
+				os.Exit(utils.ExitUserError)
+			}
+			err = cmd.GetTemplate(projectID, args[1], jsonOutput)
+		case "create":
+			err = cmd.CreateTemplate(projectID, filePath)
+		case "validate":
+			err = cmd.ValidateTemplate(filePath)
+			if errors.Is(err, cmd.ErrInvalidTemplate) {
+				// Problems have already been reported
+				os.Exit(utils.ExitUserError)
+			} else if err != nil {
+				fmt.Println("Error:", err)
+				os.Exit(utils.ExitUserError)
+			}
+		default:
+			fmt.Println("Invalid templates subcommand:", subcommand)
+			fmt.Println("Usage: litmus templates [list | get <template_id> | create --file <template.json> | validate --file <template.json>] [--json]")
+			os.Exit(utils.ExitUserError)
+		}
+		if err != nil {
+			utils.HandleGcloudError(err)
 		}
 	case "proxy":
 		if len(args) < 1 {
 			fmt.Println("Invalid proxy subcommand.")
-			fmt.Println("Usage: litmus proxy [deploy --upstreamURL <upstreamURL> | list | destroy <service_name> | destroy-all]")
-			return
+			fmt.Println("Usage: litmus proxy [deploy [--upstream-url <upstreamURL>] [--name <service_name>] | update <service_name> | url <service_name> | test <service_name> | list | destroy <service_name> | destroy-all]")
+			os.Exit(utils.ExitUserError)
 		}
 
 		subcommand := args[0]
 		switch subcommand {
 		case "deploy":
-			var upstreamURL string
-			if len(args) >= 3 && args[1] == "--upstreamURL" {
-				upstreamURL = args[2]
+			err := cmd.DeployProxy(projectID, region, upstreamURL, serviceName, quiet)
+			if err != nil {
+				utils.HandleGcloudError(err)
+			}
+		case "update":
+			if len(args) < 2 || strings.HasPrefix(args[1], "-") {
+				fmt.Println("Usage: litmus proxy update <service_name> [--image-tag <tag>] [--upstream-url <upstreamURL>] [KEY=VALUE ...]")
+				os.Exit(utils.ExitUserError)
 			}
-			err := cmd.DeployProxy(projectID, region, upstreamURL, quiet)
+			err := cmd.UpdateProxy(projectID, region, args[1], imageTag, upstreamURL, envVars, quiet)
 			if err != nil {
 				utils.HandleGcloudError(err)
 			}
+		case "url":
+			if len(args) < 2 || strings.HasPrefix(args[1], "-") {
+				fmt.Println("Usage: litmus proxy url <service_name> [--region <region>]")
+				os.Exit(utils.ExitUserError)
+			}
+			proxyURL, err := cmd.GetProxyURL(projectID, region, args[1])
+			if err != nil {
+				utils.HandleGcloudError(err)
+			}
+			fmt.Println(proxyURL)
+		case "test":
+			if len(args) < 2 || strings.HasPrefix(args[1], "-") {
+				fmt.Println("Usage: litmus proxy test <service_name> [--context <context>] [--file <payload.json>] [--region <region>]")
+				os.Exit(utils.ExitUserError)
+			}
+			if err := cmd.SendProxyTestRequest(projectID, region, args[1], litmusContext, filePath); err != nil {
+				utils.HandleGcloudError(err)
+			}
 		case "list":
 			_, err := cmd.ListProxyServices(projectID, quiet)
 			if err != nil {
@@ -264,10 +941,12 @@ func main() {
 			}
 		default:
 			fmt.Println("Invalid proxy subcommand:", subcommand)
-			fmt.Println("Usage: litmus proxy [deploy --upstreamURL <upstreamURL> | list | destroy <service_name> | destroy-all]")
+			fmt.Println("Usage: litmus proxy [deploy [--upstream-url <upstreamURL>] [--name <service_name>] | update <service_name> | url <service_name> | test <service_name> | list | destroy <service_name> | destroy-all]")
+			os.Exit(utils.ExitUserError)
 		}
 	default:
 		fmt.Println("Invalid command:", command)
 		utils.PrintUsage()
+		os.Exit(utils.ExitUserError)
 	}
-}
\ No newline at end of file
+}
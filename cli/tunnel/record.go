@@ -0,0 +1,173 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tunnel
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/litmus/cli/logger"
+)
+
+// recordedExchange is a request/response pair written by the recorder.
+type recordedExchange struct {
+	Timestamp       time.Time   `json:"timestamp"`
+	Method          string      `json:"method"`
+	Path            string      `json:"path"`
+	Query           string      `json:"query,omitempty"`
+	RequestHeaders  http.Header `json:"requestHeaders"`
+	RequestBody     interface{} `json:"requestBody,omitempty"`
+	ResponseStatus  int         `json:"responseStatus"`
+	ResponseHeaders http.Header `json:"responseHeaders"`
+	ResponseBody    interface{} `json:"responseBody,omitempty"`
+	Latency         int64       `json:"latency"` // Milliseconds
+}
+
+// recorder writes every request/response pair passing through the tunnel to
+// a JSON file in dir. Credentials are never recorded.
+type recorder struct {
+	dir  string
+	next http.Handler
+	seq  atomic.Int64
+}
+
+// newRecorder creates dir if needed and returns a recorder in front of next.
+func newRecorder(dir string, next http.Handler) (*recorder, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create record directory: %w", err)
+	}
+	return &recorder{dir: dir, next: next}, nil
+}
+
+// ServeHTTP forwards the request and records it once the response is complete.
+// WebSocket upgrades are passed through unrecorded.
+func (h *recorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+
+	start := time.Now()
+	var requestBody []byte
+	if r.Body != nil {
+		var err error
+		requestBody, err = io.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			http.Error(w, "Failed to read request body", http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(requestBody))
+	}
+
+	capture := &bodyRecorder{ResponseWriter: w, status: http.StatusOK}
+	h.next.ServeHTTP(capture, r)
+
+	responseBody := capture.buf.Bytes()
+	if capture.Header().Get("Content-Encoding") == "gzip" {
+		if decompressed, err := gunzip(responseBody); err == nil {
+			responseBody = decompressed
+		}
+	}
+
+	exchange := recordedExchange{
+		Timestamp:       start.UTC(),
+		Method:          r.Method,
+		Path:            r.URL.Path,
+		Query:           r.URL.RawQuery,
+		RequestHeaders:  withoutCredentials(r.Header),
+		RequestBody:     recordedBody(requestBody),
+		ResponseStatus:  capture.status,
+		ResponseHeaders: withoutCredentials(capture.Header()),
+		ResponseBody:    recordedBody(responseBody),
+		Latency:         time.Since(start).Milliseconds(),
+	}
+	if err := h.write(exchange); err != nil {
+		logger.Warnf("Failed to record %s %s: %v", r.Method, r.URL.Path, err)
+	}
+}
+
+// write stores exchange as <timestamp>-<sequence>-<method>.json so files sort
+// in the order the requests were made.
+func (h *recorder) write(exchange recordedExchange) error {
+	data, err := json.MarshalIndent(exchange, "", "  ")
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%06d-%s.json", exchange.Timestamp.Format("20060102T150405.000000Z"), h.seq.Add(1), exchange.Method)
+	return os.WriteFile(filepath.Join(h.dir, name), data, 0o644)
+}
+
+// withoutCredentials returns a copy of header without authentication headers.
+func withoutCredentials(header http.Header) http.Header {
+	sanitized := header.Clone()
+	sanitized.Del("Authorization")
+	sanitized.Del("Proxy-Authorization")
+	return sanitized
+}
+
+// recordedBody returns body as JSON when it is valid JSON and as a string
+// otherwise, so recordings stay readable.
+func recordedBody(body []byte) interface{} {
+	if len(body) == 0 {
+		return nil
+	}
+	if json.Valid(body) {
+		return json.RawMessage(body)
+	}
+	return string(body)
+}
+
+// gunzip decompresses a gzip-encoded body.
+func gunzip(body []byte) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+// bodyRecorder captures the response status and body while writing them
+// through to the client.
+type bodyRecorder struct {
+	http.ResponseWriter
+	status int
+	buf    bytes.Buffer
+}
+
+func (rec *bodyRecorder) Write(b []byte) (int, error) {
+	rec.buf.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+func (rec *bodyRecorder) WriteHeader(code int) {
+	rec.status = code
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rec *bodyRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
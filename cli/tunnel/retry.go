@@ -0,0 +1,78 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tunnel
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/google/litmus/cli/logger"
+)
+
+// retryBackoff is the delay before the first retry, doubled for each
+// following one.
+const retryBackoff = 500 * time.Millisecond
+
+// retryTransport retries idempotent requests when Cloud Run answers with
+// 502/503 or the connection fails, which typically happens while a cold
+// instance is starting.
+type retryTransport struct {
+	next    http.RoundTripper
+	retries int
+}
+
+// RoundTrip sends req and retries it up to t.retries times with exponential
+// backoff. The last response or error is returned to the caller.
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	backoff := retryBackoff
+	for attempt := 0; ; attempt++ {
+		resp, err := t.next.RoundTrip(req)
+		if attempt >= t.retries || !isRetryable(req, resp, err) {
+			return resp, err
+		}
+
+		if err != nil {
+			logger.Infof("Upstream not reachable for %s %s, retrying (%d/%d): %v", req.Method, req.URL.Path, attempt+1, t.retries, err)
+		} else {
+			logger.Infof("Upstream starting up (%d) for %s %s, retrying (%d/%d)", resp.StatusCode, req.Method, req.URL.Path, attempt+1, t.retries)
+			resp.Body.Close()
+		}
+
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// isRetryable reports whether req can safely be sent again after resp/err.
+// Only idempotent requests without a body are retried, since the body has
+// already been consumed.
+func isRetryable(req *http.Request, resp *http.Response, err error) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+	default:
+		return false
+	}
+	if req.Body != nil && req.Body != http.NoBody {
+		return false
+	}
+	if err != nil {
+		return req.Context().Err() == nil
+	}
+	return resp.StatusCode == http.StatusBadGateway || resp.StatusCode == http.StatusServiceUnavailable
+}
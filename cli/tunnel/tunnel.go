@@ -1,86 +1,274 @@
 package tunnel
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/google/litmus/cli/logger"
 	"github.com/google/litmus/cli/utils"
-	"golang.org/x/net/context"
 )
 
-// CreateTunnel creates a tunnel to the Litmus service URL.
-func CreateTunnel(cloudRunEndpoint string, localPort int, quiet bool, projectID string) error {
+// Options configures a tunnel.
+type Options struct {
+	ServiceURL string // URL to tunnel to, the deployed Litmus service if empty
+	LocalPort  int    // Local port to listen on, 0 picks a free port
+	Retries    int    // Retries for idempotent requests on 502/503 responses
+	Verbose    bool   // Log each request and its response status
+	Open       bool   // Open the tunnel URL in the default browser
+	Quiet      bool   // Suppress informational output
+	RecordDir  string // Directory to record request/response pairs to, disabled if empty
+
+	// Basic auth credentials. When Password is empty, they are read from
+	// CredentialsFile, or else from Secret Manager.
+	Username        string
+	Password        string
+	CredentialsFile string
+
+	// PassthroughAuth forwards requests with their Authorization header
+	// unchanged instead of checking the basic auth credentials, for apps
+	// that authenticate users themselves.
+	PassthroughAuth bool
+}
+
+// CreateTunnel creates a tunnel to the Litmus service URL and serves it until
+// ctx is cancelled, then shuts the server down gracefully. A ctx that can't be
+// cancelled, such as context.Background(), is cancelled on SIGINT or SIGTERM.
+func CreateTunnel(ctx context.Context, projectID string, opts Options) error {
+	cloudRunEndpoint := opts.ServiceURL
+	if cloudRunEndpoint == "" {
+		serviceURL, err := resolveServiceURL(projectID)
+		if err != nil {
+			return err
+		}
+		cloudRunEndpoint = serviceURL
+	}
 
 	endpointURL, err := url.Parse(cloudRunEndpoint)
 	if err != nil {
 		return fmt.Errorf("invalid endpoint URL: %w", err)
 	}
-
-	if cloudRunEndpoint == "" { 
-		return fmt.Errorf("service URL is empty")
+	if endpointURL.Scheme == "" || endpointURL.Host == "" {
+		return fmt.Errorf("invalid endpoint URL '%s': expected an absolute URL such as https://litmus-api-abcd-uc.a.run.app", cloudRunEndpoint)
 	}
 
-	proxy := httputil.NewSingleHostReverseProxy(endpointURL)
-	proxy.Director = func(req *http.Request) {
-		req.URL.Scheme = endpointURL.Scheme
-		req.URL.Host = endpointURL.Host
-		req.Host = endpointURL.Host
-		req.Header.Set("X-Forwarded-For", req.RemoteAddr)
+	var username, password string
+	if opts.PassthroughAuth {
+		if opts.Username != "" || opts.Password != "" || opts.CredentialsFile != "" {
+			return fmt.Errorf("--passthrough-auth can't be combined with --username, --password or --credentials-file")
+		}
+	} else {
+		username, password, err = credentials(projectID, opts)
+		if err != nil {
+			return err
+		}
 	}
 
-	username, password, err := utils.GetAuthCredentials(projectID)
+	handler, err := newHandler(endpointURL, username, password, opts)
 	if err != nil {
-		return fmt.Errorf("error getting auth credentials: %w", err)
+		return err
 	}
 
-	authProxy := &authMiddleware{
-		username: username,
-		password: password,
-		next:     proxy,
+	listener, err := listen(opts.LocalPort)
+	if err != nil {
+		return err
 	}
+	localPort := listener.Addr().(*net.TCPAddr).Port
 
 	server := &http.Server{
-		Addr:    fmt.Sprintf(":%d", localPort),
-		Handler: authProxy,
+		Handler: handler,
+	}
+
+	if ctx.Done() == nil {
+		var stop context.CancelFunc
+		ctx, stop = signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer stop()
 	}
 
 	idleConnsClosed := make(chan struct{})
 	go func() {
-		sigint := make(chan os.Signal, 1)
-		signal.Notify(sigint, os.Interrupt, syscall.SIGTERM)
-		<-sigint
+		<-ctx.Done()
 
-		log.Println("Shutting down server...")
+		logger.Infof("Shutting down server...")
 
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
-		if err := server.Shutdown(ctx); err != nil {
-			log.Printf("HTTP server Shutdown: %v", err)
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			logger.Errorf("HTTP server Shutdown: %v", err)
 		}
 		close(idleConnsClosed)
 	}()
 
-	fmt.Printf("Tunnel created: Access Litmus at http://localhost:%d\n", localPort)
+	localURL := fmt.Sprintf("http://localhost:%d", localPort)
+	fmt.Printf("Tunnel created: Access Litmus at %s\n", localURL)
+
+	// The listener is already bound, so the browser's request is queued
+	// until Serve accepts it. No credentials are embedded in the URL since
+	// the browser prompts for them.
+	if opts.Open {
+		if err := utils.OpenBrowser(localURL); err != nil {
+			logger.Warnf("%v", err)
+		}
+	}
 
-	if err := server.ListenAndServe(); err != http.ErrServerClosed {
-		return fmt.Errorf("HTTP server ListenAndServe: %w", err)
+	started := time.Now()
+	if err := server.Serve(listener); err != http.ErrServerClosed {
+		return fmt.Errorf("HTTP server Serve: %w", err)
 	}
 
 	<-idleConnsClosed
-	if !quiet {
-		log.Println("Tunnel closed")
+	if !opts.Quiet {
+		reason := "interrupted"
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			reason = "duration elapsed"
+		}
+		logger.Infof("Tunnel closed after %s (%s)", time.Since(started).Round(time.Second), reason)
 	}
 	return nil
 }
 
+// newHandler returns the tunnel's HTTP handler: basic auth in front of a
+// reverse proxy to endpointURL, with request logging when opts.Verbose is set
+// and recording of authenticated requests when opts.RecordDir is set. With
+// opts.PassthroughAuth, username and password are ignored and every request
+// is forwarded for the app to authenticate.
+func newHandler(endpointURL *url.URL, username, password string, opts Options) (http.Handler, error) {
+	var proxy http.Handler = newProxy(endpointURL, opts.Retries)
+	if opts.RecordDir != "" {
+		recorder, err := newRecorder(opts.RecordDir, proxy)
+		if err != nil {
+			return nil, err
+		}
+		proxy = recorder
+	}
+
+	handler := proxy
+	if !opts.PassthroughAuth {
+		handler = &authMiddleware{
+			username: username,
+			password: password,
+			next:     proxy,
+		}
+	}
+	if opts.Verbose {
+		handler = &requestLogger{next: handler}
+	}
+	return handler, nil
+}
+
+// newProxy returns a reverse proxy that forwards requests to endpointURL.
+func newProxy(endpointURL *url.URL, retries int) *httputil.ReverseProxy {
+	proxy := httputil.NewSingleHostReverseProxy(endpointURL)
+	proxy.Director = func(req *http.Request) {
+		req.URL.Scheme = endpointURL.Scheme
+		req.URL.Host = endpointURL.Host
+		req.Host = endpointURL.Host
+		req.Header.Set("X-Forwarded-For", req.RemoteAddr)
+	}
+	proxy.Transport = &retryTransport{next: http.DefaultTransport, retries: retries}
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		logger.Warnf("Upstream error for %s %s: %v", r.Method, r.URL.Path, err)
+		http.Error(w, "Litmus is not reachable right now, it may still be starting up. Please retry in a few seconds.", http.StatusBadGateway)
+	}
+	return proxy
+}
+
+// listen opens the local tunnel port. Port 0 lets the OS pick a free port.
+// When the requested port is taken, the error suggests the next free one.
+func listen(localPort int) (net.Listener, error) {
+	if localPort < 0 || localPort > 65535 {
+		return nil, fmt.Errorf("invalid port %d: must be between 0 and 65535", localPort)
+	}
+
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", localPort))
+	if err == nil {
+		return listener, nil
+	}
+	if !errors.Is(err, syscall.EADDRINUSE) {
+		return nil, fmt.Errorf("error listening on port %d: %w", localPort, err)
+	}
+
+	for candidate := localPort + 1; candidate <= 65535 && candidate <= localPort+100; candidate++ {
+		probe, err := net.Listen("tcp", fmt.Sprintf(":%d", candidate))
+		if err != nil {
+			continue
+		}
+		probe.Close()
+		return nil, fmt.Errorf("port %d is already in use. Try --port %d, or --port 0 to pick a free port", localPort, candidate)
+	}
+	return nil, fmt.Errorf("port %d is already in use. Use --port 0 to pick a free port", localPort)
+}
+
+// credentials returns the basic auth credentials for the tunnel, preferring
+// the ones given in opts so that Secret Manager access is only needed as a
+// fallback.
+func credentials(projectID string, opts Options) (string, string, error) {
+	if opts.Password != "" {
+		username := opts.Username
+		if username == "" {
+			username = "admin"
+		}
+		return username, opts.Password, nil
+	}
+	if opts.Username != "" {
+		return "", "", fmt.Errorf("--username requires --password")
+	}
+
+	if opts.CredentialsFile != "" {
+		return readCredentialsFile(opts.CredentialsFile)
+	}
+
+	username, password, err := utils.GetAuthCredentials(projectID)
+	if err != nil {
+		return "", "", fmt.Errorf("error getting auth credentials: %w. Pass --username/--password or --credentials-file if you cannot access Secret Manager", err)
+	}
+	return username, password, nil
+}
+
+// readCredentialsFile reads "username:password" from the first line of path.
+// A line without a colon is the password of the "admin" user.
+func readCredentialsFile(path string) (string, string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read credentials file: %w", err)
+	}
+
+	line, _, _ := strings.Cut(string(data), "\n")
+	line = strings.TrimSpace(line)
+	username, password, ok := strings.Cut(line, ":")
+	if !ok {
+		username, password = "admin", line
+	}
+	if username == "" || password == "" {
+		return "", "", fmt.Errorf("invalid credentials file '%s': expected username:password on the first line", path)
+	}
+	return username, password, nil
+}
+
+// resolveServiceURL returns the Litmus service URL stored in Secret Manager
+// by `litmus deploy`.
+func resolveServiceURL(projectID string) (string, error) {
+	serviceURL, err := utils.AccessServiceURL(projectID)
+	if err != nil {
+		logger.Debugf("Error retrieving service URL: %v", err)
+		return "", fmt.Errorf("Litmus is not deployed in project '%s'. Run 'litmus deploy --project %s' before tunneling, or pass --url", projectID, projectID)
+	}
+	if serviceURL == "" {
+		return "", fmt.Errorf("the Litmus service URL in project '%s' is empty. Run 'litmus deploy --project %s' to redeploy", projectID, projectID)
+	}
+	return serviceURL, nil
+}
+
 // authMiddleware handles basic authentication for the tunnel.
 type authMiddleware struct {
 	username string
@@ -99,4 +287,35 @@ func (h *authMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	h.next.ServeHTTP(w, r)
-}
\ No newline at end of file
+}
+
+// requestLogger logs the method, path, status and duration of each request.
+// The Authorization header is never logged.
+type requestLogger struct {
+	next http.Handler
+}
+
+// ServeHTTP forwards the request and logs it once the response is written.
+func (h *requestLogger) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	h.next.ServeHTTP(recorder, r)
+	logger.Infof("%s %s %d (%s)", r.Method, r.URL.Path, recorder.status, time.Since(start).Round(time.Millisecond))
+}
+
+// statusRecorder captures the response status code.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(code int) {
+	rec.status = code
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to
+// flush streamed responses.
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
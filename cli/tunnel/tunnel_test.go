@@ -0,0 +1,219 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tunnel
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuthMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		setAuth    bool
+		username   string
+		password   string
+		wantStatus int
+		wantNext   bool
+	}{
+		{name: "missing credentials", wantStatus: http.StatusUnauthorized},
+		{name: "wrong username", setAuth: true, username: "root", password: "secret", wantStatus: http.StatusUnauthorized},
+		{name: "wrong password", setAuth: true, username: "admin", password: "guess", wantStatus: http.StatusUnauthorized},
+		{name: "correct credentials", setAuth: true, username: "admin", password: "secret", wantStatus: http.StatusOK, wantNext: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			middleware := &authMiddleware{
+				username: "admin",
+				password: "secret",
+				next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					called = true
+					w.WriteHeader(http.StatusOK)
+				}),
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/runs/", nil)
+			if tt.setAuth {
+				req.SetBasicAuth(tt.username, tt.password)
+			}
+			rec := httptest.NewRecorder()
+			middleware.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if called != tt.wantNext {
+				t.Errorf("next handler called = %v, want %v", called, tt.wantNext)
+			}
+			if tt.wantStatus == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("missing WWW-Authenticate header on 401")
+			}
+		})
+	}
+}
+
+func TestProxyDirector(t *testing.T) {
+	endpointURL, err := url.Parse("https://litmus-api-abcd-uc.a.run.app")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://localhost:8081/runs/?page=2", nil)
+	newProxy(endpointURL, 0).Director(req)
+
+	if req.URL.Scheme != "https" {
+		t.Errorf("URL.Scheme = %q, want %q", req.URL.Scheme, "https")
+	}
+	if req.URL.Host != endpointURL.Host {
+		t.Errorf("URL.Host = %q, want %q", req.URL.Host, endpointURL.Host)
+	}
+	if req.Host != endpointURL.Host {
+		t.Errorf("Host = %q, want %q", req.Host, endpointURL.Host)
+	}
+	if req.URL.Path != "/runs/" || req.URL.RawQuery != "page=2" {
+		t.Errorf("URL = %q, want path and query preserved", req.URL.String())
+	}
+}
+
+func TestHandlerForwardsAuthenticatedRequests(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Method+" "+r.URL.Path)
+	}))
+	defer upstream.Close()
+
+	endpointURL, err := url.Parse(upstream.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler, err := newHandler(endpointURL, "admin", "secret", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/templates/", nil)
+	req.SetBasicAuth("admin", "secret")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if got := rec.Body.String(); got != "GET /templates/" {
+		t.Errorf("body = %q, want %q", got, "GET /templates/")
+	}
+
+	unauthenticated := httptest.NewRecorder()
+	handler.ServeHTTP(unauthenticated, httptest.NewRequest(http.MethodGet, "/templates/", nil))
+	if unauthenticated.Code != http.StatusUnauthorized {
+		t.Errorf("unauthenticated status = %d, want %d", unauthenticated.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestHandlerPassthroughAuth(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Header.Get("Authorization"))
+	}))
+	defer upstream.Close()
+
+	endpointURL, err := url.Parse(upstream.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler, err := newHandler(endpointURL, "", "", Options{PassthroughAuth: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, authorization := range []string{"", "Bearer user-token", "Basic dXNlcjpwYXNz"} {
+		req := httptest.NewRequest(http.MethodGet, "/templates/", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Errorf("Authorization %q: status = %d, want %d", authorization, rec.Code, http.StatusOK)
+		}
+		if got := rec.Body.String(); got != authorization {
+			t.Errorf("upstream got Authorization %q, want %q", got, authorization)
+		}
+	}
+}
+
+func TestCreateTunnelStopsOnCancel(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- CreateTunnel(ctx, "", Options{ServiceURL: upstream.URL, Password: "secret", Quiet: true})
+	}()
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("CreateTunnel() = %v, want nil", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("CreateTunnel did not return after the context was cancelled")
+	}
+}
+
+func TestRecorderOmitsCredentials(t *testing.T) {
+	dir := t.TempDir()
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"ok":true}`)
+	})
+	recorder, err := newRecorder(dir, next)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/submit_run/", strings.NewReader(`{"run_id":"r1"}`))
+	req.SetBasicAuth("admin", "secret")
+	recorder.ServeHTTP(httptest.NewRecorder(), req)
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("recorded %d files, want 1", len(files))
+	}
+	data, err := os.ReadFile(filepath.Join(dir, files[0].Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "Authorization") || strings.Contains(string(data), "Basic ") {
+		t.Errorf("recording contains credentials: %s", data)
+	}
+	if !strings.Contains(string(data), `"run_id": "r1"`) || !strings.Contains(string(data), `"ok": true`) {
+		t.Errorf("recording is missing the request or response body: %s", data)
+	}
+}
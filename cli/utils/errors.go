@@ -0,0 +1,136 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Exit codes of the Litmus CLI. They are part of the CLI's interface so that
+// CI pipelines can retry transient failures and fail fast on everything else.
+const (
+	ExitOK          = 0
+	ExitUserError   = 1 // Invalid usage, input or configuration
+	ExitAuthError   = 2 // gcloud missing, not authenticated or permission denied
+	ExitTransient   = 3 // Network, timeout or server-side failure, safe to retry
+	ExitCheckFailed = 4 // A gate failed: run evaluation failed (start --wait), update available (update --check, self-update --check) or unhealthy (status --health)
+)
+
+// ExitError attaches an exit code to an error.
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitError) Error() string { return e.Err.Error() }
+
+func (e *ExitError) Unwrap() error { return e.Err }
+
+// AuthError marks err as an authentication or authorization failure.
+func AuthError(err error) error {
+	return &ExitError{Code: ExitAuthError, Err: err}
+}
+
+// TransientError marks err as a retryable failure.
+func TransientError(err error) error {
+	return &ExitError{Code: ExitTransient, Err: err}
+}
+
+// CheckFailedError marks err as a failed gate, e.g. a failed evaluation.
+func CheckFailedError(err error) error {
+	return &ExitError{Code: ExitCheckFailed, Err: err}
+}
+
+// HTTPStatusError classifies an unexpected HTTP status from the Litmus API:
+// 401/403 are auth errors, 429 and 5xx are transient, anything else is a
+// user error.
+func HTTPStatusError(statusCode int, err error) error {
+	switch {
+	case statusCode == 401 || statusCode == 403:
+		return AuthError(err)
+	case statusCode == 429 || statusCode >= 500:
+		return TransientError(err)
+	default:
+		return err
+	}
+}
+
+// ExitCode returns the exit code for err. Errors that were not explicitly
+// classified are recognized from network timeouts, gRPC status codes and a
+// few unambiguous gcloud and network messages, and default to ExitUserError,
+// so CI only retries failures that are known to be transient.
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Code
+	}
+
+	// Other network errors, such as an unknown host, fall through to the
+	// message markers below
+	var netErr net.Error
+	if errors.As(err, &netErr) && (netErr.Timeout() || netErr.Temporary()) {
+		return ExitTransient
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ExitTransient
+	}
+
+	// Errors of the Google Cloud client libraries carry a gRPC status
+	switch code := status.Code(err); {
+	case code == codes.PermissionDenied || code == codes.Unauthenticated:
+		return ExitAuthError
+	case slices.Contains(transientSecretCodes, code):
+		return ExitTransient
+	}
+
+	message := strings.ToLower(err.Error())
+	for _, marker := range []string{
+		"executable file not found",
+		"credential file cannot be found",
+		"could not find default credentials",
+		"reauthentication",
+		"gcloud auth login",
+		"permissiondenied",
+		"permission denied",
+		"unauthenticated",
+	} {
+		if strings.Contains(message, marker) {
+			return ExitAuthError
+		}
+	}
+	// Only markers that can't appear in a usage or configuration error, e.g.
+	// a message echoing an invalid --timeout value
+	for _, marker := range []string{
+		"connection refused",
+		"connection reset",
+		"deadline exceeded",
+	} {
+		if strings.Contains(message, marker) {
+			return ExitTransient
+		}
+	}
+	return ExitUserError
+}
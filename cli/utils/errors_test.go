@@ -0,0 +1,83 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// timeoutError is a net.Error that timed out.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return false }
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "nil", err: nil, want: ExitOK},
+		{name: "classified", err: AuthError(errors.New("denied")), want: ExitAuthError},
+		{name: "wrapped classified", err: fmt.Errorf("deploy: %w", TransientError(errors.New("blip"))), want: ExitTransient},
+		{name: "plain", err: errors.New("invalid region"), want: ExitUserError},
+		{name: "deadline", err: fmt.Errorf("waiting: %w", context.DeadlineExceeded), want: ExitTransient},
+		{
+			name: "url timeout",
+			err:  &url.Error{Op: "Get", URL: "https://example.com", Err: timeoutError{}},
+			want: ExitTransient,
+		},
+		{
+			name: "url unknown host",
+			err:  &url.Error{Op: "Get", URL: "https://nope.invalid", Err: &net.DNSError{Err: "no such host", Name: "nope.invalid", IsNotFound: true}},
+			want: ExitUserError,
+		},
+		{
+			name: "url bad scheme",
+			err:  &url.Error{Op: "Get", URL: "ftp://example.com", Err: errors.New(`unsupported protocol scheme "ftp"`)},
+			want: ExitUserError,
+		},
+		{
+			name: "url connection refused",
+			err:  &url.Error{Op: "Post", URL: "http://127.0.0.1:1", Err: errors.New("dial tcp 127.0.0.1:1: connect: connection refused")},
+			want: ExitTransient,
+		},
+		{name: "grpc unavailable", err: fmt.Errorf("access secret: %w", status.Error(codes.Unavailable, "try again")), want: ExitTransient},
+		{name: "grpc permission denied", err: status.Error(codes.PermissionDenied, "caller lacks access"), want: ExitAuthError},
+		{name: "grpc invalid argument", err: status.Error(codes.InvalidArgument, "bad timeout"), want: ExitUserError},
+		{name: "invalid timeout flag", err: errors.New(`invalid --timeout value "abc"`), want: ExitUserError},
+		{name: "timeout out of range", err: errors.New("timeout must be between 1 and 3600 seconds"), want: ExitUserError},
+		{name: "region unavailable", err: errors.New("model gemini-pro is unavailable in region mars-1"), want: ExitUserError},
+		{name: "gcloud missing", err: errors.New(`exec: "gcloud": executable file not found in $PATH`), want: ExitAuthError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExitCode(tt.err); got != tt.want {
+				t.Errorf("ExitCode(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
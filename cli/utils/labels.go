@@ -0,0 +1,82 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ManagedLabel is set to "true" on every resource Litmus deploys, so they
+// can be discovered by label.
+const ManagedLabel = "litmus-managed"
+
+// ComponentLabel names the Litmus component of a resource, e.g. "proxy".
+const ComponentLabel = "litmus-component"
+
+// FirestoreLabel records on the API service whether deploy manages the
+// Firestore database ("managed") or it was deployed with --skip-firestore
+// ("external"), so destroy only deletes databases Litmus created.
+const FirestoreLabel = "litmus-firestore"
+
+// maxLabels is the number of labels a Google Cloud resource can have.
+const maxLabels = 64
+
+var (
+	labelKeyRegex   = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,62}$`)
+	labelValueRegex = regexp.MustCompile(`^[a-z0-9_-]{0,63}$`)
+)
+
+// ParseLabels parses a --label value of the form KEY=VALUE[,KEY=VALUE...]
+// into labels, checking keys and values against the Google Cloud label
+// constraints.
+func ParseLabels(spec string, labels map[string]string) error {
+	for _, pair := range strings.Split(spec, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return fmt.Errorf("invalid label '%s': expected KEY=VALUE", pair)
+		}
+		if !labelKeyRegex.MatchString(key) {
+			return fmt.Errorf("invalid label key '%s': must start with a lowercase letter and contain at most 63 lowercase letters, digits, '_' and '-'", key)
+		}
+		if !labelValueRegex.MatchString(value) {
+			return fmt.Errorf("invalid value '%s' for label '%s': must contain at most 63 lowercase letters, digits, '_' and '-'", value, key)
+		}
+		if key == ManagedLabel || key == ComponentLabel || key == FirestoreLabel {
+			return fmt.Errorf("label '%s' is set by Litmus and can't be overridden", key)
+		}
+		labels[key] = value
+	}
+	if len(labels)+2 > maxLabels {
+		return fmt.Errorf("too many labels: resources can have at most %d, including %s and %s", maxLabels, ManagedLabel, ComponentLabel)
+	}
+	return nil
+}
+
+// ResourceLabels returns labels and the labels Litmus sets on the resources
+// of component, as KEY=VALUE pairs sorted by key.
+func ResourceLabels(labels map[string]string, component string) []string {
+	pairs := []string{ManagedLabel + "=true"}
+	if component != "" {
+		pairs = append(pairs, ComponentLabel+"="+component)
+	}
+	for key, value := range labels {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return pairs
+}
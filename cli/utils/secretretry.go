@@ -0,0 +1,89 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/litmus/cli/logger"
+	"github.com/googleapis/gax-go/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// secretRetries is how often a Secret Manager call is retried on a transient
+// error, waiting secretRetryBackoff before the first retry and doubling it
+// for each further one.
+const (
+	secretRetries      = 4
+	secretRetryBackoff = 500 * time.Millisecond
+)
+
+// transientSecretCodes are the gRPC codes of Secret Manager errors that are
+// worth retrying.
+var transientSecretCodes = []codes.Code{
+	codes.Unavailable,
+	codes.ResourceExhausted,
+	codes.Aborted,
+	codes.DeadlineExceeded,
+}
+
+// secretRetry retries a Secret Manager call on transient errors, so a brief
+// API blip doesn't abort a deploy halfway through. The retries also end when
+// the command's deadline passes.
+func secretRetry() gax.CallOption {
+	return gax.WithRetry(func() gax.Retryer {
+		return &limitedRetryer{
+			next: gax.OnCodes(transientSecretCodes, gax.Backoff{
+				Initial:    secretRetryBackoff,
+				Max:        8 * time.Second,
+				Multiplier: 2,
+			}),
+		}
+	})
+}
+
+// limitedRetryer stops retrying after secretRetries attempts.
+type limitedRetryer struct {
+	next    gax.Retryer
+	attempt int
+}
+
+// Retry implements gax.Retryer.
+func (r *limitedRetryer) Retry(err error) (time.Duration, bool) {
+	if r.attempt >= secretRetries {
+		return 0, false
+	}
+	pause, ok := r.next.Retry(err)
+	if ok {
+		r.attempt++
+		logger.Infof("Secret Manager unavailable, retrying (%d/%d): %v", r.attempt, secretRetries, err)
+	}
+	return pause, ok
+}
+
+// secretError wraps a failed Secret Manager call, marking errors that were
+// still transient after the retries as such.
+func secretError(message string, err error) error {
+	wrapped := fmt.Errorf("%s: %v", message, err)
+	code := status.Code(err)
+	for _, transient := range transientSecretCodes {
+		if code == transient {
+			return TransientError(wrapped)
+		}
+	}
+	return wrapped
+}
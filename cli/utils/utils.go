@@ -18,19 +18,30 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"math/rand"
+	"net/url"
 	"os"
 	"os/exec"
 	"regexp"
+	"runtime"
+	"runtime/debug"
 	"strings"
+	"sync"
 	"time"
 
 	secretmanager "cloud.google.com/go/secretmanager/apiv1"
 	secretmanagerpb "cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"github.com/google/litmus/cli/logger"
+	"golang.org/x/term"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+// DefaultRegion is the region commands act on without --region.
+const DefaultRegion = "us-central1"
+
 // GenerateRandomPassword generates a random password of the given length.
 func GenerateRandomPassword(length int) string {
 	rand.Seed(time.Now().UnixNano())
@@ -42,41 +53,99 @@ func GenerateRandomPassword(length int) string {
 	return string(password)
 }
 
-// AccessSecret retrieves a secret from Secret Manager.
+// secrets caches Secret Manager lookups and shares one client for the
+// duration of a command invocation. Nothing is persisted to disk.
+var secrets struct {
+	sync.Mutex
+	client *secretmanager.Client
+	values map[string]string // Keyed by "<project>/<secret>"
+}
+
+// secretClient returns the shared Secret Manager client, creating it on first use.
+// The caller must hold secrets.Mutex.
+func secretClient(ctx context.Context) (*secretmanager.Client, error) {
+	if secrets.client == nil {
+		client, err := secretmanager.NewClient(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create secretmanager client: %v", err)
+		}
+		secrets.client = client
+		secrets.values = make(map[string]string)
+	}
+	return secrets.client, nil
+}
+
+// CloseSecrets closes the shared Secret Manager client and drops all cached
+// secret values. It is called once the command has finished.
+func CloseSecrets() {
+	secrets.Lock()
+	defer secrets.Unlock()
+	if secrets.client != nil {
+		secrets.client.Close()
+		secrets.client = nil
+	}
+	secrets.values = nil
+}
+
+// AccessSecret retrieves a secret from Secret Manager. The value is cached
+// until CloseSecrets, so repeated lookups within a command are free.
 func AccessSecret(projectID, secretID string) (string, error) {
-	ctx := context.Background()
-	client, err := secretmanager.NewClient(ctx)
+	secrets.Lock()
+	defer secrets.Unlock()
+
+	key := projectID + "/" + secretID
+	if value, ok := secrets.values[key]; ok {
+		return value, nil
+	}
+
+	ctx := commandCtx
+	client, err := secretClient(ctx)
 	if err != nil {
-		return "", fmt.Errorf("failed to create secretmanager client: %v", err)
+		return "", err
 	}
-	defer client.Close()
 
 	name := fmt.Sprintf("projects/%s/secrets/%s/versions/latest", projectID, secretID)
 
 	req := &secretmanagerpb.AccessSecretVersionRequest{
 		Name: name,
 	}
-	result, err := client.AccessSecretVersion(ctx, req)
+	result, err := client.AccessSecretVersion(ctx, req, secretRetry())
 	if err != nil {
-		return "", fmt.Errorf("failed to access secret: %v", err)
+		return "", secretError("failed to access secret", err)
 	}
 
-	return string(result.Payload.Data), nil
+	value := string(result.Payload.Data)
+	secrets.values[key] = value
+	return value, nil
+}
+
+// AccessServiceURL returns the Litmus service URL stored by deploy.
+func AccessServiceURL(projectID string) (string, error) {
+	serviceURL, err := AccessSecret(projectID, ResourceName("litmus-service-url"))
+	if err != nil {
+		return "", err
+	}
+	// Deployments made before ExtractServiceURL stripped ANSI escape
+	// sequences may have stored them in the secret, until it's rewritten by
+	// the next deploy.
+	return strings.TrimSpace(RemoveAnsiEscapeSequences(serviceURL)), nil
 }
 
 // CreateOrUpdateSecret creates or updates a secret in Secret Manager.
 func CreateOrUpdateSecret(projectID, secretID, secretValue string, quiet bool) error {
-	ctx := context.Background()
-	client, err := secretmanager.NewClient(ctx)
+	secrets.Lock()
+	defer secrets.Unlock()
+
+	ctx := commandCtx
+	client, err := secretClient(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to create secretmanager client: %v", err)
+		return err
 	}
-	defer client.Close()
 
 	secretName := fmt.Sprintf("projects/%s/secrets/%s", projectID, secretID)
 	_, err = client.GetSecret(ctx, &secretmanagerpb.GetSecretRequest{
 		Name: secretName,
-	})
+	}, secretRetry())
 
 	if err != nil {
 		if strings.Contains(err.Error(), "not found") {
@@ -94,12 +163,13 @@ func CreateOrUpdateSecret(projectID, secretID, secretValue string, quiet bool) e
 					},
 				},
 			}
-			_, err = client.CreateSecret(ctx, createSecretReq)
-			if err != nil {
-				return fmt.Errorf("failed to create secret: %v", err)
+			// A retried create may find the secret created by the first attempt
+			_, err = client.CreateSecret(ctx, createSecretReq, secretRetry())
+			if err != nil && status.Code(err) != codes.AlreadyExists {
+				return secretError("failed to create secret", err)
 			}
 		} else {
-			return fmt.Errorf("failed to get secret: %v", err)
+			return secretError("failed to get secret", err)
 		}
 	}
 
@@ -109,44 +179,114 @@ func CreateOrUpdateSecret(projectID, secretID, secretValue string, quiet bool) e
 			Data: []byte(secretValue),
 		},
 	}
-	_, err = client.AddSecretVersion(ctx, addSecretVersionReq)
+	_, err = client.AddSecretVersion(ctx, addSecretVersionReq, secretRetry())
+	if err != nil {
+		return secretError("failed to add secret version", err)
+	}
+
+	secrets.values[projectID+"/"+secretID] = secretValue
+	return nil
+}
+
+// ReadEnvFile reads a dotenv-style file and returns its KEY=VALUE pairs.
+// Blank lines and lines starting with '#' are ignored, an optional "export "
+// prefix is allowed, and values may be wrapped in single or double quotes.
+func ReadEnvFile(path string) (map[string]string, error) {
+	file, err := os.Open(path)
 	if err != nil {
-		return fmt.Errorf("failed to add secret version: %v", err)
+		return nil, fmt.Errorf("failed to open env file: %w", err)
+	}
+	defer file.Close()
+
+	envVars := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid line %d in env file '%s': expected KEY=VALUE", lineNumber, path)
+		}
+
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		envVars[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read env file: %w", err)
 	}
 
+	return envVars, nil
+}
+
+// OpenBrowser opens the specified URL in the default browser.
+func OpenBrowser(url string) error {
+	var err error
+
+	switch runtime.GOOS {
+	case "linux":
+		err = exec.Command("xdg-open", url).Start()
+	case "windows":
+		err = exec.Command("rundll32", "url.dll,FileProtocolHandler", url).Start()
+	case "darwin":
+		err = exec.Command("open", url).Start()
+	default:
+		err = fmt.Errorf("unsupported platform")
+	}
+	if err != nil {
+		return fmt.Errorf("error opening browser: %w", err)
+	}
 	return nil
 }
 
 // IsAPIEnabled checks if a given API is enabled for the project.
-func IsAPIEnabled(api, projectID string) bool {
-	checkCmd := exec.Command("gcloud", "services", "list", "--project", projectID, "--enabled")
+func IsAPIEnabled(api, projectID string) (bool, error) {
+	checkCmd := Command("gcloud", "services", "list", "--project", projectID, "--enabled")
 	output, err := checkCmd.CombinedOutput()
 	if err != nil {
-		log.Fatalf("Error checking API status: %v\nOutput: %s", err, output)
+		return false, fmt.Errorf("error checking API status: %v\nOutput: %s", err, output)
 	}
-	return strings.Contains(string(output), api)
+	return strings.Contains(string(output), api), nil
 }
 
-// FirestoreDatabaseExists checks if the default Firestore database exists for the project.
-func FirestoreDatabaseExists(projectID string) bool {
-	listFirestoreCmd := exec.Command("gcloud", "firestore", "databases", "list", "--project", projectID)
+// FirestoreDatabaseExists checks if the Firestore database exists for the
+// project, e.g. "(default)".
+func FirestoreDatabaseExists(projectID, database string) (bool, error) {
+	listFirestoreCmd := Command("gcloud", "firestore", "databases", "list", "--project", projectID, "--format=value(name)")
 	output, err := listFirestoreCmd.CombinedOutput()
 	if err != nil {
-		log.Fatalf("\nError listing Firestore databases: %v\nOutput: %s", err, output)
+		return false, fmt.Errorf("error listing Firestore databases: %v\nOutput: %s", err, output)
 	}
 
-	return strings.Contains(string(output), "(default)")
+	for _, name := range strings.Fields(string(output)) {
+		if strings.HasSuffix(name, "/databases/"+database) {
+			return true, nil
+		}
+	}
+	return false, nil
 }
 
+// ansiEscapeRegex matches ANSI CSI escape sequences, such as the colors in
+// gcloud's output.
+var ansiEscapeRegex = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]`)
+
 // RemoveAnsiEscapeSequences removes ANSI escape sequences from a string.
 func RemoveAnsiEscapeSequences(text string) string {
-	re := regexp.MustCompile(`\x1b\[[0-9;]*m`)
-	return re.ReplaceAllString(text, "")
+	return ansiEscapeRegex.ReplaceAllString(text, "")
 }
 
 // ServiceAccountExists checks if a service account already exists.
 func ServiceAccountExists(projectID, serviceAccount string) bool {
-	cmd := exec.Command("gcloud", "iam", "service-accounts", "list",
+	cmd := Command("gcloud", "iam", "service-accounts", "list",
 		"--project", projectID,
 		"--filter", fmt.Sprintf("email=%s", serviceAccount),
 		"--format=value(email)")
@@ -156,7 +296,7 @@ func ServiceAccountExists(projectID, serviceAccount string) bool {
 
 // ServiceExists checks if a Cloud Run service already exists.
 func ServiceExists(projectID, region, serviceName string) bool {
-	cmd := exec.Command("gcloud", "run", "services", "list",
+	cmd := Command("gcloud", "run", "services", "list",
 		"--project", projectID,
 		"--region", region,
 		"--filter", fmt.Sprintf("name=%s", serviceName),
@@ -167,7 +307,7 @@ func ServiceExists(projectID, region, serviceName string) bool {
 
 // JobExists checks if a Cloud Run job already exists.
 func JobExists(projectID, region, jobName string) bool {
-	cmd := exec.Command("gcloud", "run", "jobs", "list",
+	cmd := Command("gcloud", "run", "jobs", "list",
 		"--project", projectID,
 		"--region", region,
 		"--filter", fmt.Sprintf("name=%s", jobName),
@@ -176,18 +316,34 @@ func JobExists(projectID, region, jobName string) bool {
 	return strings.TrimSpace(string(output)) == jobName
 }
 
+// SecretExists checks if a Secret Manager secret already exists.
+func SecretExists(projectID, secretID string) bool {
+	cmd := Command("gcloud", "secrets", "describe", secretID,
+		"--project", projectID,
+		"--format=value(name)")
+	return cmd.Run() == nil
+}
+
+// BucketExists checks if a Cloud Storage bucket already exists.
+func BucketExists(projectID, bucketName string) bool {
+	cmd := Command("gcloud", "storage", "buckets", "describe", fmt.Sprintf("gs://%s", bucketName),
+		"--project", projectID,
+		"--format=value(name)")
+	return cmd.Run() == nil
+}
+
 // BindingExists checks if a specific IAM binding already exists.
 func BindingExists(projectID, region, resourceName, serviceAccount, role string) bool {
 	var cmd *exec.Cmd
 	if resourceName != "" {
 		if region != "" {
-			cmd = exec.Command("gcloud", "run", "jobs", "describe", resourceName,
+			cmd = Command("gcloud", "run", "jobs", "describe", resourceName,
 				"--project", projectID,
 				"--region", region,
 				"--format=json",
 			)
 		} else {
-			cmd = exec.Command("gcloud", "projects", "get-iam-policy", projectID, "--format=json")
+			cmd = Command("gcloud", "projects", "get-iam-policy", projectID, "--format=json")
 		}
 	} else {
 		return false
@@ -195,13 +351,13 @@ func BindingExists(projectID, region, resourceName, serviceAccount, role string)
 
 	output, err := cmd.CombinedOutput()
 	if err != nil {
-		log.Printf("Error checking IAM bindings: %v\nOutput: %s", err, output)
+		logger.Warnf("Error checking IAM bindings: %v\nOutput: %s", err, output)
 		return false
 	}
 
 	var data map[string]interface{}
 	if err := json.Unmarshal(output, &data); err != nil {
-		log.Printf("Error parsing JSON output: %v", err)
+		logger.Warnf("Error parsing JSON output: %v", err)
 		return false
 	}
 
@@ -236,7 +392,8 @@ func BindingExists(projectID, region, resourceName, serviceAccount, role string)
 
 // ExtractServiceURL extracts the service URL from the gcloud command output.
 func ExtractServiceURL(output string) string {
-	lines := strings.Split(output, "\n")
+	// gcloud may color its output, keep the codes out of the stored URL
+	lines := strings.Split(RemoveAnsiEscapeSequences(output), "\n")
 	for _, line := range lines {
 		if strings.Contains(line, "URL:") {
 			parts := strings.Split(line, ": ")
@@ -250,10 +407,10 @@ func ExtractServiceURL(output string) string {
 
 // GetDefaultProjectID retrieves the default project ID from gcloud.
 func GetDefaultProjectID() (string, error) {
-	cmd := exec.Command("gcloud", "config", "get-value", "core/project")
+	cmd := Command("gcloud", "config", "get-value", "core/project")
 	output, err := cmd.CombinedOutput()
 	if err != nil {
-		return "", err
+		return "", AuthError(err)
 	}
 
 	// Trim any extra output before the project ID
@@ -268,7 +425,25 @@ func GetDefaultProjectID() (string, error) {
 	return projectID, nil
 }
 
-// HandleGcloudError provides user-friendly messages for gcloud errors.
+// GetGcloudAccount retrieves the active gcloud account, or "" if none is set.
+func GetGcloudAccount() (string, error) {
+	cmd := Command("gcloud", "config", "get-value", "account")
+	output, err := cmd.Output()
+	if err != nil {
+		return "", AuthError(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	account := strings.TrimSpace(lines[len(lines)-1]) // Take the last line
+	if account == "(unset)" {
+		account = ""
+	}
+	return account, nil
+}
+
+// HandleGcloudError provides user-friendly messages for gcloud errors and exits
+// with the exit code for err (see ExitCode). It is meant to be called from
+// main only.
 func HandleGcloudError(err error) {
 	if strings.Contains(err.Error(), "executable file not found") ||
 		strings.Contains(err.Error(), "Credential file cannot be found") {
@@ -276,8 +451,10 @@ func HandleGcloudError(err error) {
 		fmt.Println("Run 'gcloud --version' to check if the SDK is installed.")
 		fmt.Println("Run 'gcloud auth login' to authenticate.")
 	} else {
-		log.Fatalf("Error: %v", err)
+		logger.Errorf("%v", err)
 	}
+	CloseSecrets() // os.Exit skips main's deferred call
+	os.Exit(ExitCode(err))
 }
 
 // Updated PrintUsage function
@@ -290,85 +467,413 @@ func PrintUsage() {
 	fmt.Println("  execute     Execute a payload against the Litmus application")
 	fmt.Println("  ls          List Litmus runs")
 	fmt.Println("  open        Open the Litmus dashboard")
-	fmt.Println("  run         Open a specific Litmus run")
+	fmt.Println("  open-proxy  Open a deployed Litmus proxy or print its URL")
+	fmt.Println("  run         Open a specific Litmus run, or show its worker logs with 'run logs <runID>'")
 	fmt.Println("  start       Starts a new Litmus run")
 	fmt.Println("  status      Show the status of the Litmus application")
 	fmt.Println("  update      Update the Litmus application")
 	fmt.Println("  version     Display the Litmus CLI version")
-	fmt.Println("  analytics   Manage Litmus analytics (deploy or destroy)")
-	fmt.Println("  proxy       Manage Litmus proxy (deploy, list, destroy, destroy-all)")
+	fmt.Println("  self-update Update the Litmus CLI to the latest published build")
+	fmt.Println("  whoami      Show the project, region and account commands act on")
+	fmt.Println("  list-all    List every Litmus resource in the project, in all regions and instances")
+	fmt.Println("  secrets     Show the secrets Litmus stores, with the password masked")
+	fmt.Println("  analytics   Manage Litmus analytics (deploy, destroy, backfill or export-schema)")
+	fmt.Println("  export      Export templates and runs to a local archive")
+	fmt.Println("  import      Import templates from an export archive")
+	fmt.Println("  domain      Map a custom domain to the Litmus application")
+	fmt.Println("  templates   Manage Litmus templates (list, get, create, validate)")
+	fmt.Println("  proxy       Manage Litmus proxy (deploy, update, url, test, list, destroy, destroy-all)")
 	fmt.Println("\nOptions:")
 	fmt.Println("  --project <project_id>  Specify the Google Cloud project ID")
 	fmt.Println("  --region <region>      Specify the Google Cloud region (default: us-central1)")
 	fmt.Println("  --quiet                Suppress verbose output")
+	fmt.Println("  --yes, -y              Automatically confirm prompts (keeps normal output)")
+	fmt.Println("  --instance <name>      Suffix resource names to run several instances side by side (alias: --name-suffix)")
+	fmt.Println("  --log-level <level>    Set the log level: debug, info, warn, error (default: info)")
+	fmt.Println("  --log-format <format>  Write logs to stderr as text or json; json also reports each deploy step")
+	fmt.Println("  --progress <format>    Report deploy progress as spinner or json events on stdout (default: spinner)")
 	fmt.Println("  --preserve-data        Preserve data in Cloud Storage, Firestore, and BigQuery")
+	fmt.Println("  --keep-service-accounts Keep the -api and -worker service accounts (destroy only)")
+	fmt.Println("  --output, -o <path>    Archive to write (export only, default: litmus-backup.tar.gz)")
+	fmt.Println("  --input, -i <path>     Archive to read (import only)")
+	fmt.Println("  --on-conflict <mode>   skip or overwrite templates that already exist (import only, default: skip)")
+	fmt.Println("  --only <resources>     Only destroy these resources: service,job,secrets,service-accounts,analytics,bucket,proxies (destroy only)")
+	fmt.Println("  --update-only          Only redeploy the API and worker with the current env vars and images (deploy only)")
+	fmt.Println("  --firestore-database <id> Firestore database for the API and worker (deploy only, default: (default))")
+	fmt.Println("  --skip-firestore       Don't check for or create the Firestore database (deploy only)")
+	fmt.Println("  --check                Check for an available update without deploying or installing (update and self-update)")
+	fmt.Println("  --wait                 Wait for a started run to complete and exit non-zero if it fails (start only)")
+	fmt.Println("  --timeout <duration>   Maximum time to wait with --wait or to deploy, e.g. 30m (default: no limit)")
+	fmt.Println("  --kms-key <key>        Encrypt Cloud Run, the files bucket and BigQuery with a customer-managed key (deploy and analytics deploy)")
+	fmt.Println("  --label <key=value>    Label the service, job, files bucket and analytics dataset, repeatable (deploy and analytics deploy)")
+	fmt.Println("  --log-filter <filter>  Only export log entries also matching this Cloud Logging filter to BigQuery (deploy and analytics deploy)")
+	fmt.Println("  --table-expiration <d> Delete analytics table partitions older than this, e.g. 90d (deploy, analytics deploy and export-schema)")
+	fmt.Println("  --dry-run              Print the dataset, sinks and IAM bindings without deploying (analytics deploy only)")
+	fmt.Println("  --dataset <name>       Dataset to name in the exported schema (analytics export-schema only, default: litmus_analytics)")
+	fmt.Println("  --since <duration>     How far back to import logs or list runs, e.g. 24h or 7d (analytics backfill and ls)")
+	fmt.Println("  --status <status>      Only list runs with this status, e.g. Completed or Failed (ls only)")
+	fmt.Println("  --template <id>        Only list runs of this template (ls only)")
+	fmt.Println("  --image-repo <repo>    Deploy/update the API and worker from another registry (e.g. europe-docker.pkg.dev/my-project/litmus)")
+	fmt.Println("  --api-image <image>    Full API image reference, overrides --image-repo (deploy and update)")
+	fmt.Println("  --worker-image <image> Full worker image reference, overrides --image-repo (deploy and update)")
+	fmt.Println("  --tasks <n>            Tasks started per worker job execution (deploy and update)")
+	fmt.Println("  --parallelism <n>      Maximum worker tasks running at once, at most --tasks (deploy and update)")
+	fmt.Println("  --task-timeout <dur>   Maximum run time of a worker task, e.g. 2h (deploy and update, up to 168h)")
+	fmt.Println("  --image-tag <tag>      Proxy image tag to roll out (proxy update only, default: latest)")
+	fmt.Println("  --verbose, -v          Also show the deployed API and worker images (status only)")
+	fmt.Println("  --health               Check that the API responds and the worker job exists (status only)")
+	fmt.Println("  --release-url <url>    Base URL of the published CLI for self-update (default: litmus-cloud/prod, also: LITMUS_RELEASE_URL)")
+	fmt.Println("  --reveal               Show the password unmasked (secrets show only)")
+	fmt.Println("  --context <context>    Litmus context of the test request (proxy test only, default: litmus-proxy-test)")
+	fmt.Println("  --print                Print the proxy URL instead of opening it (open-proxy only)")
+	fmt.Println("  --stream               Print the response as it arrives instead of buffering it (execute only)")
+	fmt.Println("  --file <path>          Read the input from a file (templates create/validate, proxy test and execute)")
+	fmt.Println("  --env-file <path>      Read deploy or update environment variables from a dotenv-style file")
+	fmt.Println("  --set-secret <NAME=SECRET[:VERSION][=VALUE]>  Expose a Secret Manager secret as an environment variable on deploy or update")
+	fmt.Println("  --password-stdin       Read the Litmus password from stdin instead of Secret Manager (also: LITMUS_PASSWORD, LITMUS_USERNAME)")
+	fmt.Println("\nExit codes:")
+	fmt.Println("  0 success, 1 user error, 2 gcloud/auth error, 3 transient error (retry), 4 check failed (start --wait, update --check, self-update --check, status --health)")
 	fmt.Println("\nExamples:")
 	fmt.Println("  litmus deploy")
 	fmt.Println("  litmus deploy --project my-project --region us-east1")
+	fmt.Println("  litmus deploy --env-file .env MY_VAR=override")
+	fmt.Println("  litmus deploy --set-secret UPSTREAM_API_KEY=upstream-api-key")
+	fmt.Println("  litmus deploy --image-repo europe-docker.pkg.dev/my-project/litmus-mirror")
 	fmt.Println("  litmus destroy --project my-project")
+	fmt.Println("  litmus destroy --project my-project --yes")
+	fmt.Println("  litmus destroy --only proxies,analytics")
+	fmt.Println("  litmus destroy --keep-service-accounts")
+	fmt.Println("  litmus deploy --instance staging")
+	fmt.Println("  litmus deploy --yes --timeout 20m")
+	fmt.Println("  litmus deploy --update-only MY_VAR=new-value")
+	fmt.Println("  litmus deploy --label team=ml --label cost-center=cc-1234")
 	fmt.Println("  litmus tunnel")
 	fmt.Println("  litmus execute my-payload.json")
+	fmt.Println("  litmus execute \"Tell me a story\" --stream")
+	fmt.Println("  cat prompt.txt | litmus execute -")
 	fmt.Println("  litmus start my-template my-run")
+	fmt.Println("  litmus start my-template --wait --timeout 30m")
 	fmt.Println("  litmus ls")
+	fmt.Println("  litmus ls --status failed --since 24h")
+	fmt.Println("  litmus run logs my-run")
 	fmt.Println("  litmus open")
 	fmt.Println("  litmus status")
+	fmt.Println("  litmus status --health --verbose")
+	fmt.Println("  litmus whoami --project my-project")
+	fmt.Println("  litmus secrets show")
+	fmt.Println("  litmus list-all --json")
+	fmt.Println("  litmus update --check")
+	fmt.Println("  litmus self-update --check")
+	fmt.Println("  litmus update MY_VAR=new-value OLD_VAR=")
 	fmt.Println("  litmus analytics deploy")
+	fmt.Println("  litmus analytics deploy --log-filter 'NOT jsonPayload.requestURI:\"/healthz\"'")
+	fmt.Println("  litmus analytics deploy --table-expiration 90d")
+	fmt.Println("  litmus analytics deploy --dry-run")
+	fmt.Println("  litmus analytics backfill --since 7d")
+	fmt.Println("  litmus analytics export-schema --json")
+	fmt.Println("  litmus export --output litmus-backup.tar.gz")
+	fmt.Println("  litmus import --input litmus-backup.tar.gz --on-conflict overwrite")
+	fmt.Println("  litmus domain map litmus.example.com")
+	fmt.Println("  litmus templates list")
+	fmt.Println("  litmus templates get my-template --json")
+	fmt.Println("  litmus templates create --file template.json")
+	fmt.Println("  litmus template validate --file template.json")
 	fmt.Println("  litmus proxy deploy --upstreamURL us-central1-aiplatform.googleapis.com")
+	fmt.Println("  litmus proxy deploy --upstream-url us-central1-aiplatform.googleapis.com --name shared-litmus-proxy")
+	fmt.Println("  litmus proxy update shared-litmus-proxy --image-tag v1.2.0 LITMUS_RATE_LIMIT_RPS=10")
+	fmt.Println("  litmus proxy url shared-litmus-proxy")
+	fmt.Println("  litmus proxy test shared-litmus-proxy --context smoke-test")
+	fmt.Println("  litmus open-proxy shared-litmus-proxy --print")
 	fmt.Println("  litmus proxy list")
 	fmt.Println("  litmus proxy destroy us-west3-aiplatform-litmus-abcd")
 	fmt.Println("  litmus proxy destroy-all")
 }
 
-// DisplayVersion prints the version of the Litmus CLI.
+// Build information, injected at build time with
+// -ldflags "-X github.com/google/litmus/cli/utils.Version=...".
+var (
+	Version   = ""
+	GitCommit = ""
+	BuildDate = ""
+)
+
+// BuildInfo returns the version, git commit and build date of the Litmus CLI.
+// When the values were not injected via ldflags, it falls back to the build
+// information embedded by the Go toolchain (e.g. for `go install` builds).
+func BuildInfo() (version, commit, date string) {
+	version, commit, date = Version, GitCommit, BuildDate
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if version == "" && info.Main.Version != "" {
+			version = info.Main.Version
+		}
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if commit == "" {
+					commit = setting.Value
+				}
+			case "vcs.time":
+				if date == "" {
+					date = setting.Value
+				}
+			}
+		}
+	}
+
+	if version == "" {
+		version = "(devel)"
+	}
+	if commit == "" {
+		commit = "unknown"
+	}
+	if date == "" {
+		date = "unknown"
+	}
+	return version, commit, date
+}
+
+// DisplayVersion prints the version, git commit and build date of the Litmus CLI.
 func DisplayVersion() {
-	fmt.Println("Litmus CLI version:", "1.0.0") // Update with your actual version
+	version, commit, date := BuildInfo()
+
+	fmt.Println("Litmus CLI version:", version)
+	fmt.Println("Git commit:", commit)
+	fmt.Println("Build date:", date)
+}
+
+// commandCtx bounds the gcloud and bq commands started with Command and the
+// Secret Manager calls, so a deadline for a whole CLI command, such as
+// deploy --timeout, cancels whatever is running when it expires.
+var commandCtx = context.Background()
+
+// SetCommandContext makes Command and the Secret Manager helpers use ctx.
+func SetCommandContext(ctx context.Context) {
+	commandCtx = ctx
+}
+
+// ExecCommand creates the processes started by Command. Tests replace it to
+// run a fake gcloud or bq.
+var ExecCommand = exec.CommandContext
+
+// Command returns an exec.Cmd that runs name and is killed once the command
+// context (see SetCommandContext) is done.
+func Command(name string, arg ...string) *exec.Cmd {
+	cmd := ExecCommand(commandCtx, name, arg...)
+	// gcloud's own child processes may keep the output pipes open after it
+	// is killed, don't wait for them indefinitely
+	cmd.WaitDelay = 5 * time.Second
+	return cmd
 }
 
+// AssumeYes makes ConfirmPrompt auto-confirm without reading from stdin.
+// It is set by the --yes/-y flag and, unlike --quiet, keeps normal output.
+var AssumeYes = false
+
+// Instance is the name suffix of the Litmus instance commands act on, set by
+// the --instance flag. It lets several instances (e.g. staging and prod)
+// live side by side in one project. Empty means the unsuffixed names.
+var Instance = ""
+
+var instanceRegex = regexp.MustCompile(`^[a-z]([a-z0-9-]{0,10}[a-z0-9])?$`)
+
+// ValidateInstance checks that an instance name can be appended to every
+// Litmus resource name. Service account IDs are the tightest limit (see
+// ServiceAccountID), so the name is kept short.
+func ValidateInstance(instance string) error {
+	if !instanceRegex.MatchString(instance) {
+		return fmt.Errorf("invalid instance '%s': use up to 12 lowercase letters, digits and hyphens, starting with a letter", instance)
+	}
+	return nil
+}
+
+// ResourceName returns the name of a Litmus resource for the current
+// instance, e.g. "litmus-api-staging" for "litmus-api" with --instance staging.
+func ResourceName(name string) string {
+	if Instance == "" {
+		return name
+	}
+	return name + "-" + Instance
+}
+
+// maxServiceAccountIDLength is the longest service account ID IAM accepts.
+const maxServiceAccountIDLength = 30
+
+// ServiceAccountID returns the ID of the service account of a Litmus
+// component ("api" or "worker"). Without an instance it is
+// "<project>-<component>", as in deployments made before instances existed,
+// unless that exceeds the 30 character limit of service account IDs. Then,
+// and for instances, it is "litmus-<component>[-<instance>]", which doesn't
+// depend on the project ID and stays within the limit.
+func ServiceAccountID(projectID, component string) string {
+	if Instance == "" {
+		if id := projectID + "-" + component; len(id) <= maxServiceAccountIDLength {
+			return id
+		}
+	}
+	return ResourceName("litmus-" + component)
+}
+
+// ErrNotInteractive is returned by ConfirmPrompt when stdin is not a
+// terminal and --yes was not given.
+var ErrNotInteractive = errors.New("cannot ask for confirmation because stdin is not a terminal, pass --yes to confirm")
+
 // ConfirmPrompt asks the user for confirmation with a yes/no question.
-func ConfirmPrompt(message string) bool {
+// When stdin is not a terminal, it returns ErrNotInteractive instead of
+// blocking on input that will never come.
+func ConfirmPrompt(message string) (bool, error) {
+	if AssumeYes {
+		fmt.Printf("%s (y/N): y (--yes)\n", message)
+		return true, nil
+	}
+	if !IsInteractive() {
+		fmt.Println(message)
+		return false, ErrNotInteractive
+	}
+
 	reader := bufio.NewReader(os.Stdin)
 	fmt.Printf("%s (y/N): ", message)
 	response, _ := reader.ReadString('\n')
 	response = strings.TrimSpace(response) // Remove leading/trailing whitespace
-	return strings.ToLower(response) == "y"
+	return strings.ToLower(response) == "y", nil
+}
+
+// IsInteractive reports whether stdin is a terminal, i.e. whether the user
+// can answer prompts.
+func IsInteractive() bool {
+	return term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// ValidateUpstreamURL checks upstreamURL the way the proxy parses
+// UPSTREAM_URL: a host name (optionally with a port) such as
+// "us-central1-aiplatform.googleapis.com", reached over HTTPS, or a full
+// http:// or https:// URL, optionally with a base path.
+func ValidateUpstreamURL(upstreamURL string) error {
+	raw := upstreamURL
+	if !strings.Contains(raw, "://") {
+		raw = "https://" + raw
+	}
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Hostname() == "" {
+		return fmt.Errorf("invalid upstream URL '%s': must be a host name such as us-central1-aiplatform.googleapis.com or an http(s):// URL", upstreamURL)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return fmt.Errorf("invalid upstream URL '%s': unsupported scheme '%s' (expected http or https)", upstreamURL, parsed.Scheme)
+	}
+	if parsed.User != nil || parsed.RawQuery != "" || parsed.Fragment != "" {
+		return fmt.Errorf("invalid upstream URL '%s': must not contain credentials, a query or a fragment", upstreamURL)
+	}
+	return nil
+}
+
+// VertexRegion returns the region of a regional Vertex AI upstream URL, such
+// as "us-central1" for "us-central1-aiplatform.googleapis.com" or
+// "https://us-central1-aiplatform.googleapis.com", and whether it is one.
+func VertexRegion(upstreamURL string) (string, bool) {
+	host := strings.TrimSuffix(strings.TrimPrefix(upstreamURL, "https://"), "/")
+	return strings.CutSuffix(host, "-aiplatform.googleapis.com")
+}
+
+// kmsKeyRegex matches a Cloud KMS key resource name.
+var kmsKeyRegex = regexp.MustCompile(`^projects/[^/]+/locations/[^/]+/keyRings/[^/]+/cryptoKeys/[^/]+$`)
+
+// ValidateKMSKey checks that kmsKey is a full Cloud KMS key resource name.
+func ValidateKMSKey(kmsKey string) error {
+	if !kmsKeyRegex.MatchString(kmsKey) {
+		return fmt.Errorf("invalid KMS key '%s': expected projects/<project>/locations/<location>/keyRings/<ring>/cryptoKeys/<key>", kmsKey)
+	}
+	return nil
+}
+
+// upstreamURLs are the regional Vertex AI endpoints offered by
+// SelectUpstreamURL. Their regions are also the regions Litmus can be
+// deployed to (see ValidateRegion).
+var upstreamURLs = []string{
+	"asia-east1-aiplatform.googleapis.com",
+	"asia-east2-aiplatform.googleapis.com",
+	"asia-northeast1-aiplatform.googleapis.com",
+	"asia-northeast2-aiplatform.googleapis.com",
+	"asia-northeast3-aiplatform.googleapis.com",
+	"asia-south1-aiplatform.googleapis.com",
+	"asia-southeast1-aiplatform.googleapis.com",
+	"asia-southeast2-aiplatform.googleapis.com",
+	"australia-southeast1-aiplatform.googleapis.com",
+	"australia-southeast2-aiplatform.googleapis.com",
+	"europe-central2-aiplatform.googleapis.com",
+	"europe-north1-aiplatform.googleapis.com",
+	"europe-southwest1-aiplatform.googleapis.com",
+	"europe-west1-aiplatform.googleapis.com",
+	"europe-west2-aiplatform.googleapis.com",
+	"europe-west3-aiplatform.googleapis.com",
+	"europe-west4-aiplatform.googleapis.com",
+	"europe-west6-aiplatform.googleapis.com",
+	"europe-west8-aiplatform.googleapis.com",
+	"europe-west9-aiplatform.googleapis.com",
+	"me-west1-aiplatform.googleapis.com",
+	"northamerica-northeast1-aiplatform.googleapis.com",
+	"northamerica-northeast2-aiplatform.googleapis.com",
+	"southamerica-east1-aiplatform.googleapis.com",
+	"southamerica-west1-aiplatform.googleapis.com",
+	"us-central1-aiplatform.googleapis.com",
+	"us-east1-aiplatform.googleapis.com",
+	"us-east4-aiplatform.googleapis.com",
+	"us-south1-aiplatform.googleapis.com",
+	"us-west1-aiplatform.googleapis.com",
+	"us-west2-aiplatform.googleapis.com",
+	"us-west3-aiplatform.googleapis.com",
+	"us-west4-aiplatform.googleapis.com",
+}
+
+// ValidateRegion checks that region is one of the regions Litmus supports and
+// suggests the closest match otherwise.
+func ValidateRegion(region string) error {
+	regions := SupportedRegions()
+	closest, bestDistance := "", -1
+	for _, candidate := range regions {
+		if candidate == region {
+			return nil
+		}
+		if distance := levenshtein(region, candidate); bestDistance == -1 || distance < bestDistance {
+			closest, bestDistance = candidate, distance
+		}
+	}
+	return fmt.Errorf("invalid region '%s'. Did you mean '%s'? Supported regions: %s", region, closest, strings.Join(regions, ", "))
+}
+
+// SupportedRegions returns the regions derived from upstreamURLs.
+func SupportedRegions() []string {
+	regions := make([]string, 0, len(upstreamURLs))
+	for _, upstreamURL := range upstreamURLs {
+		regions = append(regions, strings.TrimSuffix(upstreamURL, "-aiplatform.googleapis.com"))
+	}
+	return regions
+}
+
+// levenshtein returns the edit distance between a and b.
+func levenshtein(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
 }
 
 // SelectUpstreamURL presents a list of upstream URLs to the user and lets them choose one.
 func SelectUpstreamURL() (string, error) {
-	upstreamURLs := []string{
-		"asia-east1-aiplatform.googleapis.com",
-		"asia-east2-aiplatform.googleapis.com",
-		"asia-northeast1-aiplatform.googleapis.com",
-		"asia-northeast2-aiplatform.googleapis.com",
-		"asia-northeast3-aiplatform.googleapis.com",
-		"asia-south1-aiplatform.googleapis.com",
-		"asia-southeast1-aiplatform.googleapis.com",
-		"asia-southeast2-aiplatform.googleapis.com",
-		"australia-southeast1-aiplatform.googleapis.com",
-		"australia-southeast2-aiplatform.googleapis.com",
-		"europe-central2-aiplatform.googleapis.com",
-		"europe-north1-aiplatform.googleapis.com",
-		"europe-southwest1-aiplatform.googleapis.com",
-		"europe-west1-aiplatform.googleapis.com",
-		"europe-west2-aiplatform.googleapis.com",
-		"europe-west3-aiplatform.googleapis.com",
-		"europe-west4-aiplatform.googleapis.com",
-		"europe-west6-aiplatform.googleapis.com",
-		"europe-west8-aiplatform.googleapis.com",
-		"europe-west9-aiplatform.googleapis.com",
-		"me-west1-aiplatform.googleapis.com",
-		"northamerica-northeast1-aiplatform.googleapis.com",
-		"northamerica-northeast2-aiplatform.googleapis.com",
-		"southamerica-east1-aiplatform.googleapis.com",
-		"southamerica-west1-aiplatform.googleapis.com",
-		"us-central1-aiplatform.googleapis.com",
-		"us-east1-aiplatform.googleapis.com",
-		"us-east4-aiplatform.googleapis.com",
-		"us-south1-aiplatform.googleapis.com",
-		"us-west1-aiplatform.googleapis.com",
-		"us-west2-aiplatform.googleapis.com",
-		"us-west3-aiplatform.googleapis.com",
-		"us-west4-aiplatform.googleapis.com",
+	if !IsInteractive() {
+		return "", fmt.Errorf("cannot select an upstream URL because stdin is not a terminal")
 	}
 
 	fmt.Println("Available upstream URLs:")
@@ -394,18 +899,46 @@ func SelectUpstreamURL() (string, error) {
 	return upstreamURLs[choice-1], nil
 }
 
-// getAuthCredentials retrieves the basic authentication username and password from Secret Manager.
+// stdinPassword is the password read by ReadPasswordFromStdin.
+var stdinPassword string
+
+// ReadPasswordFromStdin reads the Litmus password from the first line of
+// stdin (--password-stdin), so CI can inject it without Secret Manager access
+// and without exposing it in process arguments.
+func ReadPasswordFromStdin() error {
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return fmt.Errorf("failed to read password from stdin: %w", err)
+	}
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return fmt.Errorf("--password-stdin was given but stdin is empty")
+	}
+	stdinPassword = password
+	return nil
+}
+
+// GetAuthCredentials returns the basic authentication username and password.
+// The password is taken, in order of precedence, from --password-stdin, the
+// LITMUS_PASSWORD environment variable, or the litmus-password secret in
+// Secret Manager. The username is LITMUS_USERNAME, or "admin" if unset.
 func GetAuthCredentials(projectID string) (string, string, error) {
-	//username, err := AccessSecret(projectID, "litmus-username") // Replace with your secret name
-	//if err != nil {
-	//	return "", "", fmt.Errorf("error retrieving username from Secret Manager: %w", err)
-	//}
-	username := "admin"
+	username := os.Getenv("LITMUS_USERNAME")
+	if username == "" {
+		username = "admin"
+	}
 
-	password, err := AccessSecret(projectID, "litmus-password") // Replace with your secret name
+	if stdinPassword != "" {
+		return username, stdinPassword, nil
+	}
+	if password := os.Getenv("LITMUS_PASSWORD"); password != "" {
+		return username, password, nil
+	}
+
+	password, err := AccessSecret(projectID, ResourceName("litmus-password"))
 	if err != nil {
 		return "", "", fmt.Errorf("error retrieving password from Secret Manager: %w", err)
 	}
 
 	return username, password, nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,60 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"regexp"
+	"testing"
+)
+
+// serviceAccountIDRegex matches the service account IDs IAM accepts.
+var serviceAccountIDRegex = regexp.MustCompile(`^[a-z]([-a-z0-9]{4,28}[a-z0-9])$`)
+
+func TestServiceAccountID(t *testing.T) {
+	tests := []struct {
+		name      string
+		projectID string
+		instance  string
+		component string
+		want      string
+	}{
+		{name: "unsuffixed", projectID: "my-proj", component: "api", want: "my-proj-api"},
+		{name: "unsuffixed worker", projectID: "my-proj", component: "worker", want: "my-proj-worker"},
+		{name: "long project", projectID: "a-very-long-project-id-12345", component: "worker", want: "litmus-worker"},
+		{name: "instance", projectID: "my-proj", instance: "staging", component: "api", want: "litmus-api-staging"},
+		{name: "longest instance", projectID: "a-very-long-project-id-12345", instance: "abcdefghijkl", component: "worker", want: "litmus-worker-abcdefghijkl"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saved := Instance
+			t.Cleanup(func() { Instance = saved })
+			if tt.instance != "" {
+				if err := ValidateInstance(tt.instance); err != nil {
+					t.Fatal(err)
+				}
+			}
+			Instance = tt.instance
+
+			got := ServiceAccountID(tt.projectID, tt.component)
+			if got != tt.want {
+				t.Errorf("ServiceAccountID(%q, %q) = %q, want %q", tt.projectID, tt.component, got, tt.want)
+			}
+			if !serviceAccountIDRegex.MatchString(got) {
+				t.Errorf("ServiceAccountID(%q, %q) = %q, not a valid service account ID", tt.projectID, tt.component, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"cloud.google.com/go/storage"
+)
+
+const (
+	// Cloud Logging entries are limited to 256KB, keep bodies well below that
+	defaultBodySizeThreshold = 100 * 1024
+	bodyPreviewSize          = 1024
+	// Uploads run after the response is sent, bound them so a stalled
+	// upload doesn't hold the request's buffers indefinitely
+	bodyUploadTimeout = 30 * time.Second
+)
+
+// bodyStorage offloads request/response bodies that are too large for
+// Cloud Logging to a GCS bucket.
+type bodyStorage struct {
+	client    *storage.Client
+	bucket    string
+	threshold int
+}
+
+// newBodyStorage creates a bodyStorage from LITMUS_BODY_BUCKET and
+// LITMUS_BODY_SIZE_THRESHOLD. It returns nil if no bucket is configured.
+func newBodyStorage(ctx context.Context) (*bodyStorage, error) {
+	bucket := os.Getenv("LITMUS_BODY_BUCKET")
+	if bucket == "" {
+		return nil, nil
+	}
+
+	threshold := defaultBodySizeThreshold
+	if value := os.Getenv("LITMUS_BODY_SIZE_THRESHOLD"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			return nil, fmt.Errorf("invalid LITMUS_BODY_SIZE_THRESHOLD '%s': must be a positive number of bytes", value)
+		}
+		threshold = parsed
+	}
+
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Cloud Storage client: %w", err)
+	}
+
+	return &bodyStorage{client: client, bucket: bucket, threshold: threshold}, nil
+}
+
+// exceeds reports whether the body is too large to be logged inline.
+func (s *bodyStorage) exceeds(body []byte) bool {
+	return s != nil && len(body) > s.threshold
+}
+
+// upload writes the body to gs://<bucket>/litmus-bodies/<litmusContext>/<requestID>/<kind>
+// and returns the object URI.
+func (s *bodyStorage) upload(ctx context.Context, litmusContext, requestID, kind string, body []byte) (string, error) {
+	object := path.Join("litmus-bodies", litmusContext, requestID, kind)
+	writer := s.client.Bucket(s.bucket).Object(object).NewWriter(ctx)
+	if _, err := writer.Write(body); err != nil {
+		writer.Close()
+		return "", err
+	}
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("gs://%s/%s", s.bucket, object), nil
+}
+
+// offload uploads an oversized body and returns its URI together with a
+// truncated preview to log inline. If the upload fails, the URI is empty and
+// only the preview is logged.
+func (s *bodyStorage) offload(ctx context.Context, litmusContext, requestID, kind string, body []byte) (string, string) {
+	uri, err := s.upload(ctx, litmusContext, requestID, kind, body)
+	if err != nil {
+		log.Printf("Failed to offload %s body to GCS, logging truncated body: %v", kind, err)
+	}
+	return uri, bodyPreview(body)
+}
+
+// bodyPreview returns the first bodyPreviewSize bytes of body, cut at a
+// valid UTF-8 boundary.
+func bodyPreview(body []byte) string {
+	if len(body) <= bodyPreviewSize {
+		return string(body)
+	}
+	preview := body[:bodyPreviewSize]
+	// Drop a multi-byte character split by the cut
+	for i := 0; i < utf8.UTFMax && len(preview) > 0 && !utf8.Valid(preview); i++ {
+		preview = preview[:len(preview)-1]
+	}
+	return string(preview)
+}
+
+// Close releases the underlying Cloud Storage client.
+func (s *bodyStorage) Close() error {
+	return s.client.Close()
+}
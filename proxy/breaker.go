@@ -0,0 +1,112 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/sony/gobreaker"
+)
+
+const (
+	defaultBreakerFailureThreshold = 5
+	defaultBreakerCooldown         = 30 * time.Second
+)
+
+// errUpstreamFailure marks a 5xx upstream response as a breaker failure.
+var errUpstreamFailure = errors.New("upstream returned a server error")
+
+// breakerTransport wraps a RoundTripper with a circuit breaker that opens
+// after consecutive upstream failures (transport errors or 5xx responses).
+type breakerTransport struct {
+	next    http.RoundTripper
+	breaker *gobreaker.CircuitBreaker
+}
+
+// newBreakerTransport wraps next with a circuit breaker configured by
+// LITMUS_BREAKER_FAILURE_THRESHOLD (consecutive failures before opening,
+// 0 disables the breaker) and LITMUS_BREAKER_COOLDOWN (how long to fast-fail
+// before probing the upstream again, e.g. "30s").
+func newBreakerTransport(next http.RoundTripper) (http.RoundTripper, error) {
+	threshold := defaultBreakerFailureThreshold
+	if value := os.Getenv("LITMUS_BREAKER_FAILURE_THRESHOLD"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			return nil, fmt.Errorf("invalid LITMUS_BREAKER_FAILURE_THRESHOLD '%s': must be a non-negative integer", value)
+		}
+		threshold = parsed
+	}
+	if threshold == 0 {
+		return next, nil
+	}
+
+	cooldown := defaultBreakerCooldown
+	if value := os.Getenv("LITMUS_BREAKER_COOLDOWN"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			return nil, fmt.Errorf("invalid LITMUS_BREAKER_COOLDOWN '%s': must be a positive duration", value)
+		}
+		cooldown = parsed
+	}
+
+	breaker := gobreaker.NewCircuitBreaker(gobreaker.Settings{
+		Name:        "upstream",
+		MaxRequests: 1, // Probe with a single request when half-open
+		Timeout:     cooldown,
+		ReadyToTrip: func(counts gobreaker.Counts) bool {
+			return counts.ConsecutiveFailures >= uint32(threshold)
+		},
+		OnStateChange: func(name string, from, to gobreaker.State) {
+			log.Printf("Circuit breaker for %s changed from %s to %s", upstreamURLStr, from, to)
+		},
+	})
+
+	return &breakerTransport{next: next, breaker: breaker}, nil
+}
+
+// RoundTrip sends the request through the circuit breaker. When the breaker
+// is open, it fails fast with gobreaker.ErrOpenState.
+func (t *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	result, err := t.breaker.Execute(func() (interface{}, error) {
+		resp, err := t.next.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return resp, errUpstreamFailure
+		}
+		return resp, nil
+	})
+
+	// 5xx responses count as failures but are still passed to the client
+	if errors.Is(err, errUpstreamFailure) {
+		return result.(*http.Response), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result.(*http.Response), nil
+}
+
+// isBreakerOpen reports whether err was caused by the circuit breaker shedding load.
+func isBreakerOpen(err error) bool {
+	return errors.Is(err, gobreaker.ErrOpenState) || errors.Is(err, gobreaker.ErrTooManyRequests)
+}
@@ -0,0 +1,72 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// decodeBody reverses the codings listed in a Content-Encoding header
+// (gzip, deflate and br) so the body can be logged in readable form. Codings
+// are applied in the order listed, so they are removed from last to first.
+func decodeBody(contentEncoding string, body []byte) ([]byte, error) {
+	codings := strings.Split(contentEncoding, ",")
+	for i := len(codings) - 1; i >= 0; i-- {
+		coding := strings.ToLower(strings.TrimSpace(codings[i]))
+
+		var reader io.Reader
+		switch coding {
+		case "", "identity":
+			continue
+		case "gzip", "x-gzip":
+			gr, err := gzip.NewReader(bytes.NewReader(body))
+			if err != nil {
+				return nil, fmt.Errorf("invalid gzip body: %w", err)
+			}
+			defer gr.Close()
+			reader = gr
+		case "deflate":
+			// "deflate" is zlib-wrapped, but some clients send raw deflate
+			zr, err := zlib.NewReader(bytes.NewReader(body))
+			if err != nil {
+				fr := flate.NewReader(bytes.NewReader(body))
+				defer fr.Close()
+				reader = fr
+			} else {
+				defer zr.Close()
+				reader = zr
+			}
+		case "br":
+			reader = brotli.NewReader(bytes.NewReader(body))
+		default:
+			return nil, fmt.Errorf("unsupported content encoding '%s'", coding)
+		}
+
+		decoded, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s body: %w", coding, err)
+		}
+		body = decoded
+	}
+	return body, nil
+}
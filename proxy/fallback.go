@@ -0,0 +1,144 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// Consecutive Cloud Logging failures before entries go straight to stderr
+	fallbackFailureThreshold = 5
+	// How long to write to stderr before trying Cloud Logging again
+	fallbackCooldown = 30 * time.Second
+	// Path of the proxy's own metrics, answered instead of being proxied
+	metricsPath = "/_litmus/metrics"
+)
+
+// Counters exposed on metricsPath
+var (
+	logWriteFailures  atomic.Int64 // Failed Cloud Logging writes
+	logFallbackWrites atomic.Int64 // Entries written to stderr instead
+)
+
+// fallbackRequestLogger writes entries to next and falls back to writing
+// them as JSON lines to out when that fails, so request logs are not lost
+// while Cloud Logging is unavailable (e.g. quota or permission errors). On
+// Cloud Run, stderr is still collected in the service's own logs. After
+// fallbackFailureThreshold consecutive failures it stops calling next for
+// fallbackCooldown, so requests don't keep waiting on a failing backend.
+type fallbackRequestLogger struct {
+	next RequestLogger
+
+	mu                  sync.Mutex
+	out                 io.Writer
+	consecutiveFailures int
+	degradedUntil       time.Time
+}
+
+func newFallbackRequestLogger(next RequestLogger) *fallbackRequestLogger {
+	return &fallbackRequestLogger{next: next, out: os.Stderr}
+}
+
+// fallbackEntry is the JSON line written for an entry that could not be
+// sent to Cloud Logging.
+type fallbackEntry struct {
+	Message    string     `json:"message"`
+	Severity   string     `json:"severity"`
+	RequestLog requestLog `json:"requestLog"`
+}
+
+// Log writes the entry to the next logger, or to stderr if that fails or
+// Cloud Logging is currently considered unavailable. It only returns an
+// error if the entry could not be written anywhere.
+func (l *fallbackRequestLogger) Log(entry requestLog) error {
+	if !l.degraded() {
+		err := l.next.Log(entry)
+		l.record(err)
+		if err == nil {
+			return nil
+		}
+		logWriteFailures.Add(1)
+		log.Printf("Failed to write request log to Cloud Logging, writing it to stderr: %v", err)
+	}
+
+	line, err := json.Marshal(fallbackEntry{
+		Message:    "litmus-proxy-log fallback",
+		Severity:   "WARNING",
+		RequestLog: entry,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode fallback log entry: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := fmt.Fprintf(l.out, "%s\n", line); err != nil {
+		return fmt.Errorf("failed to write fallback log entry: %w", err)
+	}
+	logFallbackWrites.Add(1)
+	return nil
+}
+
+// degraded reports whether Cloud Logging is skipped after repeated failures.
+func (l *fallbackRequestLogger) degraded() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return time.Now().Before(l.degradedUntil)
+}
+
+// record tracks consecutive failures and starts the cooldown once they
+// reach fallbackFailureThreshold.
+func (l *fallbackRequestLogger) record(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err == nil {
+		if l.consecutiveFailures >= fallbackFailureThreshold {
+			log.Printf("Cloud Logging writes recovered")
+		}
+		l.consecutiveFailures = 0
+		return
+	}
+	l.consecutiveFailures++
+	if l.consecutiveFailures >= fallbackFailureThreshold {
+		l.degradedUntil = time.Now().Add(fallbackCooldown)
+		log.Printf("%d consecutive Cloud Logging failures, writing request logs to stderr for %s", l.consecutiveFailures, fallbackCooldown)
+	}
+}
+
+// serveMetrics writes the proxy's counters in the Prometheus text format.
+func serveMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintln(w, "# HELP litmus_proxy_log_write_failures_total Request log writes to Cloud Logging that failed.")
+	fmt.Fprintln(w, "# TYPE litmus_proxy_log_write_failures_total counter")
+	fmt.Fprintf(w, "litmus_proxy_log_write_failures_total %d\n", logWriteFailures.Load())
+	fmt.Fprintln(w, "# HELP litmus_proxy_log_fallback_writes_total Request logs written to stderr instead of Cloud Logging.")
+	fmt.Fprintln(w, "# TYPE litmus_proxy_log_fallback_writes_total counter")
+	fmt.Fprintf(w, "litmus_proxy_log_fallback_writes_total %d\n", logFallbackWrites.Load())
+	fmt.Fprintln(w, "# HELP litmus_proxy_inflight_requests Requests currently being proxied.")
+	fmt.Fprintln(w, "# TYPE litmus_proxy_inflight_requests gauge")
+	fmt.Fprintf(w, "litmus_proxy_inflight_requests %d\n", inflightRequests.Load())
+	fmt.Fprintln(w, "# HELP litmus_proxy_inflight_rejected_total Requests rejected because LITMUS_MAX_INFLIGHT was reached.")
+	fmt.Fprintln(w, "# TYPE litmus_proxy_inflight_rejected_total counter")
+	fmt.Fprintf(w, "litmus_proxy_inflight_rejected_total %d\n", inflightRejected.Load())
+}
@@ -0,0 +1,83 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// Gauges and counters exposed on metricsPath
+var (
+	inflightRequests atomic.Int64 // Requests currently being proxied
+	inflightRejected atomic.Int64 // Requests rejected by the in-flight limit
+)
+
+// inflightLimiter bounds the number of requests proxied at the same time.
+type inflightLimiter struct {
+	sem   *semaphore.Weighted
+	limit int
+	wait  time.Duration // How long a request queues for a slot, 0 fails fast
+}
+
+// newInflightLimiter creates a limiter from LITMUS_MAX_INFLIGHT and
+// LITMUS_MAX_INFLIGHT_WAIT. It returns nil if the limit is not configured.
+func newInflightLimiter() (*inflightLimiter, error) {
+	limit, err := intFromEnv("LITMUS_MAX_INFLIGHT", 0)
+	if err != nil {
+		return nil, err
+	}
+	if limit == 0 {
+		return nil, nil
+	}
+
+	var wait time.Duration
+	if value := os.Getenv("LITMUS_MAX_INFLIGHT_WAIT"); value != "" {
+		wait, err = time.ParseDuration(value)
+		if err != nil || wait < 0 {
+			return nil, fmt.Errorf("invalid LITMUS_MAX_INFLIGHT_WAIT '%s': must be a non-negative duration such as 500ms", value)
+		}
+	}
+
+	return &inflightLimiter{
+		sem:   semaphore.NewWeighted(int64(limit)),
+		limit: limit,
+		wait:  wait,
+	}, nil
+}
+
+// acquire takes a slot, waiting up to l.wait for one to free up or until ctx
+// is done. It returns false if no slot was taken.
+func (l *inflightLimiter) acquire(ctx context.Context) bool {
+	if l.sem.TryAcquire(1) {
+		return true
+	}
+	if l.wait == 0 {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(ctx, l.wait)
+	defer cancel()
+	return l.sem.Acquire(ctx, 1) == nil
+}
+
+// release frees a slot taken by acquire.
+func (l *inflightLimiter) release() {
+	l.sem.Release(1)
+}
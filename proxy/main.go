@@ -19,46 +19,102 @@ import (
 	"compress/gzip"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log"
+	"math"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"os"
+	"os/signal"
 	"regexp"
 	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"cloud.google.com/go/logging"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
 	projectID      = os.Getenv("PROJECT_ID")
-	logger         *logging.Logger
-	upstreamURLStr = "https://" + os.Getenv("UPSTREAM_URL")
+	upstreamURLStr string               // Resolved from UPSTREAM_URL in main
 	tracingHeader  = "X-Litmus-Request" // Customizable tracing header name
 	// Default to NOT logging the Authorization header for security reasons
 	logAuthorizationHeader, _ = strconv.ParseBool(os.Getenv("LOG_AUTHORIZATION_HEADER"))
-	// Regex to match /litmus-context-<random-string>/ path prefix
-	contextPathRegex = regexp.MustCompile(`^/?(litmus-context-[a-zA-Z0-9\-]+)?(/.*)?$`)
+	// Query parameters whose values are redacted in logs (case-insensitive)
+	sensitiveQueryParams = []string{"key", "api_key", "apikey", "access_token", "token", "password", "secret"}
+	// Optional path prefix to strip from / add to the forwarded path
+	stripPrefix = os.Getenv("LITMUS_STRIP_PREFIX")
+	addPrefix   = os.Getenv("LITMUS_ADD_PREFIX")
+	// Host header sent upstream instead of the UPSTREAM_URL host, for
+	// gateways that route by a different name than the one they're reached at
+	upstreamHostHeader = strings.TrimSpace(os.Getenv("LITMUS_UPSTREAM_HOST_HEADER"))
+	// Offloads oversized bodies to GCS, nil if LITMUS_BODY_BUCKET is not set
+	bodyStore *bodyStorage
+	// Log writes still running after their response was sent
+	pendingLogs sync.WaitGroup
+	// Per-context rate limiter, nil if LITMUS_RATE_LIMIT_RPS is not set
+	rateLimiter *contextRateLimiter
+	// Limit on concurrent upstream requests, nil if LITMUS_MAX_INFLIGHT is not set
+	inflight *inflightLimiter
+	// Only requests whose forwarded path matches are logged, nil logs all.
+	// Set from LITMUS_LOG_PATH_REGEX.
+	logPathRegex *regexp.Regexp
+	// Regex to match /litmus-context-<context>/ path prefix.
+	// Group 1 is the context value, group 2 the remaining path (may be empty).
+	contextPathRegex = regexp.MustCompile(`^/?litmus-context-([a-zA-Z0-9\-]+)(/.*)?$`)
 )
 
 type requestLog struct {
-	ID             string      `json:"id"`
-	TracingID      string      `json:"tracingID"`
-	LitmusContext  string      `json:"litmusContext"`
-	Timestamp      time.Time   `json:"timestamp"`
-	Method         string      `json:"method"`
-	RequestURI     string      `json:"requestURI"`
-	UpstreamURL    string      `json:"upstreamURL"`
-	RequestHeaders http.Header `json:"requestHeaders"`
-	RequestBody    interface{} `json:"requestBody"`
-	RequestSize    int64       `json:"requestSize"`
-	ResponseStatus int         `json:"responseStatus"`
-	ResponseBody   interface{} `json:"responseBody"`
-	ResponseSize   int64       `json:"responseSize"`
-	Latency        int64       `json:"latency"`
+	ID              string      `json:"id"`
+	TracingID       string      `json:"tracingID"`
+	LitmusContext   string      `json:"litmusContext"`
+	Timestamp       time.Time   `json:"timestamp"`
+	Method          string      `json:"method"`
+	RequestURI      string      `json:"requestURI"`
+	QueryParams     url.Values  `json:"queryParams,omitempty"`
+	UpstreamURL     string      `json:"upstreamURL"`
+	UpstreamPath    string      `json:"upstreamPath"`
+	RequestHeaders  http.Header `json:"requestHeaders"`
+	RequestBody     interface{} `json:"requestBody"`
+	RequestBodyURI  string      `json:"requestBodyURI,omitempty"`
+	RequestSize     int64       `json:"requestSize"`
+	ResponseStatus  int         `json:"responseStatus"`
+	ResponseBody    interface{} `json:"responseBody"`
+	ResponseBodyURI string      `json:"responseBodyURI,omitempty"`
+	ResponseSize    int64       `json:"responseSize"`
+	Latency         int64       `json:"latency"`
+	UpstreamLatency int64       `json:"upstreamLatency"`
+	ProxyOverhead   int64       `json:"proxyOverhead"`
+	Upgrade         string      `json:"upgrade,omitempty"`
+}
+
+// RequestLogger writes a combined request/response log entry to a sink.
+type RequestLogger interface {
+	Log(entry requestLog) error
+}
+
+// cloudRequestLogger is a RequestLogger backed by Cloud Logging.
+type cloudRequestLogger struct {
+	logger *logging.Logger
+}
+
+// Log writes the entry synchronously to Cloud Logging.
+func (l *cloudRequestLogger) Log(entry requestLog) error {
+	return l.logger.LogSync(context.Background(), logging.Entry{
+		Payload: entry,
+	})
 }
 
 func main() {
@@ -69,29 +125,199 @@ func main() {
 		log.Fatalf("Failed to create Cloud Logging client: %v", err)
 	}
 	defer logClient.Close()
-	logger = logClient.Logger("litmus-proxy-log")
+	requestLogger := newFallbackRequestLogger(&cloudRequestLogger{logger: logClient.Logger("litmus-proxy-log")})
+
+	// Initialize optional GCS storage for oversized bodies
+	bodyStore, err = newBodyStorage(ctx)
+	if err != nil {
+		log.Fatalf("Failed to initialize body storage: %v", err)
+	}
+	if bodyStore != nil {
+		defer bodyStore.Close()
+	}
+
+	// Initialize OpenTelemetry tracing
+	shutdownTracing, err := initTracing(ctx)
+	if err != nil {
+		log.Fatalf("Failed to initialize tracing: %v", err)
+	}
+	defer shutdownTracing(context.Background())
 
 	// Validate UPSTREAM_URL
-	if upstreamURLStr == "" {
-		log.Fatal("UPSTREAM_URL environment variable is not set")
+	upstreamURL, err := upstreamURLFromEnv()
+	if err != nil {
+		log.Fatal(err)
 	}
-	upstreamURL, err := url.Parse(upstreamURLStr)
+	upstreamURLStr = upstreamURL.String()
+
+	// Compile the optional log path filter
+	if pattern := os.Getenv("LITMUS_LOG_PATH_REGEX"); pattern != "" {
+		logPathRegex, err = regexp.Compile(pattern)
+		if err != nil {
+			log.Fatalf("Invalid LITMUS_LOG_PATH_REGEX: %v", err)
+		}
+	}
+
+	// Initialize optional per-context rate limiting
+	rateLimiter, err = newContextRateLimiter()
 	if err != nil {
-		log.Fatalf("Invalid UPSTREAM_URL: %v", err)
+		log.Fatalf("Invalid rate limit configuration: %v", err)
 	}
 
+	// Initialize the optional limit on concurrent upstream requests
+	inflight, err = newInflightLimiter()
+	if err != nil {
+		log.Fatalf("Invalid in-flight limit configuration: %v", err)
+	}
+
+	// Build the upstream transport
+	upstreamTransport, err := newUpstreamTransport()
+	if err != nil {
+		log.Fatalf("Invalid upstream transport configuration: %v", err)
+	}
+	transport, err := newBreakerTransport(upstreamTransport)
+	if err != nil {
+		log.Fatalf("Invalid circuit breaker configuration: %v", err)
+	}
+
+	listenAddr, err := resolveListenAddr()
+	if err != nil {
+		log.Fatalf("Invalid listen address: %v", err)
+	}
+
+	server := &http.Server{
+		Addr:    listenAddr,
+		Handler: newProxyHandler(upstreamURL, requestLogger, transport),
+	}
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Printf("Litmus proxy listening on %s, forwarding to %s", listenAddr, upstreamURL)
+		serveErr <- server.ListenAndServe()
+	}()
+
+	// Cloud Run sends SIGTERM and allows 10 seconds before stopping the
+	// instance, so drain in-flight requests and release upstream connections
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, os.Interrupt)
+	select {
+	case err := <-serveErr:
+		log.Fatal(err)
+	case sig := <-stop:
+		log.Printf("Received %s, shutting down", sig)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Failed to shut down gracefully: %v", err)
+	}
+	upstreamTransport.CloseIdleConnections()
+
+	// Let pending log writes finish before the clients are closed
+	logsDone := make(chan struct{})
+	go func() {
+		pendingLogs.Wait()
+		close(logsDone)
+	}()
+	select {
+	case <-logsDone:
+	case <-shutdownCtx.Done():
+		log.Printf("Stopped waiting for pending log writes: %v", shutdownCtx.Err())
+	}
+}
+
+// resolveListenAddr returns the address to listen on: LITMUS_LISTEN_ADDR if
+// set, otherwise ":$PORT" (Cloud Run's standard), defaulting to ":8080".
+func resolveListenAddr() (string, error) {
+	addr := ":8080"
+	if port := os.Getenv("PORT"); port != "" {
+		addr = ":" + port
+	}
+	if listenAddr := os.Getenv("LITMUS_LISTEN_ADDR"); listenAddr != "" {
+		addr = listenAddr
+	}
+
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", fmt.Errorf("'%s' is not a valid host:port address: %w", addr, err)
+	}
+	portNumber, err := strconv.Atoi(port)
+	if err != nil || portNumber < 0 || portNumber > 65535 {
+		return "", fmt.Errorf("'%s' does not contain a valid port (0-65535)", addr)
+	}
+	return addr, nil
+}
+
+// upstreamURLFromEnv reads and parses UPSTREAM_URL, telling an unset
+// variable apart from an empty or invalid one.
+func upstreamURLFromEnv() (*url.URL, error) {
+	raw, ok := os.LookupEnv("UPSTREAM_URL")
+	if !ok {
+		return nil, errors.New("UPSTREAM_URL not set: set it to the upstream host, e.g. us-central1-aiplatform.googleapis.com")
+	}
+	u, err := parseUpstreamURL(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid UPSTREAM_URL: %w", err)
+	}
+	return u, nil
+}
+
+// parseUpstreamURL resolves UPSTREAM_URL. A bare host, such as
+// "us-central1-aiplatform.googleapis.com", is reached over HTTPS; a full
+// http:// or https:// URL is used as is, e.g. for an internal test service.
+func parseUpstreamURL(raw string) (*url.URL, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, errors.New("value is empty")
+	}
+	if !strings.Contains(raw, "://") {
+		raw = "https://" + raw
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported scheme '%s' in %s (expected http or https)", u.Scheme, raw)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("missing host in %s", raw)
+	}
+	if u.User != nil || u.RawQuery != "" || u.Fragment != "" {
+		return nil, fmt.Errorf("%s must not contain credentials, a query or a fragment", raw)
+	}
+	return u, nil
+}
+
+// newProxyHandler returns the HTTP handler that proxies all requests to
+// upstreamURL using transport and logs them to requestLogger. It can be
+// served by any http.Server (e.g. httptest).
+func newProxyHandler(upstreamURL *url.URL, requestLogger RequestLogger, transport http.RoundTripper) http.Handler {
 	// Explicitly create a reverse proxy
 	proxy := httputil.NewSingleHostReverseProxy(upstreamURL)
+	proxy.Transport = transport
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		if isBreakerOpen(err) {
+			// Fast-fail while the upstream is shed
+			log.Printf("Circuit breaker open, rejecting %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		log.Printf("http: proxy error: %v", err)
+		w.WriteHeader(http.StatusBadGateway)
+	}
 
 	// Custom handler to wrap the proxy
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		handleRequest(w, r, proxy, upstreamURL)
+	mux := http.NewServeMux()
+	mux.HandleFunc(metricsPath, serveMetrics)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		handleRequest(w, r, proxy, upstreamURL, requestLogger)
 	})
-
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	return mux
 }
 
-func handleRequest(w http.ResponseWriter, r *http.Request, proxy *httputil.ReverseProxy, upstreamURL *url.URL) {
+func handleRequest(w http.ResponseWriter, r *http.Request, proxy *httputil.ReverseProxy, upstreamURL *url.URL, requestLogger RequestLogger) {
 	startTime := time.Now()
 	requestID := uuid.New().String()
 	tracingID := r.Header.Get(tracingHeader)
@@ -99,15 +325,42 @@ func handleRequest(w http.ResponseWriter, r *http.Request, proxy *httputil.Rever
 		tracingID = uuid.New().String()
 	}
 
-	// Extract Litmus Context from path
+	// Extract Litmus Context from path and apply prefix rewrites, keeping the
+	// client-facing path for the log
+	clientPath := r.URL.Path
 	litmusContext, newPath := extractLitmusContext(r.URL.Path)
-	r.URL.Path = newPath
+	r.URL.Path = rewritePath(newPath)
+	r.URL.RawPath = ""
 
 	// If no context is found in the path, use the tracingID as the context
 	if litmusContext == "" {
 		litmusContext = tracingID
 	}
 
+	// Enforce the per-context rate limit
+	if rateLimiter != nil {
+		if ok, retryAfter := rateLimiter.allow(litmusContext); !ok {
+			log.Printf("Rate limit exceeded for context %s", litmusContext)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+			return
+		}
+	}
+
+	// Bound the number of concurrent upstream requests
+	if inflight != nil {
+		if !inflight.acquire(r.Context()) {
+			inflightRejected.Add(1)
+			log.Printf("In-flight limit of %d reached, rejecting %s %s", inflight.limit, r.Method, r.URL.Path)
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		defer inflight.release()
+	}
+	inflightRequests.Add(1)
+	defer inflightRequests.Add(-1)
+
 	// Ensure Correct Protocol Scheme
 	if r.URL.Scheme == "" {
 		r.URL.Scheme = upstreamURL.Scheme
@@ -117,27 +370,48 @@ func handleRequest(w http.ResponseWriter, r *http.Request, proxy *httputil.Rever
 		r.URL.Host = upstreamURL.Host
 	}
 
-	// Create a new buffer to hold the request body
-	requestBodyBuffer := bytes.NewBuffer(nil)
-	// Copy the request body to the buffer
-	if _, err := io.Copy(requestBodyBuffer, r.Body); err != nil {
-		log.Printf("Error reading request body: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		return
-	}
-
-	// Get the byte slice from the buffer
-	requestBody := requestBodyBuffer.Bytes()
+	// Read the request body (if any) so it can be both logged and proxied
+	var requestBody []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		body, err := io.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			// Still proxy what was read, the upstream will reject it if incomplete
+			log.Printf("Error reading request body after %d bytes, proxying partial body: %v", len(body), err)
+			r.ContentLength = int64(len(body))
+		}
+		requestBody = body
 
-	// Reset the request body for the proxy using the buffer
-	r.Body = io.NopCloser(requestBodyBuffer)
+		// Reset the request body for the proxy
+		r.Body = io.NopCloser(bytes.NewReader(requestBody))
+	}
 
-	// Set the Host header to the upstream URL
+	// Set the Host header to the upstream URL, or the configured override
 	r.Host = upstreamURL.Host
+	if upstreamHostHeader != "" {
+		r.Host = upstreamHostHeader
+	}
 
 	// Add tracing ID to the request header for propagation
 	r.Header.Set(tracingHeader, tracingID)
 
+	// Continue an incoming W3C trace (traceparent/tracestate) if present
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx, span := tracer.Start(ctx, "litmus-proxy "+r.Method, trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("http.method", r.Method),
+		attribute.String("http.target", r.URL.Path),
+		attribute.String("litmus.upstream_host", upstreamURL.Host),
+		attribute.String("litmus.context", litmusContext),
+		attribute.String("litmus.tracing_id", tracingID),
+		attribute.String("litmus.request_id", requestID),
+	)
+	r = r.WithContext(ctx)
+
+	// Propagate the proxy's span to the upstream
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(r.Header))
+
 	// Copy request headers, potentially filtering out Authorization
 	sanitizedHeaders := make(http.Header)
 	for name, values := range r.Header {
@@ -147,12 +421,33 @@ func handleRequest(w http.ResponseWriter, r *http.Request, proxy *httputil.Rever
 		sanitizedHeaders[name] = values
 	}
 
+	// WebSocket connections are streamed without buffering and logged once
+	// when the connection closes
+	if isWebSocketUpgrade(r) {
+		upgradeWriter := &upgradeRecorder{ResponseWriter: w}
+		proxy.ServeHTTP(upgradeWriter, r)
+
+		status := recordSpanStatus(span, upgradeWriter.status)
+		if !shouldLogPath(r.URL.Path) {
+			return
+		}
+		logUpgradedConnection(requestLogger, requestID, tracingID, litmusContext, r, clientPath, startTime, time.Now(), upstreamURL, status, sanitizedHeaders)
+		return
+	}
+
 	wrappedWriter := &statusRecorder{ResponseWriter: w}
 
 	// Explicitly call the proxy's ServeHTTP
+	upstreamStart := time.Now()
 	proxy.ServeHTTP(wrappedWriter, r)
 
 	endTime := time.Now()
+	upstreamLatency := endTime.Sub(upstreamStart)
+
+	status := recordSpanStatus(span, wrappedWriter.status)
+	if !shouldLogPath(r.URL.Path) {
+		return
+	}
 
 	// Handle gzip encoded response
 	var responseBody []byte
@@ -176,56 +471,152 @@ func handleRequest(w http.ResponseWriter, r *http.Request, proxy *httputil.Rever
 		responseBody = wrappedWriter.buf.Bytes()
 	}
 
-	// Log the combined request and response details
-	logRequestAndResponse(requestID, tracingID, litmusContext, r, startTime, endTime, upstreamURL, requestBody, responseBody, sanitizedHeaders)
+	// The upstream received the original bytes, log compressed uploads decoded
+	loggedRequestBody := requestBody
+	if contentEncoding := r.Header.Get("Content-Encoding"); contentEncoding != "" && len(requestBody) > 0 {
+		decoded, err := decodeBody(contentEncoding, requestBody)
+		if err != nil {
+			log.Printf("Failed to decode request body, logging it as received: %v", err)
+		} else {
+			loggedRequestBody = decoded
+		}
+	}
+
+	// Log the combined request and response details off the request path, so
+	// the client doesn't wait for body uploads or the log write
+	pendingLogs.Add(1)
+	go func() {
+		defer pendingLogs.Done()
+		logRequestAndResponse(requestLogger, requestID, tracingID, litmusContext, r, clientPath, startTime, endTime, upstreamLatency, upstreamURL, status, loggedRequestBody, responseBody, sanitizedHeaders)
+	}()
 }
 
-func logRequestAndResponse(requestID, tracingID, litmusContext string, r *http.Request, startTime time.Time, endTime time.Time, upstreamURL *url.URL, requestBody []byte, responseBody []byte, sanitizedHeaders http.Header) {
+// shouldLogPath reports whether requests forwarded to path are logged, which
+// is all of them unless LITMUS_LOG_PATH_REGEX is set.
+func shouldLogPath(path string) bool {
+	return logPathRegex == nil || logPathRegex.MatchString(path)
+}
 
-	// Attempt to unmarshal the request body
-	var requestBodyJSON interface{}
-	if err := json.Unmarshal(requestBody, &requestBodyJSON); err != nil {
-		// If unmarshaling fails, keep the raw string
-		requestBodyJSON = string(requestBody)
+// recordSpanStatus records the response status on the span and returns it,
+// defaulting to 200 when WriteHeader was never called.
+func recordSpanStatus(span trace.Span, status int) int {
+	if status == 0 {
+		status = http.StatusOK // WriteHeader is implicit for successful responses
 	}
-
-	// Attempt to unmarshal the response body
-	var responseBodyJSON interface{}
-	if err := json.Unmarshal(responseBody, &responseBodyJSON); err != nil {
-		// If unmarshaling fails, keep the raw string
-		responseBodyJSON = string(responseBody)
+	span.SetAttributes(attribute.Int("http.status_code", status))
+	if status >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(status))
 	}
+	return status
+}
 
-	requestLog := requestLog{
+// isWebSocketUpgrade reports whether the request asks to upgrade to a WebSocket.
+func isWebSocketUpgrade(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket") &&
+		strings.Contains(strings.ToLower(r.Header.Get("Connection")), "upgrade")
+}
+
+// logUpgradedConnection logs a single connection-level entry for an upgraded
+// (WebSocket) connection, without request or response bodies.
+func logUpgradedConnection(requestLogger RequestLogger, requestID, tracingID, litmusContext string, r *http.Request, clientPath string, startTime time.Time, endTime time.Time, upstreamURL *url.URL, status int, sanitizedHeaders http.Header) {
+	queryParams := sanitizeQuery(r.URL.Query())
+	requestURI, upstreamPath := loggedURIs(upstreamURL, r.URL, clientPath, queryParams)
+
+	if err := requestLogger.Log(requestLog{
 		ID:             requestID,
 		TracingID:      tracingID,
 		LitmusContext:  litmusContext,
 		Timestamp:      startTime,
 		Method:         r.Method,
-		RequestURI:     r.RequestURI,
+		RequestURI:     requestURI,
+		QueryParams:    queryParams,
 		UpstreamURL:    upstreamURL.String(),
-		RequestHeaders: sanitizedHeaders, // Log the potentially filtered headers
-		RequestBody:    requestBodyJSON,  // Use the unmarshalled or raw request body
-		RequestSize:    int64(len(requestBody)),
-		ResponseStatus: 0,                // Placeholder - will be updated below
-		ResponseBody:   responseBodyJSON, // Use the unmarshalled or raw response body
-		ResponseSize:   int64(len(responseBody)),
-		Latency:        endTime.Sub(startTime).Milliseconds(),
+		UpstreamPath:   upstreamPath,
+		RequestHeaders: sanitizedHeaders,
+		ResponseStatus: status,
+		Latency:        endTime.Sub(startTime).Milliseconds(), // Connection duration
+		Upgrade:        "websocket",
+	}); err != nil {
+		log.Printf("Failed to log upgraded connection: %v", err)
 	}
+}
 
-	// Update ResponseStatus now that we have it
-	if rec, ok := r.Context().Value("statusRecorder").(*statusRecorder); ok {
-		requestLog.ResponseStatus = rec.status
+func logRequestAndResponse(requestLogger RequestLogger, requestID, tracingID, litmusContext string, r *http.Request, clientPath string, startTime time.Time, endTime time.Time, upstreamLatency time.Duration, upstreamURL *url.URL, status int, requestBody []byte, responseBody []byte, sanitizedHeaders http.Header) {
+
+	// The request context is canceled once the response is sent, so the
+	// uploads get their own deadline
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), bodyUploadTimeout)
+	defer cancel()
+
+	// Offload oversized bodies to GCS and only log a truncated preview
+	var requestBodyJSON, responseBodyJSON interface{}
+	var requestBodyURI, responseBodyURI string
+	if bodyStore.exceeds(requestBody) {
+		requestBodyURI, requestBodyJSON = bodyStore.offload(ctx, litmusContext, requestID, "request", requestBody)
+	} else if err := json.Unmarshal(requestBody, &requestBodyJSON); err != nil {
+		// If unmarshaling fails, keep the raw string
+		requestBodyJSON = string(requestBody)
+	}
+
+	if bodyStore.exceeds(responseBody) {
+		responseBodyURI, responseBodyJSON = bodyStore.offload(ctx, litmusContext, requestID, "response", responseBody)
+	} else if err := json.Unmarshal(responseBody, &responseBodyJSON); err != nil {
+		// If unmarshaling fails, keep the raw string
+		responseBodyJSON = string(responseBody)
+	}
+
+	// Redact sensitive query parameters in both the parsed params and the URIs
+	queryParams := sanitizeQuery(r.URL.Query())
+	requestURI, upstreamPath := loggedURIs(upstreamURL, r.URL, clientPath, queryParams)
+
+	// Everything up to the log write except forwarding is the proxy's own work
+	proxyOverhead := time.Since(startTime) - upstreamLatency
+
+	requestLog := requestLog{
+		ID:              requestID,
+		TracingID:       tracingID,
+		LitmusContext:   litmusContext,
+		Timestamp:       startTime,
+		Method:          r.Method,
+		RequestURI:      requestURI, // The path and query the client requested
+		QueryParams:     queryParams,
+		UpstreamURL:     upstreamURL.String(),
+		UpstreamPath:    upstreamPath,     // The path and query actually sent upstream
+		RequestHeaders:  sanitizedHeaders, // Log the potentially filtered headers
+		RequestBody:     requestBodyJSON,  // Use the unmarshalled or raw request body
+		RequestBodyURI:  requestBodyURI,
+		RequestSize:     int64(len(requestBody)),
+		ResponseStatus:  status,
+		ResponseBody:    responseBodyJSON, // Use the unmarshalled or raw response body
+		ResponseBodyURI: responseBodyURI,
+		ResponseSize:    int64(len(responseBody)),
+		Latency:         endTime.Sub(startTime).Milliseconds(),
+		UpstreamLatency: upstreamLatency.Milliseconds(),
+		ProxyOverhead:   proxyOverhead.Milliseconds(),
 	}
 
 	// Log the combined entry
-	if err := logger.LogSync(context.Background(), logging.Entry{
-		Payload: requestLog,
-	}); err != nil {
+	if err := requestLogger.Log(requestLog); err != nil {
 		log.Printf("Failed to log request and response: %v", err)
 	}
 }
 
+// upgradeRecorder captures the status of an upgraded connection without
+// buffering. Unwrap lets the reverse proxy hijack the underlying connection.
+type upgradeRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *upgradeRecorder) WriteHeader(code int) {
+	rec.status = code
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *upgradeRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
 // statusRecorder modified to capture the response body
 type statusRecorder struct {
 	http.ResponseWriter
@@ -245,25 +636,93 @@ func (rec *statusRecorder) WriteHeader(code int) {
 	rec.ResponseWriter.WriteHeader(code)
 }
 
-func extractLitmusContext(path string) (string, string) {
-	matches := contextPathRegex.FindStringSubmatch(path)
-	// If there is a context
-	if len(matches) == 3 {
-		// Extract the context value and update the path
-		context := matches[1]
-		newPath := matches[2]
-
-		// Remove the "litmus-context-" prefix
-		if len(context) > 15 && context[:15] == "litmus-context-" {
-			context = context[15:]
+// loggedURIs returns the path and query the client requested, including the
+// litmus-context segment, and the ones forwarded upstream after the context
+// and prefix rewrites, both with the sanitized queryParams. Like the reverse
+// proxy, the upstream path is joined to the base path of upstreamURL.
+func loggedURIs(upstreamURL, forwarded *url.URL, clientPath string, queryParams url.Values) (string, string) {
+	upstreamPath := forwarded.Path
+	if base := strings.TrimSuffix(upstreamURL.Path, "/"); base != "" {
+		upstreamPath = base + "/" + strings.TrimPrefix(forwarded.Path, "/")
+	}
+	upstream := url.URL{Path: upstreamPath, RawQuery: queryParams.Encode()}
+	client := url.URL{Path: clientPath, RawQuery: upstream.RawQuery}
+	return client.RequestURI(), upstream.RequestURI()
+}
+
+// sanitizeQuery returns a copy of the query parameters with the values of
+// sensitive parameters (see sensitiveQueryParams) replaced by "REDACTED".
+func sanitizeQuery(query url.Values) url.Values {
+	sanitized := make(url.Values, len(query))
+	for name, values := range query {
+		redact := false
+		for _, sensitive := range sensitiveQueryParams {
+			if strings.EqualFold(name, sensitive) {
+				redact = true
+				break
+			}
+		}
+		if redact {
+			redacted := make([]string, len(values))
+			for i := range redacted {
+				redacted[i] = "REDACTED"
+			}
+			values = redacted
 		}
+		sanitized[name] = values
+	}
+	return sanitized
+}
 
-		return context, newPath
+// rewritePath applies LITMUS_STRIP_PREFIX and LITMUS_ADD_PREFIX to the path
+// forwarded upstream, e.g. with LITMUS_STRIP_PREFIX=/v1 and
+// LITMUS_ADD_PREFIX=/api, "/v1/models" becomes "/api/models". The prefix is
+// only stripped on a segment boundary, so "/v1beta1/models" is kept.
+func rewritePath(path string) string {
+	if hasPathPrefix(path, stripPrefix) {
+		path = strings.TrimPrefix(path, strings.TrimSuffix(stripPrefix, "/"))
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
 	}
-	// If there is no context
-	if len(matches) == 2 {
-		newPath := matches[1]
-		return "", newPath
+	if addPrefix != "" {
+		path = strings.TrimSuffix(addPrefix, "/") + path
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
 	}
-	return "", path // Return empty string if no match
-}
\ No newline at end of file
+	return path
+}
+
+// hasPathPrefix reports whether prefix is a leading run of whole segments of
+// path, i.e. path equals prefix or continues with a "/" after it.
+func hasPathPrefix(path, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix == "" || !strings.HasPrefix(path, prefix) {
+		return false
+	}
+	return len(path) == len(prefix) || path[len(prefix)] == '/'
+}
+
+// extractLitmusContext splits a request path into the Litmus context and the
+// path to forward upstream. For example:
+//
+//	/litmus-context-abc/foo -> ("abc", "/foo")
+//	litmus-context-abc/foo  -> ("abc", "/foo")
+//	/litmus-context-abc     -> ("abc", "/")
+//	/foo                    -> ("", "/foo")
+//
+// If the path does not start with a context segment, the context is empty and
+// the path is returned unchanged.
+func extractLitmusContext(path string) (string, string) {
+	matches := contextPathRegex.FindStringSubmatch(path)
+	if matches == nil {
+		return "", path
+	}
+
+	context, remainingPath := matches[1], matches[2]
+	if remainingPath == "" {
+		remainingPath = "/"
+	}
+	return context, remainingPath
+}
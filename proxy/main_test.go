@@ -0,0 +1,471 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+// fakeRequestLogger records the entries logged by the proxy handler. The
+// handler logs after writing the response, so tests wait for the entry.
+type fakeRequestLogger struct {
+	entries chan requestLog
+}
+
+func newFakeRequestLogger() *fakeRequestLogger {
+	return &fakeRequestLogger{entries: make(chan requestLog, 10)}
+}
+
+func (l *fakeRequestLogger) Log(entry requestLog) error {
+	l.entries <- entry
+	return nil
+}
+
+// next waits for the next logged entry.
+func (l *fakeRequestLogger) next(t *testing.T) requestLog {
+	t.Helper()
+	select {
+	case entry := <-l.entries:
+		return entry
+	case <-time.After(5 * time.Second):
+		t.Fatal("no request was logged")
+		return requestLog{}
+	}
+}
+
+// newTestHandler starts an upstream serving upstreamHandler and returns a
+// proxy handler in front of it and the logger it writes to.
+func newTestHandler(t *testing.T, upstreamHandler http.HandlerFunc) (http.Handler, *fakeRequestLogger) {
+	t.Helper()
+	upstream := httptest.NewServer(upstreamHandler)
+	t.Cleanup(upstream.Close)
+	upstreamURL, err := url.Parse(upstream.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requestLogger := newFakeRequestLogger()
+	return newProxyHandler(upstreamURL, requestLogger, http.DefaultTransport), requestLogger
+}
+
+// newTestProxy serves the handler of newTestHandler and returns its URL.
+func newTestProxy(t *testing.T, upstreamHandler http.HandlerFunc) (string, *fakeRequestLogger) {
+	t.Helper()
+	handler, requestLogger := newTestHandler(t, upstreamHandler)
+	proxy := httptest.NewServer(handler)
+	t.Cleanup(proxy.Close)
+	return proxy.URL, requestLogger
+}
+
+func TestUpstreamURLFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		unset   bool
+		want    string
+		wantErr string
+	}{
+		{name: "unset", unset: true, wantErr: "UPSTREAM_URL not set"},
+		{name: "empty", value: "", wantErr: "value is empty"},
+		{name: "blank", value: "  ", wantErr: "value is empty"},
+		{name: "bare host", value: "us-central1-aiplatform.googleapis.com", want: "https://us-central1-aiplatform.googleapis.com"},
+		{name: "http URL", value: "http://10.0.0.5:8080", want: "http://10.0.0.5:8080"},
+		{name: "unsupported scheme", value: "ftp://example.com", wantErr: "unsupported scheme"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("UPSTREAM_URL", tt.value) // Restores the variable after the test
+			if tt.unset {
+				os.Unsetenv("UPSTREAM_URL")
+			}
+
+			u, err := upstreamURLFromEnv()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if u.String() != tt.want {
+				t.Errorf("URL = %q, want %q", u.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestLoggedURIs(t *testing.T) {
+	tests := []struct {
+		name         string
+		upstreamURL  string
+		wantUpstream string
+	}{
+		{name: "host", upstreamURL: "https://example.com", wantUpstream: "/api/models?alt=sse&key=REDACTED"},
+		{name: "root path", upstreamURL: "https://example.com/", wantUpstream: "/api/models?alt=sse&key=REDACTED"},
+		{name: "base path", upstreamURL: "http://10.0.0.5:8080/gateway", wantUpstream: "/gateway/api/models?alt=sse&key=REDACTED"},
+		{name: "base path with slash", upstreamURL: "http://10.0.0.5:8080/gateway/", wantUpstream: "/gateway/api/models?alt=sse&key=REDACTED"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstreamURL, err := parseUpstreamURL(tt.upstreamURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			forwarded := &url.URL{Path: "/api/models", RawQuery: "key=secret&alt=sse"}
+			queryParams := sanitizeQuery(forwarded.Query())
+
+			requestURI, upstreamPath := loggedURIs(upstreamURL, forwarded, "/litmus-context-abc/v1/models", queryParams)
+			if want := "/litmus-context-abc/v1/models?alt=sse&key=REDACTED"; requestURI != want {
+				t.Errorf("requestURI = %q, want %q", requestURI, want)
+			}
+			if upstreamPath != tt.wantUpstream {
+				t.Errorf("upstreamPath = %q, want %q", upstreamPath, tt.wantUpstream)
+			}
+		})
+	}
+}
+
+func TestProxyHandlerLogsUpstreamBasePath(t *testing.T) {
+	var received string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.URL.RequestURI()
+	}))
+	defer upstream.Close()
+	upstreamURL, err := parseUpstreamURL(upstream.URL + "/gateway")
+	if err != nil {
+		t.Fatal(err)
+	}
+	requestLogger := newFakeRequestLogger()
+	handler := newProxyHandler(upstreamURL, requestLogger, http.DefaultTransport)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/litmus-context-abc/v1/models", nil))
+
+	entry := requestLogger.next(t)
+	if received != "/gateway/v1/models" {
+		t.Errorf("upstream received %q, want /gateway/v1/models", received)
+	}
+	if entry.UpstreamPath != received {
+		t.Errorf("logged UpstreamPath = %q, want the path the upstream received (%q)", entry.UpstreamPath, received)
+	}
+}
+
+func TestProxyHandlerLogsAfterResponse(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer upstream.Close()
+	upstreamURL, err := url.Parse(upstream.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Unbuffered, so Log blocks until the entry is read
+	requestLogger := &fakeRequestLogger{entries: make(chan requestLog)}
+	handler := newProxyHandler(upstreamURL, requestLogger, http.DefaultTransport)
+
+	served := make(chan struct{})
+	rec := httptest.NewRecorder()
+	go func() {
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/generate", strings.NewReader(`{"prompt":"hi"}`)))
+		close(served)
+	}()
+	select {
+	case <-served:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the handler waited for the log write")
+	}
+
+	entry := requestLogger.next(t)
+	if rec.Code != http.StatusOK || entry.ResponseStatus != http.StatusOK {
+		t.Errorf("status = %d, logged %d, want 200", rec.Code, entry.ResponseStatus)
+	}
+}
+
+func TestProxyHandlerDecodesGzipResponse(t *testing.T) {
+	proxyURL, requestLogger := newTestProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set("Content-Type", "application/json")
+		gw := gzip.NewWriter(w)
+		gw.Write([]byte(`{"answer":42}`))
+		gw.Close()
+	})
+
+	req, err := http.NewRequest(http.MethodGet, proxyURL+"/v1/models", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Setting the header ourselves stops the client from decoding the response
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	// The client receives the response as sent by the upstream
+	gr, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatalf("response is not gzip encoded: %v", err)
+	}
+	body, err := io.ReadAll(gr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != `{"answer":42}` {
+		t.Errorf("client body = %q, want the upstream body", body)
+	}
+
+	// The log holds the decoded JSON
+	entry := requestLogger.next(t)
+	responseBody, ok := entry.ResponseBody.(map[string]interface{})
+	if !ok || responseBody["answer"] != float64(42) {
+		t.Errorf("logged ResponseBody = %#v, want the decoded JSON", entry.ResponseBody)
+	}
+	if entry.ResponseStatus != http.StatusOK {
+		t.Errorf("logged ResponseStatus = %d, want %d", entry.ResponseStatus, http.StatusOK)
+	}
+}
+
+func TestProxyHandlerStripsLitmusContext(t *testing.T) {
+	var upstreamPath string
+	proxyURL, requestLogger := newTestProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		upstreamPath = r.URL.RequestURI()
+	})
+
+	resp, err := http.Post(proxyURL+"/litmus-context-run-123/v1/models?alt=sse", "application/json", strings.NewReader(`{"prompt":"hi"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if upstreamPath != "/v1/models?alt=sse" {
+		t.Errorf("upstream received %q, want /v1/models?alt=sse", upstreamPath)
+	}
+	entry := requestLogger.next(t)
+	if entry.LitmusContext != "run-123" {
+		t.Errorf("logged LitmusContext = %q, want run-123", entry.LitmusContext)
+	}
+	if entry.RequestURI != "/litmus-context-run-123/v1/models?alt=sse" {
+		t.Errorf("logged RequestURI = %q, want the client path", entry.RequestURI)
+	}
+	if entry.UpstreamPath != "/v1/models?alt=sse" {
+		t.Errorf("logged UpstreamPath = %q, want the forwarded path", entry.UpstreamPath)
+	}
+	requestBody, ok := entry.RequestBody.(map[string]interface{})
+	if !ok || requestBody["prompt"] != "hi" {
+		t.Errorf("logged RequestBody = %#v, want the request JSON", entry.RequestBody)
+	}
+}
+
+func TestProxyHandlerTracingHeader(t *testing.T) {
+	tests := []struct {
+		name      string
+		tracingID string
+	}{
+		{name: "propagated", tracingID: "trace-abc"},
+		{name: "generated"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var upstreamTracingID string
+			proxyURL, requestLogger := newTestProxy(t, func(w http.ResponseWriter, r *http.Request) {
+				upstreamTracingID = r.Header.Get(tracingHeader)
+			})
+
+			req, err := http.NewRequest(http.MethodGet, proxyURL+"/v1/models", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.tracingID != "" {
+				req.Header.Set(tracingHeader, tt.tracingID)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			entry := requestLogger.next(t)
+			if upstreamTracingID == "" {
+				t.Fatalf("upstream received no %s header", tracingHeader)
+			}
+			if tt.tracingID != "" && upstreamTracingID != tt.tracingID {
+				t.Errorf("upstream %s = %q, want %q", tracingHeader, upstreamTracingID, tt.tracingID)
+			}
+			if entry.TracingID != upstreamTracingID {
+				t.Errorf("logged TracingID = %q, want %q", entry.TracingID, upstreamTracingID)
+			}
+			// Without a context in the path, the tracing ID is the context
+			if entry.LitmusContext != upstreamTracingID {
+				t.Errorf("logged LitmusContext = %q, want %q", entry.LitmusContext, upstreamTracingID)
+			}
+		})
+	}
+}
+
+func TestProxyHandlerOmitsAuthorizationFromLog(t *testing.T) {
+	var upstreamAuthorization string
+	proxyURL, requestLogger := newTestProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		upstreamAuthorization = r.Header.Get("Authorization")
+	})
+
+	req, err := http.NewRequest(http.MethodPost, proxyURL+"/v1/models", bytes.NewReader([]byte("{}")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer secret-token")
+	req.Header.Set("X-Custom", "kept")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if upstreamAuthorization != "Bearer secret-token" {
+		t.Errorf("upstream Authorization = %q, want it forwarded", upstreamAuthorization)
+	}
+	entry := requestLogger.next(t)
+	if _, ok := entry.RequestHeaders["Authorization"]; ok {
+		t.Errorf("logged RequestHeaders contain Authorization: %v", entry.RequestHeaders)
+	}
+	if got := entry.RequestHeaders.Get("X-Custom"); got != "kept" {
+		t.Errorf("logged X-Custom = %q, want kept", got)
+	}
+}
+
+func TestRewritePath(t *testing.T) {
+	tests := []struct {
+		name  string
+		strip string
+		add   string
+		path  string
+		want  string
+	}{
+		{name: "no rewrite", path: "/v1/models", want: "/v1/models"},
+		{name: "strip segment", strip: "/v1", path: "/v1/models", want: "/models"},
+		{name: "strip whole path", strip: "/v1", path: "/v1", want: "/"},
+		{name: "strip with trailing slash", strip: "/v1/", path: "/v1/models", want: "/models"},
+		{name: "strip partial segment", strip: "/v1", path: "/v1beta1/models", want: "/v1beta1/models"},
+		{name: "strip nested segments", strip: "/api/v1", path: "/api/v1/models", want: "/models"},
+		{name: "strip not a prefix", strip: "/v1", path: "/models/v1", want: "/models/v1"},
+		{name: "add", add: "/api", path: "/models", want: "/api/models"},
+		{name: "add without leading slash", add: "api/", path: "/models", want: "/api/models"},
+		{name: "strip and add", strip: "/v1", add: "/api", path: "/v1/models", want: "/api/models"},
+		{name: "add after partial segment", strip: "/v1", add: "/api", path: "/v1beta1/models", want: "/api/v1beta1/models"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			savedStrip, savedAdd := stripPrefix, addPrefix
+			t.Cleanup(func() { stripPrefix, addPrefix = savedStrip, savedAdd })
+			stripPrefix, addPrefix = tt.strip, tt.add
+
+			if got := rewritePath(tt.path); got != tt.want {
+				t.Errorf("rewritePath(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractLitmusContext(t *testing.T) {
+	tests := []struct {
+		path        string
+		wantContext string
+		wantPath    string
+	}{
+		{path: "/litmus-context-abc/foo", wantContext: "abc", wantPath: "/foo"},
+		{path: "/litmus-context-abc/foo/bar", wantContext: "abc", wantPath: "/foo/bar"},
+		{path: "/litmus-context-abc", wantContext: "abc", wantPath: "/"},
+		{path: "/litmus-context-abc/", wantContext: "abc", wantPath: "/"},
+		{path: "litmus-context-xyz", wantContext: "xyz", wantPath: "/"},
+		{path: "litmus-context-xyz/foo", wantContext: "xyz", wantPath: "/foo"},
+		{path: "/litmus-context-run-1-2/foo", wantContext: "run-1-2", wantPath: "/foo"},
+		{path: "/foo", wantContext: "", wantPath: "/foo"},
+		{path: "/foo/litmus-context-abc", wantContext: "", wantPath: "/foo/litmus-context-abc"},
+		{path: "/litmus-context-/foo", wantContext: "", wantPath: "/litmus-context-/foo"},
+		{path: "/", wantContext: "", wantPath: "/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			context, path := extractLitmusContext(tt.path)
+			if context != tt.wantContext || path != tt.wantPath {
+				t.Errorf("extractLitmusContext(%q) = (%q, %q), want (%q, %q)", tt.path, context, path, tt.wantContext, tt.wantPath)
+			}
+		})
+	}
+}
+
+func TestHandleRequestWithoutBody(t *testing.T) {
+	var upstreamBody []byte
+	handler, requestLogger := newTestHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		upstreamBody, _ = io.ReadAll(r.Body)
+		w.Write([]byte("ok"))
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+	req.Body = nil // As for client requests without a body
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK || rec.Body.String() != "ok" {
+		t.Errorf("response = %d %q, want 200 ok", rec.Code, rec.Body.String())
+	}
+	if len(upstreamBody) != 0 {
+		t.Errorf("upstream received body %q, want none", upstreamBody)
+	}
+	entry := requestLogger.next(t)
+	if entry.RequestBody != "" || entry.RequestSize != 0 {
+		t.Errorf("logged RequestBody = %#v (size %d), want an empty body", entry.RequestBody, entry.RequestSize)
+	}
+}
+
+func TestHandleRequestPartialBody(t *testing.T) {
+	var upstreamBody []byte
+	handler, requestLogger := newTestHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		upstreamBody, _ = io.ReadAll(r.Body)
+	})
+
+	// The client connection breaks after the first bytes of the body
+	body := io.MultiReader(strings.NewReader(`{"prompt":`), iotest.ErrReader(errors.New("connection reset")))
+	req := httptest.NewRequest(http.MethodPost, "/v1/models", body)
+	req.ContentLength = 100
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if string(upstreamBody) != `{"prompt":` {
+		t.Errorf("upstream received %q, want the partial body", upstreamBody)
+	}
+	entry := requestLogger.next(t)
+	if entry.RequestBody != `{"prompt":` || entry.RequestSize != int64(len(`{"prompt":`)) {
+		t.Errorf("logged RequestBody = %#v (size %d), want the partial body", entry.RequestBody, entry.RequestSize)
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Limiters that have not been used for this long are dropped
+const rateLimiterIdleTimeout = 5 * time.Minute
+
+// contextRateLimiter is an in-memory token-bucket rate limiter keyed by
+// Litmus context.
+type contextRateLimiter struct {
+	mu          sync.Mutex
+	limit       rate.Limit
+	burst       int
+	limiters    map[string]*contextLimiter
+	lastCleanup time.Time
+}
+
+type contextLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// newContextRateLimiter creates a limiter from LITMUS_RATE_LIMIT_RPS
+// (requests per second per context) and LITMUS_RATE_LIMIT_BURST. It returns
+// nil if rate limiting is not configured.
+func newContextRateLimiter() (*contextRateLimiter, error) {
+	value := os.Getenv("LITMUS_RATE_LIMIT_RPS")
+	if value == "" {
+		return nil, nil
+	}
+	rps, err := strconv.ParseFloat(value, 64)
+	if err != nil || rps < 0 {
+		return nil, fmt.Errorf("invalid LITMUS_RATE_LIMIT_RPS '%s': must be a non-negative number", value)
+	}
+	if rps == 0 {
+		return nil, nil
+	}
+
+	burst := int(math.Max(1, math.Ceil(rps)))
+	if value := os.Getenv("LITMUS_RATE_LIMIT_BURST"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			return nil, fmt.Errorf("invalid LITMUS_RATE_LIMIT_BURST '%s': must be a positive integer", value)
+		}
+		burst = parsed
+	}
+
+	return &contextRateLimiter{
+		limit:       rate.Limit(rps),
+		burst:       burst,
+		limiters:    make(map[string]*contextLimiter),
+		lastCleanup: time.Now(),
+	}, nil
+}
+
+// allow consumes a token for the given context. If the context is over its
+// limit, it returns false and how long the client should wait before retrying.
+func (l *contextRateLimiter) allow(litmusContext string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.cleanup(now)
+
+	entry, ok := l.limiters[litmusContext]
+	if !ok {
+		entry = &contextLimiter{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.limiters[litmusContext] = entry
+	}
+	entry.lastSeen = now
+
+	reservation := entry.limiter.ReserveN(now, 1)
+	if delay := reservation.DelayFrom(now); delay > 0 {
+		reservation.CancelAt(now)
+		return false, delay
+	}
+	return true, 0
+}
+
+// cleanup drops idle limiters so contexts that are only used once (e.g. a
+// tracing ID) do not accumulate. Must be called with l.mu held.
+func (l *contextRateLimiter) cleanup(now time.Time) {
+	if now.Sub(l.lastCleanup) < time.Minute {
+		return
+	}
+	for key, entry := range l.limiters {
+		if now.Sub(entry.lastSeen) > rateLimiterIdleTimeout {
+			delete(l.limiters, key)
+		}
+	}
+	l.lastCleanup = now
+}
@@ -0,0 +1,103 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// newUpstreamTransport builds the transport used to connect to the upstream.
+// LITMUS_UPSTREAM_CA_FILE adds a PEM bundle of trusted CAs (e.g. for internal
+// gateways behind a private CA) and LITMUS_UPSTREAM_INSECURE_SKIP_VERIFY
+// disables certificate verification entirely (discouraged).
+// LITMUS_UPSTREAM_SNI sends another TLS server name than the UPSTREAM_URL
+// host, and verifies the upstream certificate against it.
+//
+// The connection pool is sized for a single upstream host:
+// LITMUS_MAX_IDLE_CONNS (default: 100) idle keep-alive connections are kept
+// for it, instead of http.DefaultTransport's 2 per host, and
+// LITMUS_MAX_CONNS_PER_HOST (default: 0, unlimited) caps the total.
+func newUpstreamTransport() (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	tlsConfig := &tls.Config{}
+
+	maxIdleConns, err := intFromEnv("LITMUS_MAX_IDLE_CONNS", 100)
+	if err != nil {
+		return nil, err
+	}
+	maxConnsPerHost, err := intFromEnv("LITMUS_MAX_CONNS_PER_HOST", 0)
+	if err != nil {
+		return nil, err
+	}
+	// All requests go to the same host, so the per-host idle limit is the
+	// one that matters
+	transport.MaxIdleConns = maxIdleConns
+	transport.MaxIdleConnsPerHost = maxIdleConns
+	transport.MaxConnsPerHost = maxConnsPerHost
+
+	if caFile := os.Getenv("LITMUS_UPSTREAM_CA_FILE"); caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read LITMUS_UPSTREAM_CA_FILE: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no valid PEM certificates found in LITMUS_UPSTREAM_CA_FILE '%s'", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if sni := strings.TrimSpace(os.Getenv("LITMUS_UPSTREAM_SNI")); sni != "" {
+		tlsConfig.ServerName = sni
+	}
+
+	if value := os.Getenv("LITMUS_UPSTREAM_INSECURE_SKIP_VERIFY"); value != "" {
+		insecure, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid LITMUS_UPSTREAM_INSECURE_SKIP_VERIFY '%s': %w", value, err)
+		}
+		if insecure {
+			log.Printf("WARNING: TLS certificate verification for the upstream is disabled")
+			tlsConfig.InsecureSkipVerify = true
+		}
+	}
+
+	transport.TLSClientConfig = tlsConfig
+	return transport, nil
+}
+
+// intFromEnv parses a non-negative integer environment variable, returning
+// fallback if it is not set.
+func intFromEnv(name string, fallback int) (int, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s '%s': must be a non-negative integer", name, value)
+	}
+	return n, nil
+}
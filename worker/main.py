@@ -44,7 +44,11 @@ WORKER_LOG_NAME = "litmus-worker-log"
 
 # Selects the logs to write to
 core_logger = logging_client.logger(CORE_LOG_NAME)
-worker_logger = logging_client.logger(WORKER_LOG_NAME)
+# Worker entries are labelled with the run ID so `litmus run logs <runID>` can
+# find them
+worker_logger = logging_client.logger(
+    WORKER_LOG_NAME, labels={"run_id": os.environ.get("RUN_ID", "")}
+)
 
 # Writes a log entry indicating the worker is starting
 worker_logger.log_text("### Litmus-worker starting ###")
@@ -426,7 +430,7 @@ def execute_tests_and_store_results(run_id, template_id):
         template_id (str): The ID of the test template.
     """
 
-    db = firestore.Client()
+    db = firestore.Client(database=os.environ.get("FIRESTORE_DATABASE", "(default)"))
     run_ref = db.collection("test_runs").document(run_id)
     run_data = run_ref.get().to_dict()
 